@@ -0,0 +1,284 @@
+// Package arpa reads and writes backoff language models in the ARPA format used by standard language modelling
+// toolkits, so that the models learned here can be compared with theirs.
+package arpa
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/fergloragain/trigrams/gram"
+	"github.com/pkg/errors"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ImportScale is the total frequency shared out between the grams of a model added to a collection. ARPA models hold
+// probabilities rather than counts, so each gram is given a frequency in proportion to its probability.
+const ImportScale = 1000000
+
+// Model is a backoff language model. Each n-gram of each order up to Order has a log10 probability, and each n-gram
+// below the highest order a log10 backoff weight, applied when a longer n-gram starting with it isn't in the model.
+type Model struct {
+	Order int
+	grams []map[string]*entry // the n-grams of each order, from unigrams up, keyed by their words joined by spaces
+}
+
+type entry struct {
+	prob    float64
+	backoff float64
+}
+
+// Score is how well a model predicts some text
+type Score struct {
+	Words      int     `json:"words"`
+	OOVs       int     `json:"oovs"` // words missing from the model, which aren't scored
+	LogProb    float64 `json:"log_prob"`
+	Perplexity float64 `json:"perplexity"`
+}
+
+func newModel(order int) *Model {
+	m := &Model{Order: order}
+
+	for i := 0; i < order; i++ {
+		m.grams = append(m.grams, map[string]*entry{})
+	}
+
+	return m
+}
+
+// Len returns the number of n-grams of the given order
+func (m *Model) Len(order int) int {
+	if order < 1 || order > m.Order {
+		return 0
+	}
+
+	return len(m.grams[order-1])
+}
+
+// LogProb returns the log10 probability of the last word following the words before it, backing off to shorter
+// histories as needed. Only the last Order-1 words of history are used. A word missing from the model has a
+// probability of 0, so negative infinity is returned.
+func (m *Model) LogProb(words []string) float64 {
+	if len(words) > m.Order {
+		words = words[len(words)-m.Order:]
+	}
+
+	if len(words) == 0 {
+		return math.Inf(-1)
+	}
+
+	if e, ok := m.grams[len(words)-1][strings.Join(words, " ")]; ok {
+		return e.prob
+	}
+
+	if len(words) == 1 {
+		return math.Inf(-1)
+	}
+
+	backoff := 0.0
+
+	if e, ok := m.grams[len(words)-2][strings.Join(words[:len(words)-1], " ")]; ok {
+		backoff = e.backoff
+	}
+
+	return backoff + m.LogProb(words[1:])
+}
+
+// Score scores a run of words. Words missing from the model are counted, but otherwise skipped.
+func (m *Model) Score(words []string) Score {
+	score := Score{Words: len(words)}
+
+	for i := range words {
+		logProb := m.LogProb(words[:i+1])
+
+		if math.IsInf(logProb, -1) {
+			score.OOVs++
+			continue
+		}
+
+		score.LogProb += logProb
+	}
+
+	if scored := score.Words - score.OOVs; scored > 0 {
+		score.Perplexity = math.Pow(10, -score.LogProb/float64(scored))
+	}
+
+	return score
+}
+
+// AddTo adds the highest order n-grams of the model to a collection, which must hold grams of the same size, or none
+// at all. Each gram's frequency is in proportion to its probability, found by the chain rule from the model, with the
+// frequencies of all the grams totalling about ImportScale, and every gram seen at least once.
+func (m *Model) AddTo(gramCollection *gram.GramCollection) error {
+	if size := gramCollection.GramSize(); size != 0 && size != m.Order {
+		return errors.Errorf("The model holds grams of %d words, not %d", m.Order, size)
+	}
+
+	keys := m.sortedKeys(m.Order)
+	joint := make([]float64, len(keys))
+	total := 0.0
+
+	for i, key := range keys {
+		words := strings.Split(key, " ")
+		logProb := 0.0
+
+		for j := range words {
+			logProb += m.LogProb(words[:j+1])
+		}
+
+		joint[i] = math.Pow(10, logProb)
+		total += joint[i]
+	}
+
+	counts := map[string]int{}
+
+	for i, key := range keys {
+		count := 1
+
+		if total > 0 {
+			count = int(math.Round(joint[i] / total * ImportScale))
+		}
+
+		if count < 1 {
+			count = 1
+		}
+
+		counts[key] = count
+	}
+
+	gramCollection.AddGrams(counts)
+
+	return nil
+}
+
+func (m *Model) sortedKeys(order int) []string {
+	keys := make([]string, 0, m.Len(order))
+
+	for key := range m.grams[order-1] {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Write writes the model in ARPA format, with the n-grams of each order sorted
+func (m *Model) Write(w io.Writer) error {
+	out := bufio.NewWriter(w)
+
+	fmt.Fprintf(out, "\\data\\\n")
+
+	for order := 1; order <= m.Order; order++ {
+		fmt.Fprintf(out, "ngram %d=%d\n", order, m.Len(order))
+	}
+
+	for order := 1; order <= m.Order; order++ {
+		fmt.Fprintf(out, "\n\\%d-grams:\n", order)
+
+		for _, key := range m.sortedKeys(order) {
+			e := m.grams[order-1][key]
+
+			if order < m.Order && e.backoff != 0 {
+				fmt.Fprintf(out, "%.6f\t%s\t%.6f\n", e.prob, key, e.backoff)
+			} else {
+				fmt.Fprintf(out, "%.6f\t%s\n", e.prob, key)
+			}
+		}
+	}
+
+	fmt.Fprintf(out, "\n\\end\\\n")
+
+	return out.Flush()
+}
+
+// Read reads a model in ARPA format
+func Read(r io.Reader) (*Model, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+
+	line := 0
+	counts := []int{}
+
+	var m *Model
+
+	order := 0 // the order of the section being read, or 0 before the first section
+
+	fail := func(format string, args ...interface{}) error {
+		return errors.Errorf("Line %d: %s", line, fmt.Sprintf(format, args...))
+	}
+
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case text == "":
+		case text == "\\data\\":
+		case strings.HasPrefix(text, "ngram ") && m == nil:
+			var n, count int
+
+			if _, err := fmt.Sscanf(text, "ngram %d=%d", &n, &count); err != nil || n != len(counts)+1 || count < 0 {
+				return nil, fail("Invalid n-gram count %q", text)
+			}
+
+			counts = append(counts, count)
+		case text == "\\end\\":
+			if m == nil {
+				return nil, fail("No n-grams")
+			}
+
+			for i, count := range counts {
+				if m.Len(i+1) != count {
+					return nil, errors.Errorf("Expected %d %d-grams, read %d", count, i+1, m.Len(i+1))
+				}
+			}
+
+			return m, nil
+		case strings.HasPrefix(text, "\\") && strings.HasSuffix(text, "-grams:"):
+			n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(text, "\\"), "-grams:"))
+			if err != nil || n != order+1 || n > len(counts) {
+				return nil, fail("Unexpected section %q", text)
+			}
+
+			if m == nil {
+				m = newModel(len(counts))
+			}
+
+			order = n
+		case order == 0:
+			return nil, fail("Unexpected %q before the first section", text)
+		default:
+			fields := strings.Fields(text)
+
+			if len(fields) != order+1 && (len(fields) != order+2 || order == m.Order) {
+				return nil, fail("Expected a probability, %d words and an optional backoff weight", order)
+			}
+
+			e := &entry{}
+
+			prob, err := strconv.ParseFloat(fields[0], 64)
+			if err != nil {
+				return nil, fail("Invalid probability %q", fields[0])
+			}
+
+			e.prob = prob
+
+			if len(fields) == order+2 {
+				if e.backoff, err = strconv.ParseFloat(fields[order+1], 64); err != nil {
+					return nil, fail("Invalid backoff weight %q", fields[order+1])
+				}
+			}
+
+			m.grams[order-1][strings.Join(fields[1:order+1], " ")] = e
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return nil, errors.New("Missing \\end\\")
+}
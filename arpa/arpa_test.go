@@ -0,0 +1,152 @@
+package arpa
+
+import (
+	"bytes"
+	"github.com/fergloragain/trigrams/gram"
+	"math"
+	"strings"
+	"testing"
+)
+
+const smallModel = `
+\data\
+ngram 1=3
+ngram 2=2
+
+\1-grams:
+-0.5	a	-0.3
+-0.6	b	-0.2
+-1.0	c
+
+\2-grams:
+-0.1	a b
+-0.4	b c
+
+\end\
+`
+
+func TestRead(t *testing.T) {
+	m, err := Read(strings.NewReader(smallModel))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Order != 2 || m.Len(1) != 3 || m.Len(2) != 2 {
+		t.Fatalf("Expected 3 unigrams and 2 bigrams, got %d and %d", m.Len(1), m.Len(2))
+	}
+
+	tt := []struct {
+		Words    []string
+		Expected float64
+	}{
+		{[]string{"a"}, -0.5},
+		{[]string{"a", "b"}, -0.1},
+		{[]string{"x", "a", "b"}, -0.1},
+		{[]string{"a", "c"}, -0.3 + -1.0}, // backs off with a's weight
+		{[]string{"c", "a"}, -0.5},        // c has no backoff weight
+		{[]string{"a", "x"}, math.Inf(-1)},
+	}
+
+	for _, tc := range tt {
+		if logProb := m.LogProb(tc.Words); math.Abs(logProb-tc.Expected) > 1e-9 && logProb != tc.Expected {
+			t.Errorf("Expected log probability %f for %v, got %f", tc.Expected, tc.Words, logProb)
+		}
+	}
+}
+
+func TestRead_Invalid(t *testing.T) {
+	tt := map[string]string{
+		"empty":           "",
+		"no end":          "\\data\\\nngram 1=1\n\n\\1-grams:\n-1\ta\n",
+		"wrong count":     "\\data\\\nngram 1=2\n\n\\1-grams:\n-1\ta\n\\end\\\n",
+		"bad probability": "\\data\\\nngram 1=1\n\n\\1-grams:\nx\ta\n\\end\\\n",
+		"too many words":  "\\data\\\nngram 1=1\n\n\\1-grams:\n-1\ta b c\n\\end\\\n",
+		"skipped order":   "\\data\\\nngram 1=1\nngram 2=1\n\n\\2-grams:\n-1\ta b\n\\end\\\n",
+		"no data":         "-1\ta\n\\end\\\n",
+	}
+
+	for name, text := range tt {
+		if _, err := Read(strings.NewReader(text)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	for _, smoothing := range []string{WittenBell, Absolute} {
+		m, err := Estimate(learnedCollection(sampleText, 3), smoothing)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+
+		if err := m.Write(&buf); err != nil {
+			t.Fatal(err)
+		}
+
+		read, err := Read(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for order := 1; order <= m.Order; order++ {
+			if read.Len(order) != m.Len(order) {
+				t.Errorf("Expected %d %d-grams, read %d", m.Len(order), order, read.Len(order))
+			}
+
+			for key, e := range m.grams[order-1] {
+				if r := read.grams[order-1][key]; r == nil || math.Abs(r.prob-e.prob) > 1e-6 || math.Abs(r.backoff-e.backoff) > 1e-6 {
+					t.Errorf("Expected %q to be read back as written", key)
+				}
+			}
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	m, err := Estimate(learnedCollection(sampleText, 3), WittenBell)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := m.Score(strings.Fields("the cat sat on the mat"))
+	unseen := m.Score(strings.Fields("mat the on sat cat the"))
+
+	if seen.Words != 6 || seen.OOVs != 0 || seen.Perplexity <= 1 || seen.Perplexity >= unseen.Perplexity {
+		t.Errorf("Expected text like the learned text to be less perplexing than jumbled text, got %+v and %+v", seen, unseen)
+	}
+
+	if withOOV := m.Score(strings.Fields("the zebra sat")); withOOV.OOVs != 1 || math.IsInf(withOOV.LogProb, 0) {
+		t.Errorf("Expected one unscored word, got %+v", withOOV)
+	}
+}
+
+func TestAddTo(t *testing.T) {
+	m, err := Read(strings.NewReader(smallModel))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gramCollection := gram.NewCollection()
+
+	if err := m.AddTo(gramCollection); err != nil {
+		t.Fatal(err)
+	}
+
+	// p(a b) = 10^-0.5 * 10^-0.1 is a little more than p(b c) = 10^-0.6 * 10^-0.4
+	ab, bc := gramCollection.Frequency([]string{"a", "b"}), gramCollection.Frequency([]string{"b", "c"})
+
+	if gramCollection.Len() != 2 || ab+bc != ImportScale || math.Abs(float64(ab)/float64(bc)-math.Pow(10, 0.4)) > 0.001 {
+		t.Errorf("Expected frequencies in proportion to probabilities, got %d and %d", ab, bc)
+	}
+
+	text, err := gramCollection.BuildRandomText(10, 2)
+	if err != nil || !strings.HasSuffix("a b c", text) {
+		t.Errorf("Expected to generate from the imported grams, got %q, %v", text, err)
+	}
+
+	if err := m.AddTo(learnedCollection(sampleText, 3)); err == nil {
+		t.Error("Expected grams of a different size to be refused")
+	}
+}
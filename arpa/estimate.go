@@ -0,0 +1,174 @@
+package arpa
+
+import (
+	"github.com/fergloragain/trigrams/gram"
+	"github.com/pkg/errors"
+	"math"
+	"strings"
+)
+
+// The smoothing methods a model can be estimated with. Both are interpolated: every n-gram's probability mixes its own
+// discounted estimate with that of the next order down, and the mass held back from the n-grams seen after a history
+// becomes the history's backoff weight.
+const (
+	WittenBell = "witten-bell" // holds back mass in proportion to the number of distinct words seen after a history
+	Absolute   = "absolute"    // subtracts a fixed discount from every count, estimated separately for each order
+)
+
+// Smoothings lists the smoothing methods available
+var Smoothings = map[string]bool{
+	WittenBell: true,
+	Absolute:   true,
+}
+
+var (
+	ErrUnknownSmoothing = errors.New("Smoothing must be witten-bell or absolute")
+	ErrNothingLearned   = errors.New("Nothing has been learned to estimate a model from")
+)
+
+// history is the total count of the n-grams following a history, and how many distinct words follow it
+type history struct {
+	count int
+	types int
+}
+
+// Estimate estimates a model from a collection, with n-grams of every order up to the collection's gram size.
+//
+// Only full size grams are learned, so the counts of shorter n-grams are found from them. An n-gram in the middle of a
+// text turns up at every position of the grams overlapping it, the same number of times at each; one at either end of
+// a text turns up at fewer positions. The count of a shorter n-gram is the most times it turns up at any one position.
+func Estimate(gramCollection *gram.GramCollection, smoothing string) (*Model, error) {
+	if smoothing == "" {
+		smoothing = WittenBell
+	}
+
+	if !Smoothings[smoothing] {
+		return nil, ErrUnknownSmoothing
+	}
+
+	order := gramCollection.GramSize()
+	if order == 0 {
+		return nil, ErrNothingLearned
+	}
+
+	counts := make([]map[string]int, order)
+	counts[order-1] = map[string]int{}
+
+	// positional[k-1][i] counts the n-grams of order k at position i of the learned grams
+	positional := make([][]map[string]int, order-1)
+
+	for k := 1; k < order; k++ {
+		for i := 0; i <= order-k; i++ {
+			positional[k-1] = append(positional[k-1], map[string]int{})
+		}
+	}
+
+	gramCollection.Each(func(words []string, frequency int) {
+		if frequency <= 0 {
+			return
+		}
+
+		counts[order-1][strings.Join(words, " ")] += frequency
+
+		for k := 1; k < order; k++ {
+			for i := 0; i <= order-k; i++ {
+				positional[k-1][i][strings.Join(words[i:i+k], " ")] += frequency
+			}
+		}
+	})
+
+	if len(counts[order-1]) == 0 {
+		return nil, ErrNothingLearned
+	}
+
+	for k := 1; k < order; k++ {
+		counts[k-1] = map[string]int{}
+
+		for _, positionCounts := range positional[k-1] {
+			for key, count := range positionCounts {
+				if count > counts[k-1][key] {
+					counts[k-1][key] = count
+				}
+			}
+		}
+	}
+
+	m := newModel(order)
+
+	for k := 1; k <= order; k++ {
+		histories := map[string]*history{}
+
+		for key, count := range counts[k-1] {
+			h := historyOf(key)
+
+			if histories[h] == nil {
+				histories[h] = &history{}
+			}
+
+			histories[h].count += count
+			histories[h].types++
+		}
+
+		discount := absoluteDiscount(counts[k-1])
+
+		for key, count := range counts[k-1] {
+			h := histories[historyOf(key)]
+
+			var discounted, heldBack float64
+
+			switch smoothing {
+			case WittenBell:
+				discounted = float64(count) / float64(h.count+h.types)
+				heldBack = float64(h.types) / float64(h.count+h.types)
+			case Absolute:
+				discounted = math.Max(float64(count)-discount, 0) / float64(h.count)
+				heldBack = discount * float64(h.types) / float64(h.count)
+			}
+
+			// unigrams are interpolated with a uniform distribution over the vocabulary
+			lower := 1 / float64(len(counts[0]))
+
+			if k > 1 {
+				lower = math.Pow(10, m.LogProb(strings.Split(key, " ")[1:]))
+			}
+
+			m.grams[k-1][key] = &entry{prob: math.Log10(discounted + heldBack*lower)}
+
+			if k > 1 {
+				m.grams[k-2][historyOf(key)].backoff = math.Log10(heldBack)
+			}
+		}
+	}
+
+	return m, nil
+}
+
+// historyOf returns all but the last word of an n-gram
+func historyOf(key string) string {
+	if i := strings.LastIndexByte(key, ' '); i > -1 {
+		return key[:i]
+	}
+
+	return ""
+}
+
+// absoluteDiscount estimates the discount for the n-grams of one order from the number seen once and twice, as
+// n1 / (n1 + 2 n2), falling back to 0.5 when too few n-grams are seen once or twice to estimate it
+func absoluteDiscount(counts map[string]int) float64 {
+	n1, n2 := 0, 0
+
+	for _, count := range counts {
+		switch count {
+		case 1:
+			n1++
+		case 2:
+			n2++
+		}
+	}
+
+	if n1 == 0 || n2 == 0 {
+		return 0.5
+	}
+
+	return float64(n1) / float64(n1+2*n2)
+}
@@ -0,0 +1,112 @@
+package arpa
+
+import (
+	"github.com/fergloragain/trigrams/gram"
+	"math"
+	"strings"
+	"testing"
+)
+
+func learnedCollection(text string, gramSize int) *gram.GramCollection {
+	gramCollection := gram.NewCollection()
+	words := strings.Fields(text)
+	counts := map[string]int{}
+
+	for i := 0; i+gramSize <= len(words); i++ {
+		counts[strings.Join(words[i:i+gramSize], " ")]++
+	}
+
+	gramCollection.AddGrams(counts)
+
+	return gramCollection
+}
+
+const sampleText = "the cat sat on the mat and the cat ran off the mat while the dog sat on the cat and the dog ran"
+
+func TestEstimate_Normalised(t *testing.T) {
+	for _, smoothing := range []string{WittenBell, Absolute} {
+		for gramSize := 1; gramSize <= 3; gramSize++ {
+			m, err := Estimate(learnedCollection(sampleText, gramSize), smoothing)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if m.Order != gramSize {
+				t.Fatalf("Expected a model of order %d, got %d", gramSize, m.Order)
+			}
+
+			vocabulary := m.sortedKeys(1)
+
+			// every history seen, including none at all, gives a distribution over the vocabulary, once backing off is
+			// taken into account
+			histories := map[string]bool{"": true}
+
+			for order := 2; order <= m.Order; order++ {
+				for key := range m.grams[order-1] {
+					histories[historyOf(key)] = true
+				}
+			}
+
+			for h := range histories {
+				total := 0.0
+
+				for _, word := range vocabulary {
+					total += math.Pow(10, m.LogProb(append(strings.Fields(h), word)))
+				}
+
+				if math.Abs(total-1) > 1e-9 {
+					t.Errorf("%s, gram size %d: expected the probabilities following %q to total 1, got %f", smoothing, gramSize, h, total)
+				}
+			}
+		}
+	}
+}
+
+func TestEstimate_Counts(t *testing.T) {
+	m, err := Estimate(learnedCollection(sampleText, 3), WittenBell)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every word, and every pair of words, of the text is in the model, including those only at either end of it
+	words := strings.Fields(sampleText)
+
+	for i := range words {
+		if m.grams[0][words[i]] == nil {
+			t.Errorf("Expected the unigram %q", words[i])
+		}
+
+		if i > 0 && m.grams[1][words[i-1]+" "+words[i]] == nil {
+			t.Errorf("Expected the bigram %q", words[i-1]+" "+words[i])
+		}
+	}
+
+	if m.Len(1) != 10 || m.Len(3) != 21 {
+		t.Errorf("Expected 10 unigrams and 21 trigrams, got %d and %d", m.Len(1), m.Len(3))
+	}
+
+	// "the cat" is followed by "sat", "ran" and "and", so it's more likely to be followed by "sat" than "the dog" is
+	if m.LogProb([]string{"the", "cat", "sat"}) <= m.LogProb([]string{"the", "dog", "sat"})-1 {
+		t.Error("Expected \"sat\" to be likely after \"the cat\"")
+	}
+}
+
+func TestEstimate_Errors(t *testing.T) {
+	if _, err := Estimate(gram.NewCollection(), WittenBell); err != ErrNothingLearned {
+		t.Errorf("Expected an empty collection to be refused, got %v", err)
+	}
+
+	if _, err := Estimate(learnedCollection(sampleText, 3), "good-turing"); err != ErrUnknownSmoothing {
+		t.Errorf("Expected an unknown smoothing method to be refused, got %v", err)
+	}
+}
+
+func TestAbsoluteDiscount(t *testing.T) {
+	if d := absoluteDiscount(map[string]int{"a": 1, "b": 1, "c": 2, "d": 5}); d != 0.5 {
+		t.Errorf("Expected a discount of 2 / (2 + 2), got %f", d)
+	}
+
+	if d := absoluteDiscount(map[string]int{"a": 3}); d != 0.5 {
+		t.Errorf("Expected the fallback discount, got %f", d)
+	}
+}
@@ -0,0 +1,64 @@
+package arpa
+
+import (
+	"github.com/fergloragain/trigrams/gram"
+	"github.com/julienschmidt/httprouter"
+	"log"
+	"net/http"
+)
+
+// ExportHandler writes a model estimated from the collection in ARPA format, smoothed with the method given by the
+// smoothing parameter, Witten-Bell by default
+func ExportHandler(gramCollection *gram.GramCollection) func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+
+	return func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+		m, err := Estimate(gramCollection, request.URL.Query().Get("smoothing"))
+
+		switch err {
+		case nil:
+		case ErrUnknownSmoothing:
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		case ErrNothingLearned:
+			http.Error(writer, err.Error(), http.StatusNotFound)
+			return
+		default:
+			log.Printf("Error estimating model: %s", err.Error())
+			writer.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+		if err := m.Write(writer); err != nil {
+			log.Printf("Error writing model: %s", err.Error())
+		}
+	}
+
+}
+
+// ImportHandler reads a model in ARPA format from the request body, and adds its highest order n-grams to the
+// collection; see Model.AddTo. The model's order must match the gram size the server learns.
+func ImportHandler(gramCollection *gram.GramCollection, gramSize int) func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+
+	return func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+		m, err := Read(request.Body)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if m.Order != gramSize {
+			http.Error(writer, "The model's order must match the gram size", http.StatusBadRequest)
+			return
+		}
+
+		if err := m.AddTo(gramCollection); err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		gram.WriteJSON(writer, http.StatusOK, map[string]int{"grams": m.Len(m.Order)})
+	}
+
+}
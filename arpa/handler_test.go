@@ -0,0 +1,77 @@
+package arpa
+
+import (
+	"encoding/json"
+	"github.com/fergloragain/trigrams/gram"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExportHandler(t *testing.T) {
+	handler := ExportHandler(learnedCollection(sampleText, 3))
+
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(http.MethodGet, "/arpa?smoothing=absolute", nil), nil)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", recorder.Code)
+	}
+
+	m, err := Read(recorder.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Order != 3 || m.Len(3) != 21 {
+		t.Errorf("Expected 21 trigrams, got %d of order %d", m.Len(m.Order), m.Order)
+	}
+
+	tt := map[string]int{
+		"/arpa?smoothing=good-turing": http.StatusBadRequest,
+	}
+
+	for target, code := range tt {
+		recorder := httptest.NewRecorder()
+		handler(recorder, httptest.NewRequest(http.MethodGet, target, nil), nil)
+
+		if recorder.Code != code {
+			t.Errorf("Expected %d for %s, got %d", code, target, recorder.Code)
+		}
+	}
+
+	recorder = httptest.NewRecorder()
+	ExportHandler(gram.NewCollection())(recorder, httptest.NewRequest(http.MethodGet, "/arpa", nil), nil)
+
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected nothing to export, got %d", recorder.Code)
+	}
+}
+
+func TestImportHandler(t *testing.T) {
+	gramCollection := gram.NewCollection()
+	handler := ImportHandler(gramCollection, 2)
+
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(http.MethodPost, "/arpa", strings.NewReader(smallModel)), nil)
+
+	var result map[string]int
+
+	if err := json.NewDecoder(recorder.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+
+	if recorder.Code != http.StatusOK || result["grams"] != 2 || gramCollection.Len() != 2 {
+		t.Errorf("Expected 2 grams to be imported, got %d %v", recorder.Code, result)
+	}
+
+	for name, body := range map[string]string{"invalid": "nonsense", "wrong order": strings.Replace(smallModel, "ngram 2=2", "ngram 2=2\nngram 3=0", 1)} {
+		recorder := httptest.NewRecorder()
+		handler(recorder, httptest.NewRequest(http.MethodPost, "/arpa", strings.NewReader(body)), nil)
+
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", name, recorder.Code)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/fergloragain/trigrams/arpa"
+	"github.com/fergloragain/trigrams/gram"
+	"github.com/pkg/errors"
+	"io"
+	"log"
+	"os"
+)
+
+// runCommand runs one of the command line tools, given the arguments following the program name
+func runCommand(args []string) error {
+	switch args[0] {
+	case "compile":
+		return compile(args[1:])
+	case "export-arpa":
+		return exportARPA(args[1:])
+	case "import-arpa":
+		return importARPA(args[1:])
+	case "score":
+		return score(args[1:])
+	}
+
+	return fmt.Errorf("Unknown command %q", args[0])
+}
+
+// compile compiles a snapshot written by the server into a model the server can memory map. When the server was
+// itself running over a compiled model, its snapshot holds only what was learned since, and passing that model as the
+// base folds the two together.
+func compile(args []string) error {
+	if len(args) < 2 || len(args) > 3 {
+		return errors.New("Usage: trigrams compile <snapshot> <compiled model> [<base compiled model>]")
+	}
+
+	gramCollection := gram.NewCollection()
+
+	if len(args) == 3 {
+		base, err := gram.OpenCompiled(args[2])
+		if err != nil {
+			return err
+		}
+
+		defer base.Close()
+
+		gramCollection = gram.NewLayeredCollection(base)
+	}
+
+	if err := loadSnapshot(gramCollection, args[0]); err != nil {
+		return err
+	}
+
+	if err := gramCollection.CompileFile(args[1]); err != nil {
+		return err
+	}
+
+	log.Printf("Compiled %d grams from %s to %s", gramCollection.Len(), args[0], args[1])
+
+	return nil
+}
+
+// exportARPA estimates a model from a snapshot and writes it in ARPA format
+func exportARPA(args []string) error {
+	if len(args) < 2 || len(args) > 3 {
+		return errors.New("Usage: trigrams export-arpa <snapshot> <ARPA model> [witten-bell|absolute]")
+	}
+
+	gramCollection := gram.NewCollection()
+
+	if err := loadSnapshot(gramCollection, args[0]); err != nil {
+		return err
+	}
+
+	smoothing := arpa.WittenBell
+
+	if len(args) == 3 {
+		smoothing = args[2]
+	}
+
+	m, err := arpa.Estimate(gramCollection, smoothing)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(args[1])
+	if err != nil {
+		return err
+	}
+
+	if err := m.Write(file); err != nil {
+		file.Close()
+		return err
+	}
+
+	log.Printf("Exported %d grams from %s to %s", gramCollection.Len(), args[0], args[1])
+
+	return file.Close()
+}
+
+// importARPA adds the highest order n-grams of an ARPA model to a snapshot, creating the snapshot if need be
+func importARPA(args []string) error {
+	if len(args) != 2 {
+		return errors.New("Usage: trigrams import-arpa <ARPA model> <snapshot>")
+	}
+
+	m, err := readARPA(args[0])
+	if err != nil {
+		return err
+	}
+
+	gramCollection := gram.NewCollection()
+
+	if err := gramCollection.LoadFile(args[1]); err != nil {
+		return err
+	}
+
+	if err := m.AddTo(gramCollection); err != nil {
+		return err
+	}
+
+	log.Printf("Imported %d grams from %s to %s", m.Len(m.Order), args[0], args[1])
+
+	return gramCollection.SaveFile(args[1])
+}
+
+// score scores the text of a file, or of standard input, with an ARPA model, writing the score as JSON
+func score(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errors.New("Usage: trigrams score <ARPA model> [<text>]")
+	}
+
+	m, err := readARPA(args[0])
+	if err != nil {
+		return err
+	}
+
+	var text io.Reader = os.Stdin
+
+	if len(args) == 2 {
+		file, err := os.Open(args[1])
+		if err != nil {
+			return err
+		}
+
+		defer file.Close()
+
+		text = file
+	}
+
+	words := []string{}
+	scanner := bufio.NewScanner(text)
+	scanner.Split(bufio.ScanWords)
+
+	for scanner.Scan() {
+		words = append(words, scanner.Text())
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return json.NewEncoder(os.Stdout).Encode(m.Score(words))
+}
+
+func readARPA(path string) (*arpa.Model, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	return arpa.Read(file)
+}
+
+// loadSnapshot loads a snapshot which must exist, unlike the server's snapshot, which is created the first time the
+// server shuts down
+func loadSnapshot(gramCollection *gram.GramCollection, path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+
+	return gramCollection.LoadFile(path)
+}
@@ -1,41 +1,50 @@
 package generate
 
+import (
+	"context"
+	"github.com/fergloragain/trigrams/pool"
+)
+
 type GenerationDispatcher struct {
 	maxWorkers int
-	WorkerPool chan chan Task
+	queueSize  int
+	pool       *pool.Pool[Task, string]
+}
+
+// Create a generation dispatcher, specifying a number of workers to process generation tasks and the number of tasks
+// that may wait in the queue for a free worker
+func NewDispatcher(maxWorkers, maxQueue int) *GenerationDispatcher {
+	return &GenerationDispatcher{maxWorkers: maxWorkers, queueSize: maxQueue}
 }
 
-// Create a generation dispatcher, specifying a number of workers to read from the queue of generation tasks
-func NewDispatcher(maxWorkers int) *GenerationDispatcher {
-	pool := make(chan chan Task, maxWorkers)
-	return &GenerationDispatcher{WorkerPool: pool, maxWorkers: maxWorkers}
+// Run the generation dispatcher by starting a pool of workers, each of which generates at most max words from grams of
+// the given size
+func (dispatcher *GenerationDispatcher) Run(max, gramSize int) {
+	dispatcher.pool = pool.New(dispatcher.maxWorkers, dispatcher.queueSize, func(task Task) (string, error) {
+		return task.Process(max, gramSize)
+	})
+
+	dispatcher.pool.Start()
 }
 
-// Run the generation dispatcher by launching each worker and then listening to the generation queue
-func (dispatcher *GenerationDispatcher) Run(generationQueue chan Task, max, gramSize int) {
-	for i := 0; i < dispatcher.maxWorkers; i++ {
-		worker := NewGenerationWorker(dispatcher.WorkerPool)
-		worker.Start(max, gramSize)
-	}
+// Generate queues a generation task, blocking while the queue is full, and waits for a worker to produce the random
+// text
+func (dispatcher *GenerationDispatcher) Generate(task Task) (string, error) {
+	return dispatcher.pool.Do(task)
+}
+
+// Resize changes the number of workers processing generation tasks
+func (dispatcher *GenerationDispatcher) Resize(workers int) {
+	dispatcher.pool.Resize(workers)
+}
 
-	go dispatcher.dispatch(generationQueue)
+// Stats reports the size and activity of the worker pool
+func (dispatcher *GenerationDispatcher) Stats() pool.Stats {
+	return dispatcher.pool.Stats()
 }
 
-// listen to the generation queue and once a generation request comes in, retrieve a worker from the worker pool and
-// hand the request off to the worker for processing
-func (dispatcher *GenerationDispatcher) dispatch(generationQueue chan Task) {
-	for {
-
-		select {
-		// listen for a generation request
-		case generationRequest := <-generationQueue:
-			go func(generationRequest Task) {
-				// obtain a worker from the worker pool
-				generationChannel := <-dispatcher.WorkerPool
-
-				// dispatch the job to the worker job channel
-				generationChannel <- generationRequest
-			}(generationRequest)
-		}
-	}
+// Stop stops accepting generation tasks and waits for the workers to finish everything already queued. If ctx expires
+// first, the context error is returned.
+func (dispatcher *GenerationDispatcher) Stop(ctx context.Context) error {
+	return dispatcher.pool.Stop(ctx)
 }
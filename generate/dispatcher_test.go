@@ -1,48 +1,85 @@
 package generate
 
 import (
-	"fmt"
+	"context"
 	"github.com/fergloragain/trigrams/gram"
 	"testing"
+	"time"
 )
 
 func TestNewDispatcher(t *testing.T) {
-	d := NewDispatcher(1)
+	d := NewDispatcher(1, 2)
 
-	if d.WorkerPool == nil {
+	if d.maxWorkers != 1 {
 		t.Fail()
 	}
 
-	if d.maxWorkers != 1 {
+	if d.queueSize != 2 {
 		t.Fail()
 	}
 }
 
 func TestRun(t *testing.T) {
-	d := NewDispatcher(1)
+	d := NewDispatcher(1, 1)
 
-	if d.WorkerPool == nil {
-		t.Fail()
+	d.Run(1, 3)
+
+	if d.pool == nil {
+		t.Fatal("Expected Run to start a worker pool")
 	}
 
-	if d.maxWorkers != 1 {
-		t.Fail()
+	gc := gram.NewCollection()
+	gc.AddGram([]string{"this", "is", "cool"})
+
+	x, err := d.Generate(Task{
+		Writer: nil,
+		Gram:   gc,
+	})
+
+	if err != nil {
+		t.Error(err)
 	}
 
-	learnQueue := make(chan Task)
+	if x != "this is cool" {
+		t.Errorf("Expected >this is cool<, got >%s<", x)
+	}
+}
 
-	go d.Run(learnQueue, 1, 3)
+func TestDispatcherStop(t *testing.T) {
+	d := NewDispatcher(2, 2)
 
-	o := make(chan string)
+	d.Run(1, 3)
 
-	learnQueue <- Task{
-		Writer: nil,
-		Gram:   gram.NewCollection(),
-		Output: o,
+	done := make(chan error, 2)
+
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := d.Generate(Task{
+				Gram: gram.NewCollection(),
+			})
+			done <- err
+		}()
 	}
 
-	x := <-o
+	for d.Stats().Submitted != 2 {
+		time.Sleep(time.Millisecond)
+	}
 
-	fmt.Println(x)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
 
+	if err := d.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if d.Stats().Completed != 2 {
+		t.Error("Expected queued tasks to be processed")
+	}
+
+	// generating from an empty collection reports an error rather than hanging
+	for i := 0; i < 2; i++ {
+		if err := <-done; err == nil {
+			t.Error("Expected an error generating from an empty collection")
+		}
+	}
 }
@@ -1,69 +1,22 @@
 package generate
 
 import (
+	"encoding/json"
 	"github.com/fergloragain/trigrams/gram"
-	"log"
 	"net/http"
 )
 
 type Task struct {
-	Writer http.ResponseWriter
-	Gram   *gram.GramCollection
-	Output chan string
+	Writer     http.ResponseWriter
+	Gram       *gram.GramCollection
+	Provenance bool // optional; when set, the text is returned as JSON, with the documents each word came from
 }
 
-type GenerationWorker struct {
-	WorkerPool        chan chan Task
-	GenerationChannel chan Task
-	quit              chan bool
-}
-
-func NewGenerationWorker(workerPool chan chan Task) GenerationWorker {
-	return GenerationWorker{
-		WorkerPool:        workerPool,
-		GenerationChannel: make(chan Task),
-		quit:              make(chan bool),
+func (task *Task) Process(max, gramSize int) (string, error) {
+	if task.Provenance {
+		return task.sourced(max, gramSize)
 	}
-}
-
-// start the generation worker, specifying the maximum number of words to be generated, and the size of the ngram we are
-// working with
-func (w GenerationWorker) Start(maxWords, gramSize int) {
-	go func() {
-		for {
-			// the worker registers itself into the pool of workers
-			w.WorkerPool <- w.GenerationChannel
-
-			select {
-			// the worker listens for a generationTask request
-			case generationTask := <-w.GenerationChannel:
-
-				// process the generationTask request
-				randomText, err := generationTask.Process(maxWords, gramSize)
-
-				if err != nil {
-					log.Printf("Error generating text: %s", err.Error())
-				}
-
-				// write the random text to the output channel
-				generationTask.Output <- randomText
-
-			case <-w.quit:
-				// we have received a signal to stop
-				return
-			}
-		}
-	}()
-}
 
-// Stop signals the worker to stop listening for work requests.
-func (w GenerationWorker) Stop() {
-	go func() {
-		w.quit <- true
-	}()
-}
-
-func (task *Task) Process(max, gramSize int) (string, error) {
 	// build random text based on the grams that have been learned
 	randomString, err := task.Gram.BuildRandomText(max, gramSize)
 
@@ -73,3 +26,19 @@ func (task *Task) Process(max, gramSize int) (string, error) {
 
 	return randomString, nil
 }
+
+// sourced builds random text annotated with the documents each word came from, encoded as JSON. If no text can be
+// built, the error is returned along with empty text, so that there's always JSON to respond with.
+func (task *Task) sourced(max, gramSize int) (string, error) {
+	text, err := task.Gram.BuildSourcedText(max, gramSize)
+	if err != nil {
+		text = gram.SourcedText{Words: []gram.SourcedWord{}}
+	}
+
+	encoded, encodeErr := json.Marshal(text)
+	if encodeErr != nil {
+		return "", encodeErr
+	}
+
+	return string(encoded), err
+}
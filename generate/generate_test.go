@@ -7,30 +7,10 @@ import (
 	"testing"
 )
 
-func TestStop(t *testing.T) {
-	workerPool := make(chan chan Task)
-	worker := NewGenerationWorker(workerPool)
-
-	generationChannel := make(chan Task)
-
-	worker.GenerationChannel = generationChannel
-
-	worker.Stop()
-
-	<-worker.quit
-}
-
 func TestFulfil(t *testing.T) {
 
 	gc1 := gram.NewCollection()
-	gc1.Grams = [][]string{
-		[]string{
-			"this", "is", "cool",
-		},
-	}
-	gc1.Indices = []int{0}
-	gc1.Frequencies = []int{1}
-	gc1.TotalFrequencies = 1
+	gc1.AddGram([]string{"this", "is", "cool"})
 
 	tt := []struct {
 		Task     Task
@@ -43,7 +23,6 @@ func TestFulfil(t *testing.T) {
 			Task: Task{
 				Writer: nil,
 				Gram:   gram.NewCollection(),
-				Output: nil,
 			},
 			Result:   "",
 			Error:    errors.New("No grams to fetch randomly"),
@@ -54,7 +33,6 @@ func TestFulfil(t *testing.T) {
 			Task: Task{
 				Writer: nil,
 				Gram:   gc1,
-				Output: nil,
 			},
 			Result:   "this is cool",
 			Error:    nil,
@@ -4,25 +4,32 @@ import (
 	"fmt"
 	"github.com/fergloragain/trigrams/gram"
 	"github.com/julienschmidt/httprouter"
+	"log"
 	"net/http"
 )
 
-func Handler(gram *gram.GramCollection, generationQueue chan Task) func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+func Handler(gram *gram.GramCollection, dispatcher *GenerationDispatcher) func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
 
 	return func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
-		output := make(chan string)
 
 		generationJob := Task{
 			Writer: writer,
 			Gram:   gram,
-			Output: output,
 		}
 
-		generationQueue <- generationJob
+		generationJob.Provenance = request.URL.Query().Get("provenance") == "true"
 
-		generatedText := <-output
+		generatedText, err := dispatcher.Generate(generationJob)
 
-		fmt.Fprintf(writer, generatedText)
+		if err != nil {
+			log.Printf("Error generating text: %s", err.Error())
+		}
+
+		if generationJob.Provenance {
+			writer.Header().Set("Content-Type", "application/json")
+		}
+
+		fmt.Fprint(writer, generatedText)
 	}
 
 }
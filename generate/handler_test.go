@@ -1,51 +1,59 @@
 package generate
 
 import (
+	"encoding/json"
 	"github.com/fergloragain/trigrams/gram"
-	"net/http"
+	"net/http/httptest"
+	"reflect"
 	"testing"
 )
 
-type TestWriter struct {
-	Result  string
-	Blocker chan int
-}
+func TestHandler(t *testing.T) {
+	gramCollection := gram.NewCollection()
+	gramCollection.AddGram([]string{"this", "is", "cool"})
 
-func (t *TestWriter) Header() http.Header {
-	return nil
-}
+	dispatcher := NewDispatcher(1, 1)
+	dispatcher.Run(100, 3)
 
-func (t *TestWriter) Write(b []byte) (int, error) {
-	t.Result = string(b)
-	t.Blocker <- 0
+	handler := Handler(gramCollection, dispatcher)
 
-	return 0, nil
-}
+	recorder := httptest.NewRecorder()
 
-func (t *TestWriter) WriteHeader(statusCode int) {
-	return
+	handler(recorder, httptest.NewRequest("GET", "/generate", nil), nil)
+
+	if recorder.Body.String() != "this is cool" {
+		t.Errorf("Expected %q, got %q", "this is cool", recorder.Body.String())
+	}
 }
 
-func TestHandler(t *testing.T) {
+func TestHandler_Provenance(t *testing.T) {
 	gramCollection := gram.NewCollection()
-	generationQueue := make(chan Task)
+	gramCollection.ProvenanceLimit = 1
+	gramCollection.AddDocumentGrams("doc", map[string]int{"this is cool": 1})
 
-	handler := Handler(gramCollection, generationQueue)
+	dispatcher := NewDispatcher(1, 1)
+	dispatcher.Run(100, 3)
 
-	testWriter := &TestWriter{}
-	testWriter.Blocker = make(chan int)
+	recorder := httptest.NewRecorder()
 
-	go handler(testWriter, nil, nil)
+	Handler(gramCollection, dispatcher)(recorder, httptest.NewRequest("GET", "/generate?provenance=true", nil), nil)
 
-	r := <-generationQueue
+	var text gram.SourcedText
 
-	go func() {
-		r.Output <- "TEST"
-	}()
+	if err := json.NewDecoder(recorder.Body).Decode(&text); err != nil {
+		t.Fatal(err)
+	}
 
-	<-testWriter.Blocker
+	expected := gram.SourcedText{
+		Text: "this is cool",
+		Words: []gram.SourcedWord{
+			{Word: "this", Documents: []string{"doc"}},
+			{Word: "is", Documents: []string{"doc"}},
+			{Word: "cool", Documents: []string{"doc"}},
+		},
+	}
 
-	if testWriter.Result != "TEST" {
-		t.Fail()
+	if !reflect.DeepEqual(text, expected) || recorder.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Expected %+v, got %+v", expected, text)
 	}
 }
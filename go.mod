@@ -1,6 +1,6 @@
 module github.com/fergloragain/trigrams
 
-go 1.15
+go 1.21
 
 require (
 	github.com/julienschmidt/httprouter v1.3.0
@@ -0,0 +1,235 @@
+package gram
+
+import (
+	"github.com/pkg/errors"
+	"math"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrGramSizeMismatch = errors.New("Collections of different gram sizes can't be combined")
+	ErrInvalidWeight    = errors.New("Weights must be positive")
+	ErrCompiledBase     = errors.New("Grams can't be removed from a collection layered over a compiled model")
+)
+
+// Weighted is a collection along with the weight its frequencies are multiplied by when it's merged with others
+type Weighted struct {
+	Collection *GramCollection
+	Weight     float64
+}
+
+// FrequencyChange is a gram whose frequency differs between two collections
+type FrequencyChange struct {
+	Gram   []string `json:"gram"`
+	A      int      `json:"a"`
+	B      int      `json:"b"`
+	Change int      `json:"change"` // B - A
+}
+
+// Diff is how two collections differ. Each list is limited in length, with the total number of grams that differ in
+// each way given alongside.
+type Diff struct {
+	OnlyInA      []GramCount       `json:"only_in_a"` // most frequent first
+	OnlyInB      []GramCount       `json:"only_in_b"`
+	Changed      []FrequencyChange `json:"changed"` // largest change, in either direction, first
+	OnlyInATotal int               `json:"only_in_a_total"`
+	OnlyInBTotal int               `json:"only_in_b_total"`
+	ChangedTotal int               `json:"changed_total"`
+}
+
+// Merge returns a new collection holding the grams of every source, with each gram's frequency the sum of its weighted
+// frequencies in the sources, rounded to the nearest whole number
+func Merge(sources ...Weighted) (*GramCollection, error) {
+	merged := NewCollection()
+
+	for _, source := range sources {
+		if err := merged.Add(source.Collection, source.Weight); err != nil {
+			return nil, err
+		}
+	}
+
+	return merged, nil
+}
+
+// Add adds the grams of other to the collection, with each frequency multiplied by weight and rounded to the nearest
+// whole number. Grams whose weighted frequency rounds to 0 aren't added.
+func (gramCollection *GramCollection) Add(other *GramCollection, weight float64) error {
+	counts, err := gramCollection.weightedCounts(other, weight)
+	if err != nil {
+		return err
+	}
+
+	gramCollection.AddGrams(counts)
+
+	return nil
+}
+
+// Subtract takes the grams of other away from the collection, with each frequency multiplied by weight and rounded to
+// the nearest whole number. No frequency goes below 0, and grams left without a positive frequency are removed, along
+// with any words no other gram uses. A compiled model can't be changed, so collections layered over one can't be
+// subtracted from.
+func (gramCollection *GramCollection) Subtract(other *GramCollection, weight float64) error {
+	counts, err := gramCollection.weightedCounts(other, weight)
+	if err != nil {
+		return err
+	}
+
+	gramCollection.RW.Lock()
+	defer gramCollection.RW.Unlock()
+
+	if gramCollection.base != nil {
+		return ErrCompiledBase
+	}
+
+	removed := false
+
+	for key, count := range counts {
+		if gramIndex := gramCollection.getIndex(strings.Split(key, " ")); gramIndex > -1 && gramCollection.reduce(gramIndex, count) {
+			removed = true
+		}
+	}
+
+	if removed {
+		gramCollection.compact()
+		gramCollection.publish()
+
+		return nil
+	}
+
+	gramCollection.changed()
+
+	return nil
+}
+
+// weightedCounts returns the weighted frequency of each gram of other, keyed by the gram's words joined by spaces,
+// checking first that its grams are the same size as the collection's
+func (gramCollection *GramCollection) weightedCounts(other *GramCollection, weight float64) (map[string]int, error) {
+	if weight <= 0 || math.IsInf(weight, 0) || math.IsNaN(weight) {
+		return nil, ErrInvalidWeight
+	}
+
+	if size, otherSize := gramCollection.GramSize(), other.GramSize(); size != 0 && otherSize != 0 && size != otherSize {
+		return nil, ErrGramSizeMismatch
+	}
+
+	counts := map[string]int{}
+
+	other.Each(func(gram []string, frequency int) {
+		if count := int(math.Round(float64(frequency) * weight)); count > 0 {
+			counts[strings.Join(gram, " ")] += count
+		}
+	})
+
+	return counts, nil
+}
+
+// compact rebuilds the collection without the grams left without a positive frequency, nor the words only they used.
+// Published models keep the arrays they were published with, which are never modified, so the collection's arrays are
+// replaced rather than changed in place. Compacting renumbers every word and gram, so the caller should publish a new
+// model straight away rather than leave generators on one that no longer matches the collection. It must be called
+// with the write lock held.
+func (gramCollection *GramCollection) compact() {
+	compacted := NewCollection()
+
+	if gramCollection.base != nil {
+		compacted = NewLayeredCollection(gramCollection.base)
+	}
+
+	compacted.grams.size = gramCollection.grams.size
+
+	remap := make([]int32, len(gramCollection.frequencies))
+
+	for gramIndex, frequency := range gramCollection.frequencies {
+		remap[gramIndex] = -1
+
+		if frequency > 0 {
+			remap[gramIndex] = int32(compacted.add(gramCollection.words(gramCollection.grams.gram(gramIndex)), frequency))
+		}
+	}
+
+	gramCollection.vocabulary = compacted.vocabulary
+	gramCollection.grams = compacted.grams
+	gramCollection.frequencies = compacted.frequencies
+	gramCollection.postings = compacted.postings
+	gramCollection.overlap = compacted.overlap
+
+	gramCollection.remapContributions(remap)
+	gramCollection.remapProvenance(remap)
+	gramCollection.remapWeights(remap)
+	gramCollection.touchAll()
+}
+
+// DiffCollections compares the grams of two collections, listing up to limit grams of each kind of difference
+func DiffCollections(a, b *GramCollection, limit int) (Diff, error) {
+	if sizeA, sizeB := a.GramSize(), b.GramSize(); sizeA != 0 && sizeB != 0 && sizeA != sizeB {
+		return Diff{}, ErrGramSizeMismatch
+	}
+
+	page := Page{Limit: limit}
+	page.normalise()
+
+	countsA := map[string]int{}
+
+	a.Each(func(gram []string, frequency int) {
+		if frequency > 0 {
+			countsA[strings.Join(gram, " ")] = frequency
+		}
+	})
+
+	diff := Diff{OnlyInA: []GramCount{}, OnlyInB: []GramCount{}, Changed: []FrequencyChange{}}
+
+	b.Each(func(gram []string, frequency int) {
+		if frequency <= 0 {
+			return
+		}
+
+		key := strings.Join(gram, " ")
+		frequencyA, ok := countsA[key]
+
+		switch {
+		case !ok:
+			diff.OnlyInB = append(diff.OnlyInB, GramCount{Gram: gram, Frequency: frequency})
+		case frequencyA != frequency:
+			diff.Changed = append(diff.Changed, FrequencyChange{Gram: gram, A: frequencyA, B: frequency, Change: frequency - frequencyA})
+		}
+
+		delete(countsA, key)
+	})
+
+	for key, frequency := range countsA {
+		diff.OnlyInA = append(diff.OnlyInA, GramCount{Gram: strings.Split(key, " "), Frequency: frequency})
+	}
+
+	sortGramCounts(diff.OnlyInA)
+	sortGramCounts(diff.OnlyInB)
+
+	sort.Slice(diff.Changed, func(i, j int) bool {
+		changeI, changeJ := diff.Changed[i].Change, diff.Changed[j].Change
+
+		if changeI*changeI != changeJ*changeJ {
+			return changeI*changeI > changeJ*changeJ
+		}
+
+		return strings.Join(diff.Changed[i].Gram, " ") < strings.Join(diff.Changed[j].Gram, " ")
+	})
+
+	diff.OnlyInATotal, diff.OnlyInBTotal, diff.ChangedTotal = len(diff.OnlyInA), len(diff.OnlyInB), len(diff.Changed)
+
+	diff.OnlyInA = diff.OnlyInA[:page.end(len(diff.OnlyInA))]
+	diff.OnlyInB = diff.OnlyInB[:page.end(len(diff.OnlyInB))]
+	diff.Changed = diff.Changed[:page.end(len(diff.Changed))]
+
+	return diff, nil
+}
+
+// sortGramCounts sorts grams by frequency, most frequent first, and alphabetically where frequencies are equal
+func sortGramCounts(grams []GramCount) {
+	sort.Slice(grams, func(i, j int) bool {
+		if grams[i].Frequency != grams[j].Frequency {
+			return grams[i].Frequency > grams[j].Frequency
+		}
+
+		return strings.Join(grams[i].Gram, " ") < strings.Join(grams[j].Gram, " ")
+	})
+}
@@ -0,0 +1,182 @@
+package gram
+
+import (
+	"encoding/json"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// counts returns the frequency of every gram of a collection, keyed by its words joined by spaces
+func counts(gramCollection *GramCollection) map[string]int {
+	counts := map[string]int{}
+
+	gramCollection.Each(func(gram []string, frequency int) {
+		counts[strings.Join(gram, " ")] = frequency
+	})
+
+	return counts
+}
+
+func collection(counts map[string]int) *GramCollection {
+	grams := NewCollection()
+	grams.AddGrams(counts)
+
+	return grams
+}
+
+func TestMerge(t *testing.T) {
+	a := collection(map[string]int{"the cat sat": 2, "the dog sat": 1})
+	b := collection(map[string]int{"the cat sat": 4, "a cat sat": 3})
+
+	merged, err := Merge(Weighted{a, 1}, Weighted{b, 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := map[string]int{"the cat sat": 4, "the dog sat": 1, "a cat sat": 2}; !reflect.DeepEqual(counts(merged), expected) {
+		t.Errorf("Expected %v, got %v", expected, counts(merged))
+	}
+
+	if merged.TotalFrequencies != 7 {
+		t.Errorf("Expected a total frequency of 7, got %d", merged.TotalFrequencies)
+	}
+
+	// the sources are left as they were
+	if a.TotalFrequencies != 3 || b.TotalFrequencies != 7 {
+		t.Errorf("Expected the sources to be unchanged, got totals %d and %d", a.TotalFrequencies, b.TotalFrequencies)
+	}
+
+	if _, err := Merge(Weighted{a, 1}, Weighted{collection(map[string]int{"the cat": 1}), 1}); err != ErrGramSizeMismatch {
+		t.Errorf("Expected collections of different gram sizes to be refused, got %v", err)
+	}
+
+	if _, err := Merge(Weighted{a, 0}); err != ErrInvalidWeight {
+		t.Errorf("Expected a weight of 0 to be refused, got %v", err)
+	}
+}
+
+func TestSubtract(t *testing.T) {
+	grams := collection(map[string]int{"the cat sat": 3, "the dog sat": 2, "a cat sat": 1})
+	boilerplate := collection(map[string]int{"the cat sat": 1, "the dog sat": 5, "a fish swam": 1})
+
+	before := grams.published.Load()
+
+	if err := grams.Subtract(boilerplate, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := map[string]int{"the cat sat": 2, "a cat sat": 1}; !reflect.DeepEqual(counts(grams), expected) {
+		t.Errorf("Expected %v, got %v", expected, counts(grams))
+	}
+
+	if grams.TotalFrequencies != 3 || grams.Len() != 2 {
+		t.Errorf("Expected 2 grams with a total frequency of 3, got %d with %d", grams.Len(), grams.TotalFrequencies)
+	}
+
+	// words only used by removed grams are dropped, and models published before are left as they were
+	if _, ok := grams.vocabulary.ids["dog"]; ok {
+		t.Error("Expected \"dog\" to be dropped from the vocabulary")
+	}
+
+	if before.total != 6 || len(before.words) != 5 || before.frequencies.len() != 3 {
+		t.Errorf("Expected the model published before subtracting to be unchanged")
+	}
+
+	// the collection can still be learned and generated from
+	grams.AddGram([]string{"the", "dog", "ran"})
+
+	if _, err := grams.BuildRandomText(10, 3); err != nil {
+		t.Error(err)
+	}
+
+	if err := grams.Subtract(collection(map[string]int{"the cat": 1}), 1); err != ErrGramSizeMismatch {
+		t.Errorf("Expected collections of different gram sizes to be refused, got %v", err)
+	}
+
+	layered := NewLayeredCollection(compileTestModel(t, map[string]int{"the cat sat": 3}))
+
+	if err := layered.Subtract(boilerplate, 1); err != ErrCompiledBase {
+		t.Errorf("Expected subtracting from a layered collection to be refused, got %v", err)
+	}
+}
+
+func TestDiffCollections(t *testing.T) {
+	a := collection(map[string]int{"the cat sat": 3, "the dog sat": 2, "a cat sat": 1, "cat sat down": 4})
+	b := collection(map[string]int{"the cat sat": 1, "the dog sat": 2, "a cat sat": 5, "sat the cat": 1})
+
+	diff, err := DiffCollections(a, b, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Diff{
+		OnlyInA:      []GramCount{{[]string{"cat", "sat", "down"}, 4}},
+		OnlyInB:      []GramCount{{[]string{"sat", "the", "cat"}, 1}},
+		Changed:      []FrequencyChange{{[]string{"a", "cat", "sat"}, 1, 5, 4}, {[]string{"the", "cat", "sat"}, 3, 1, -2}},
+		OnlyInATotal: 1,
+		OnlyInBTotal: 1,
+		ChangedTotal: 2,
+	}
+
+	if !reflect.DeepEqual(diff, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, diff)
+	}
+
+	if diff, _ := DiffCollections(a, b, 1); len(diff.Changed) != 1 || diff.ChangedTotal != 2 {
+		t.Errorf("Expected 1 of 2 changes, got %d of %d", len(diff.Changed), diff.ChangedTotal)
+	}
+
+	if _, err := DiffCollections(a, collection(map[string]int{"the cat": 1}), 0); err != ErrGramSizeMismatch {
+		t.Errorf("Expected collections of different gram sizes to be refused, got %v", err)
+	}
+}
+
+func TestCombineHandlers(t *testing.T) {
+	grams := collection(map[string]int{"the cat sat": 3, "the dog sat": 2})
+
+	router := httprouter.New()
+	router.Handle("POST", "/merge", MergeHandler(grams, 3))
+	router.Handle("POST", "/subtract", SubtractHandler(grams, 3))
+	router.Handle("POST", "/diff", DiffHandler(grams, 3))
+
+	post := func(target, body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, target, strings.NewReader(body)))
+
+		return recorder
+	}
+
+	if recorder := post("/merge?weight=2", "the cat sat\t1\na cat sat\t2\n"); recorder.Code != http.StatusOK {
+		t.Errorf("Unexpected response %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	if recorder := post("/subtract", "the dog sat\t2\n"); recorder.Code != http.StatusOK {
+		t.Errorf("Unexpected response %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	if expected := map[string]int{"the cat sat": 5, "a cat sat": 4}; !reflect.DeepEqual(counts(grams), expected) {
+		t.Errorf("Expected %v, got %v", expected, counts(grams))
+	}
+
+	recorder := post("/diff?format=json", `{"gram":["the","cat","sat"],"frequency":5}`+"\n")
+
+	var diff Diff
+
+	if err := json.NewDecoder(recorder.Body).Decode(&diff); err != nil {
+		t.Fatal(err)
+	}
+
+	if diff.OnlyInATotal != 1 || diff.OnlyInBTotal != 0 || diff.ChangedTotal != 0 {
+		t.Errorf("Unexpected diff %+v", diff)
+	}
+
+	for target, body := range map[string]string{"/merge?weight=x": "the cat sat\t1\n", "/merge?weight=-1": "the cat sat\t1\n", "/subtract": "the cat\t1\n", "/diff": "the cat\tx\n"} {
+		if recorder := post(target, body); recorder.Code != http.StatusBadRequest {
+			t.Errorf("Expected %s to be refused, got %d", target, recorder.Code)
+		}
+	}
+}
@@ -0,0 +1,537 @@
+package gram
+
+import (
+	"bufio"
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"unsafe"
+)
+
+// A compiled model is a read-only, on-disk form of a collection, laid out so that it can be memory mapped and generated
+// from directly, without first being decoded into the Go heap. After a fixed size header, the file holds, each section
+// starting on an 8 byte boundary:
+//
+//   - the byte offset of each word in the word blob, plus the blob's length, as uint64s
+//   - the word blob: every word of the vocabulary, sorted, back to back; a word's ID is its position in sorted order
+//   - the grams, as packed tuples of uint32 word IDs, sorted by ID
+//   - the running total of the grams' frequencies, as uint64s, from which any range of grams can be sampled
+//   - the index of the first gram starting with each distinct run of gramSize-1 words, plus the number of grams
+//
+// Everything is little endian.
+const (
+	compiledMagic      = "TRIGRAMC"
+	compiledVersion    = 1
+	compiledHeaderSize = 64
+)
+
+// ErrCompiledFormat is returned when a file isn't a compiled model this version can read
+var ErrCompiledFormat = errors.New("Not a compiled model")
+
+// Compiled is a compiled model, opened read-only. Generating from a collection layered over a compiled model reads the
+// grams straight from the mapped file.
+type Compiled struct {
+	data  []byte
+	unmap func() error
+
+	gramSize      int
+	total         int
+	wordOffsets   []uint64
+	wordBlob      []byte
+	ids           []uint32
+	cumulative    []uint64
+	prefixOffsets []uint64
+
+	// the grams containing each word are only indexed the first time they're searched for; see query.go
+	postingsOnce   sync.Once
+	postingOffsets []int // the grams containing word ID i are postingGrams[postingOffsets[i]:postingOffsets[i+1]]
+	postingGrams   []uint32
+}
+
+// OpenCompiled memory maps a compiled model written by CompileFile. The model must be closed once nothing uses it,
+// including any collection layered over it.
+func OpenCompiled(path string) (*Compiled, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	data, unmap, err := mapFile(file, int(info.Size()))
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := parseCompiled(data)
+	if err != nil {
+		unmap()
+		return nil, err
+	}
+
+	c.unmap = unmap
+
+	return c, nil
+}
+
+// Close unmaps the model. Nothing read from the model may be used afterwards.
+func (c *Compiled) Close() error {
+	if c.unmap == nil {
+		return nil
+	}
+
+	unmap := c.unmap
+	c.unmap = nil
+
+	return unmap()
+}
+
+// parseCompiled checks the header, offsets and gram order of a compiled model, and slices each section out of it
+// without copying
+func parseCompiled(data []byte) (*Compiled, error) {
+	var one uint16 = 1
+
+	// the sections are read in place, so the file's byte order must be the machine's
+	if *(*byte)(unsafe.Pointer(&one)) != 1 {
+		return nil, errors.New("Compiled models can only be read on little endian machines")
+	}
+
+	if len(data) < compiledHeaderSize || string(data[:8]) != compiledMagic {
+		return nil, ErrCompiledFormat
+	}
+
+	header := func(field int) uint64 {
+		return binary.LittleEndian.Uint64(data[8*field:])
+	}
+
+	if header(1) != compiledVersion {
+		return nil, ErrCompiledFormat
+	}
+
+	gramSize, words, grams, prefixes, wordBytes, total := header(2), header(3), header(4), header(5), header(6), header(7)
+
+	sections := []uint64{
+		8 * (words + 1),
+		align(wordBytes),
+		align(4 * grams * gramSize),
+		8 * grams,
+		8 * (prefixes + 1),
+	}
+
+	size := uint64(compiledHeaderSize)
+
+	for _, section := range sections {
+		size += section
+	}
+
+	if gramSize < 1 || gramSize > 1<<16 || grams > 1<<40 || words > 1<<32 || uint64(len(data)) != size {
+		return nil, ErrCompiledFormat
+	}
+
+	data = alignedBytes(data)
+	offset := uint64(compiledHeaderSize)
+
+	c := &Compiled{data: data, gramSize: int(gramSize), total: int(total)}
+
+	c.wordOffsets = uint64s(data[offset:], words+1)
+	offset += sections[0]
+
+	c.wordBlob = data[offset : offset+wordBytes]
+	offset += sections[1]
+
+	c.ids = uint32s(data[offset:], grams*gramSize)
+	offset += sections[2]
+
+	c.cumulative = uint64s(data[offset:], grams)
+	offset += sections[3]
+
+	c.prefixOffsets = uint64s(data[offset:], prefixes+1)
+
+	// every offset and ID is checked once up front, so that a truncated or corrupt file is refused here rather than
+	// reading out of range during generation
+	if !ascending(c.wordOffsets, wordBytes) || !ascending(c.cumulative, total) {
+		return nil, ErrCompiledFormat
+	}
+
+	for _, id := range c.ids {
+		if uint64(id) >= words {
+			return nil, ErrCompiledFormat
+		}
+	}
+
+	// find and prefixRange search the grams and prefix groups in order, so both must be exactly as Compile wrote them
+	if !c.grouped() {
+		return nil, ErrCompiledFormat
+	}
+
+	return c, nil
+}
+
+// ascending reports whether offsets never decrease, and end at last
+func ascending(offsets []uint64, last uint64) bool {
+	previous := uint64(0)
+
+	for _, offset := range offsets {
+		if offset < previous {
+			return false
+		}
+
+		previous = offset
+	}
+
+	return previous == last
+}
+
+// grouped reports whether the grams are sorted without repeats, and the prefix offsets start a group at exactly the
+// grams whose prefix differs from the gram before, ending with the number of grams
+func (c *Compiled) grouped() bool {
+	groups := len(c.prefixOffsets) - 1
+
+	if groups < 0 || c.prefixOffsets[groups] != uint64(c.Len()) {
+		return false
+	}
+
+	group := 0
+
+	for gramIndex := 0; gramIndex < c.Len(); gramIndex++ {
+		gram := c.gram(gramIndex)
+
+		if gramIndex > 0 {
+			previous := c.gram(gramIndex - 1)
+
+			if compareIDs(previous, gram) >= 0 {
+				return false
+			}
+
+			if compareIDs(previous[:c.gramSize-1], gram[:c.gramSize-1]) == 0 {
+				continue
+			}
+		}
+
+		if group == groups || c.prefixOffsets[group] != uint64(gramIndex) {
+			return false
+		}
+
+		group++
+	}
+
+	return group == groups
+}
+
+func align(n uint64) uint64 {
+	return (n + 7) &^ 7
+}
+
+// alignedBytes returns data, or a copy of it if it doesn't start on an 8 byte boundary. Mapped files always do; this
+// is for compiled models read into memory.
+func alignedBytes(data []byte) []byte {
+	if uintptr(unsafe.Pointer(unsafe.SliceData(data)))%8 == 0 {
+		return data
+	}
+
+	words := make([]uint64, (len(data)+7)/8)
+	aligned := unsafe.Slice((*byte)(unsafe.Pointer(unsafe.SliceData(words))), len(data))
+	copy(aligned, data)
+
+	return aligned
+}
+
+func uint64s(data []byte, n uint64) []uint64 {
+	if n == 0 {
+		return nil
+	}
+
+	return unsafe.Slice((*uint64)(unsafe.Pointer(&data[0])), n)
+}
+
+func uint32s(data []byte, n uint64) []uint32 {
+	if n == 0 {
+		return nil
+	}
+
+	return unsafe.Slice((*uint32)(unsafe.Pointer(&data[0])), n)
+}
+
+// GramSize returns the number of words in each gram of the model
+func (c *Compiled) GramSize() int {
+	return c.gramSize
+}
+
+// Len returns the number of distinct grams in the model
+func (c *Compiled) Len() int {
+	return len(c.cumulative)
+}
+
+// TotalFrequencies returns the total frequency of all grams in the model
+func (c *Compiled) TotalFrequencies() int {
+	return c.total
+}
+
+// words returns the number of words in the model's vocabulary
+func (c *Compiled) words() int {
+	return len(c.wordOffsets) - 1
+}
+
+// word returns the word with the given ID. The string refers directly to the mapped file.
+func (c *Compiled) word(id uint32) string {
+	start, end := c.wordOffsets[id], c.wordOffsets[id+1]
+
+	if start == end {
+		return ""
+	}
+
+	return unsafe.String(&c.wordBlob[start], end-start)
+}
+
+func (c *Compiled) gram(gramIndex int) []uint32 {
+	return c.ids[gramIndex*c.gramSize : (gramIndex+1)*c.gramSize : (gramIndex+1)*c.gramSize]
+}
+
+// frequency returns the frequency of the gram at the given index
+func (c *Compiled) frequency(gramIndex int) int {
+	return int(c.weight(gramIndex, gramIndex+1))
+}
+
+// weight returns the total frequency of the grams from lo up to hi
+func (c *Compiled) weight(lo, hi int) int {
+	if lo >= hi {
+		return 0
+	}
+
+	if lo == 0 {
+		return int(c.cumulative[hi-1])
+	}
+
+	return int(c.cumulative[hi-1] - c.cumulative[lo-1])
+}
+
+// pick returns the index of the gram from lo up to hi where the running total, counted from lo, first reaches r
+func (c *Compiled) pick(lo, hi, r int) int {
+	target := uint64(r)
+
+	if lo > 0 {
+		target += c.cumulative[lo-1]
+	}
+
+	return lo + sort.Search(hi-lo, func(i int) bool {
+		return c.cumulative[lo+i] >= target
+	})
+}
+
+// find returns the index of a gram, or -1 if the model doesn't hold it
+func (c *Compiled) find(ids []uint32) int {
+	if len(ids) != c.gramSize {
+		return -1
+	}
+
+	gramIndex := sort.Search(c.Len(), func(i int) bool {
+		return compareIDs(c.gram(i), ids) >= 0
+	})
+
+	if gramIndex < c.Len() && compareIDs(c.gram(gramIndex), ids) == 0 {
+		return gramIndex
+	}
+
+	return -1
+}
+
+// prefixRange returns the range of grams starting with the given words, which is empty if there are none
+func (c *Compiled) prefixRange(prefix []uint32) (int, int) {
+	groups := len(c.prefixOffsets) - 1
+
+	group := sort.Search(groups, func(i int) bool {
+		first := c.gram(int(c.prefixOffsets[i]))
+		return compareIDs(first[:len(first)-1], prefix) >= 0
+	})
+
+	if group == groups {
+		return 0, 0
+	}
+
+	if first := c.gram(int(c.prefixOffsets[group])); compareIDs(first[:len(first)-1], prefix) != 0 {
+		return 0, 0
+	}
+
+	return int(c.prefixOffsets[group]), int(c.prefixOffsets[group+1])
+}
+
+func compareIDs(a, b []uint32) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+
+			return 1
+		}
+	}
+
+	return len(a) - len(b)
+}
+
+// Compile writes the collection, including any compiled model it's layered over, as a compiled model. Grams which have
+// no positive frequency are left out.
+func (gramCollection *GramCollection) Compile(w io.Writer) error {
+	gramCollection.RW.RLock()
+
+	words := gramCollection.vocabulary.words
+	size := gramCollection.grams.size
+
+	if size == 0 {
+		gramCollection.RW.RUnlock()
+		return errors.New("Nothing has been learned to compile")
+	}
+
+	// a word's compiled ID is its position in sorted order
+	order := make([]uint32, len(words))
+
+	for i := range order {
+		order[i] = uint32(i)
+	}
+
+	sort.Slice(order, func(i, j int) bool {
+		return words[order[i]] < words[order[j]]
+	})
+
+	remap := make([]uint32, len(words))
+
+	for compiledID, id := range order {
+		remap[id] = uint32(compiledID)
+	}
+
+	ids := []uint32{}
+	frequencies := []int{}
+
+	gramCollection.eachIDs(func(gram []uint32, frequency int) {
+		if frequency <= 0 {
+			return
+		}
+
+		for _, id := range gram {
+			ids = append(ids, remap[id])
+		}
+
+		frequencies = append(frequencies, frequency)
+	})
+
+	gramCollection.RW.RUnlock()
+
+	grams := make([]int, len(frequencies))
+
+	for i := range grams {
+		grams[i] = i
+	}
+
+	sort.Slice(grams, func(i, j int) bool {
+		return compareIDs(ids[grams[i]*size:(grams[i]+1)*size], ids[grams[j]*size:(grams[j]+1)*size]) < 0
+	})
+
+	sortedIDs := make([]uint32, 0, len(ids))
+	cumulative := make([]uint64, 0, len(grams))
+	prefixOffsets := []uint64{}
+	total := uint64(0)
+
+	for i, gramIndex := range grams {
+		gram := ids[gramIndex*size : (gramIndex+1)*size]
+
+		if i == 0 || compareIDs(gram[:size-1], sortedIDs[len(sortedIDs)-size:len(sortedIDs)-1]) != 0 {
+			prefixOffsets = append(prefixOffsets, uint64(i))
+		}
+
+		sortedIDs = append(sortedIDs, gram...)
+		total += uint64(frequencies[gramIndex])
+		cumulative = append(cumulative, total)
+	}
+
+	prefixOffsets = append(prefixOffsets, uint64(len(grams)))
+
+	wordOffsets := make([]uint64, 0, len(words)+1)
+	wordBytes := uint64(0)
+
+	for _, id := range order {
+		wordOffsets = append(wordOffsets, wordBytes)
+		wordBytes += uint64(len(words[id]))
+	}
+
+	wordOffsets = append(wordOffsets, wordBytes)
+
+	out := bufio.NewWriter(w)
+	written := uint64(0)
+
+	write := func(p []byte) {
+		n, _ := out.Write(p)
+		written += uint64(n)
+	}
+
+	pad := func() {
+		write(make([]byte, align(written)-written))
+	}
+
+	header := make([]byte, compiledHeaderSize)
+	copy(header, compiledMagic)
+
+	for field, value := range []uint64{compiledVersion, uint64(size), uint64(len(words)), uint64(len(grams)), uint64(len(prefixOffsets) - 1), wordBytes, total} {
+		binary.LittleEndian.PutUint64(header[8*(field+1):], value)
+	}
+
+	write(header)
+
+	buf := make([]byte, 8)
+
+	writeUint64s := func(values []uint64) {
+		for _, value := range values {
+			binary.LittleEndian.PutUint64(buf, value)
+			write(buf)
+		}
+	}
+
+	writeUint64s(wordOffsets)
+
+	for _, id := range order {
+		write([]byte(words[id]))
+	}
+
+	pad()
+
+	for _, id := range sortedIDs {
+		binary.LittleEndian.PutUint32(buf, id)
+		write(buf[:4])
+	}
+
+	pad()
+	writeUint64s(cumulative)
+	writeUint64s(prefixOffsets)
+
+	return out.Flush()
+}
+
+// CompileFile writes the collection as a compiled model to path, by way of a temporary file, as SaveFile does
+func (gramCollection *GramCollection) CompileFile(path string) error {
+	tmp := path + ".tmp"
+
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	if err := gramCollection.Compile(file); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
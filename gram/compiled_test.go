@@ -0,0 +1,299 @@
+package gram
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// compileTestModel compiles a collection holding the given grams, and opens it memory mapped
+func compileTestModel(t *testing.T, counts map[string]int) *Compiled {
+	t.Helper()
+
+	grams := NewCollection()
+	grams.AddGrams(counts)
+
+	path := filepath.Join(t.TempDir(), "model.bin")
+
+	if err := grams.CompileFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	base, err := OpenCompiled(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		base.Close()
+	})
+
+	return base
+}
+
+func TestCompiled(t *testing.T) {
+	counts := map[string]int{"b c d": 2, "a b c": 3, "a b d": 1, "c d e": 4}
+
+	base := compileTestModel(t, counts)
+
+	if base.GramSize() != 3 || base.Len() != 4 || base.TotalFrequencies() != 10 || base.words() != 5 {
+		t.Fatalf("Expected 4 grams of 3 of 5 words with total frequency 10, got %d grams of %d of %d words with total frequency %d", base.Len(), base.GramSize(), base.words(), base.TotalFrequencies())
+	}
+
+	// words and grams are sorted
+	for id := 1; id < base.words(); id++ {
+		if base.word(uint32(id-1)) >= base.word(uint32(id)) {
+			t.Errorf("Expected sorted words, got %q before %q", base.word(uint32(id-1)), base.word(uint32(id)))
+		}
+	}
+
+	for gramIndex := 1; gramIndex < base.Len(); gramIndex++ {
+		if compareIDs(base.gram(gramIndex-1), base.gram(gramIndex)) >= 0 {
+			t.Errorf("Expected sorted grams, got %v before %v", base.gram(gramIndex-1), base.gram(gramIndex))
+		}
+	}
+
+	for gram, count := range counts {
+		ids := []uint32{}
+
+		for _, word := range strings.Fields(gram) {
+			ids = append(ids, uint32(word[0]-'a'))
+		}
+
+		if gramIndex := base.find(ids); gramIndex < 0 || base.frequency(gramIndex) != count {
+			t.Errorf("Expected %q to have frequency %d", gram, count)
+		}
+	}
+
+	if base.find([]uint32{4, 3, 2}) != -1 {
+		t.Error("Expected a gram missing from the model not to be found")
+	}
+
+	// "a b c" and "a b d" share a prefix; there's nothing starting "e a"
+	if lo, hi := base.prefixRange([]uint32{0, 1}); hi-lo != 2 || base.weight(lo, hi) != 4 {
+		t.Errorf("Expected 2 grams of total frequency 4 starting \"a b\", got %d to %d", lo, hi)
+	}
+
+	if lo, hi := base.prefixRange([]uint32{4, 0}); lo != hi {
+		t.Errorf("Expected no grams starting \"e a\", got %d to %d", lo, hi)
+	}
+}
+
+func TestCompiled_Format(t *testing.T) {
+	grams := NewCollection()
+	grams.AddGrams(map[string]int{"a b c": 1, "a b d": 1, "b c d": 1})
+
+	var buf bytes.Buffer
+
+	if err := grams.Compile(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	data := buf.Bytes()
+
+	if _, err := parseCompiled(data); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := parseCompiled(data[:len(data)-8]); err != ErrCompiledFormat {
+		t.Errorf("Expected a truncated model to be refused, got %v", err)
+	}
+
+	if _, err := parseCompiled([]byte("not a compiled model at all, not even close to one, honestly not")); err != ErrCompiledFormat {
+		t.Errorf("Expected another file to be refused, got %v", err)
+	}
+
+	// corrupt offsets and word IDs are refused, rather than read out of range during generation
+	corrupt := func(offset int, value uint64) []byte {
+		corrupted := append([]byte{}, data...)
+		binary.LittleEndian.PutUint64(corrupted[offset:], value)
+
+		return corrupted
+	}
+
+	// "a b c", "a b d" and "b c d" over 4 one letter words, in 2 prefix groups starting at grams 0 and 2
+	words, wordBytes := 4, 4
+	idsOffset := compiledHeaderSize + 8*(words+1) + 8
+	cumulativeOffset := idsOffset + 40
+	prefixOffset := cumulativeOffset + 24
+
+	for name, corrupted := range map[string][]byte{
+		"word offset out of range":   corrupt(compiledHeaderSize+8*words, 1<<40),
+		"word offsets out of order":  corrupt(compiledHeaderSize+8, uint64(wordBytes)+1),
+		"word ID out of range":       corrupt(idsOffset, 7<<32|uint64(words)),
+		"gram out of order":          corrupt(idsOffset, 1<<32|1),
+		"frequency out of range":     corrupt(cumulativeOffset, 1<<40),
+		"prefix offset out of order": corrupt(prefixOffset+8, 5),
+		"repeated prefix offset":     corrupt(prefixOffset+8, 3),
+		"prefix group split":         corrupt(prefixOffset+8, 1),
+	} {
+		if _, err := parseCompiled(corrupted); err != ErrCompiledFormat {
+			t.Errorf("Expected a model with a %s to be refused, got %v", name, err)
+		}
+	}
+
+	if _, err := parseCompiled(corrupt(prefixOffset+8, 2)); err != nil {
+		t.Errorf("Expected the original offsets to be accepted, got %v", err)
+	}
+
+	// the same goes for a corrupt file, which is refused when it's opened
+	path := filepath.Join(t.TempDir(), "corrupt.bin")
+
+	// the last group would otherwise start one past the last gram, and looking up its prefix would read out of range
+	if err := os.WriteFile(path, corrupt(prefixOffset+8, 3), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := OpenCompiled(path); err != ErrCompiledFormat {
+		t.Errorf("Expected a corrupt file to be refused, got %v", err)
+	}
+
+	// an unaligned copy is realigned rather than read in place
+	unaligned := append([]byte{0}, data...)[1:]
+
+	if _, err := parseCompiled(unaligned); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLayeredCollection(t *testing.T) {
+	base := compileTestModel(t, map[string]int{"a b c": 3, "b c d": 1})
+
+	grams := NewLayeredCollection(base)
+
+	if grams.GramSize() != 3 || grams.Len() != 2 || grams.TotalFrequencies != 4 {
+		t.Fatalf("Expected the compiled model's 2 grams, got %d grams with total frequency %d", grams.Len(), grams.TotalFrequencies)
+	}
+
+	// learning goes to the layer on top, and is merged with the compiled model when read
+	grams.AddGrams(map[string]int{"a b c": 2, "c d e": 5})
+
+	if grams.Len() != 3 || grams.TotalFrequencies != 11 {
+		t.Errorf("Expected 3 grams with total frequency 11, got %d grams with total frequency %d", grams.Len(), grams.TotalFrequencies)
+	}
+
+	expected := map[string]int{"a b c": 5, "b c d": 1, "c d e": 5}
+	seen := map[string]int{}
+
+	grams.Each(func(gram []string, frequency int) {
+		seen[strings.Join(gram, " ")] += frequency
+	})
+
+	for gram, frequency := range expected {
+		if grams.Frequency(strings.Fields(gram)) != frequency || seen[gram] != frequency {
+			t.Errorf("Expected %q to have frequency %d, got %d and %d from Each", gram, frequency, grams.Frequency(strings.Fields(gram)), seen[gram])
+		}
+	}
+
+	if len(seen) != len(expected) {
+		t.Errorf("Expected Each to visit each gram once, got %v", seen)
+	}
+
+	// grams of another size are ignored, as in any collection
+	grams.AddGram([]string{"a", "b"})
+
+	if grams.Len() != 3 {
+		t.Error("Expected a gram of another size to be ignored")
+	}
+
+	if usage := grams.Memory(); usage.Grams != 3 || usage.MappedBytes == 0 {
+		t.Errorf("Unexpected memory usage %+v", usage)
+	}
+}
+
+func TestLayeredCollection_Generate(t *testing.T) {
+	base := compileTestModel(t, map[string]int{"the cat sat": 1, "cat sat on": 1})
+
+	grams := NewLayeredCollection(base)
+	grams.AddGrams(map[string]int{"sat on the": 1, "on the mat": 1})
+
+	// only one path through the grams starts with "the cat", and it crosses from the compiled model to the layer on top
+	for i := 0; i < 20; i++ {
+		text, err := grams.BuildRandomText(0, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.HasSuffix("the cat sat on the mat", text) {
+			t.Errorf("Unexpected text %q", text)
+		}
+	}
+
+	next, err := grams.getNext([]string{"x", "cat", "sat"}, 3, rand.Float64)
+	if err != nil || strings.Join(next, " ") != "cat sat on" {
+		t.Errorf("Expected \"cat sat on\", got %v, %v", next, err)
+	}
+}
+
+func TestLayeredCollection_Distribution(t *testing.T) {
+	base := compileTestModel(t, map[string]int{"a b c": 10, "a b d": 30, "b c d": 5})
+
+	grams := NewLayeredCollection(base)
+	grams.AddGrams(map[string]int{"a b c": 20, "a b e": 40})
+
+	frequencies := map[string]int{"a b c": 30, "a b d": 30, "a b e": 40, "b c d": 5}
+
+	checkDistribution(t, "layered", 100000, frequencies, grams.getWeightedRandomNGram)
+
+	delete(frequencies, "b c d")
+
+	checkDistribution(t, "layered next", 100000, frequencies, func(random func() float64) ([]string, error) {
+		return grams.getNext([]string{"x", "a", "b"}, 3, random)
+	})
+}
+
+func TestLayeredCollection_SaveLoad(t *testing.T) {
+	base := compileTestModel(t, map[string]int{"a b c": 3, "b c d": 1})
+
+	grams := NewLayeredCollection(base)
+	grams.AddGrams(map[string]int{"a b c": 2, "c d e": 5})
+
+	var buf bytes.Buffer
+
+	if err := grams.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// the snapshot holds only what was learned over the compiled model
+	plain := NewCollection()
+
+	if err := plain.Load(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+
+	if plain.Len() != 2 || plain.TotalFrequencies != 7 || len(plain.vocabulary.words) != 5 {
+		t.Errorf("Expected 2 grams over 5 words with total frequency 7, got %v with total frequency %d", plain.Grams(), plain.TotalFrequencies)
+	}
+
+	loaded := NewLayeredCollection(base)
+
+	if err := loaded.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.Len() != 3 || loaded.TotalFrequencies != 11 || loaded.Frequency([]string{"a", "b", "c"}) != 5 {
+		t.Errorf("Expected the learned grams to be layered over the compiled model again, got %d grams with total frequency %d", loaded.Len(), loaded.TotalFrequencies)
+	}
+
+	// compiling the layered collection folds the two together
+	path := filepath.Join(t.TempDir(), "merged.bin")
+
+	if err := loaded.CompileFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	merged, err := OpenCompiled(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer merged.Close()
+
+	if merged.Len() != 3 || merged.TotalFrequencies() != 11 {
+		t.Errorf("Expected 3 grams with total frequency 11, got %d grams with total frequency %d", merged.Len(), merged.TotalFrequencies())
+	}
+}
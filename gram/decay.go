@@ -0,0 +1,243 @@
+package gram
+
+import (
+	"math"
+	"time"
+)
+
+// maxGrowth is the most half-lives the stored weights may run ahead of the epoch before they're rescaled, keeping them
+// well within the range of a float64
+const maxGrowth = 64
+
+// When HalfLife is set, each gram has a weight as well as a frequency. The weight is the gram's frequency with every
+// occurrence decayed exponentially since it was learned, halving every HalfLife, so that old phrasing fades from
+// generation while the frequencies still count everything learned.
+//
+// Decaying every weight as time passes would mean touching every gram, so weights are stored relative to an epoch
+// instead: an occurrence learned at time t adds 2^((t - epoch) / HalfLife) to the gram's stored weight, and the weight at
+// time now is the stored weight times 2^(-(now - epoch) / HalfLife). Since every gram shares the same factor, the stored
+// weights can be sampled from directly. Decay rescales the stored weights to the current time, moving the epoch up to
+// it, and prunes grams whose weight has fallen below PruneBelow.
+
+// growth returns the factor an occurrence learned at time now adds to a stored weight. Until the epoch is set, nothing
+// has been weighed, so nothing has decayed.
+func (gramCollection *GramCollection) growth(now int64) float64 {
+	if gramCollection.epoch == 0 {
+		return 1
+	}
+
+	return math.Exp2(float64(now-gramCollection.epoch) / float64(gramCollection.HalfLife))
+}
+
+// addWeight adds count occurrences learned now to the stored weight of a gram, whose frequency has already been
+// increased by count. Grams learned before HalfLife was set start out with their frequencies as their weights. It must
+// be called with the write lock held.
+func (gramCollection *GramCollection) addWeight(gramIndex, count int) {
+	now := time.Now().UnixNano()
+
+	if gramCollection.epoch == 0 {
+		gramCollection.epoch = now
+	}
+
+	if float64(now-gramCollection.epoch) > maxGrowth*float64(gramCollection.HalfLife) {
+		gramCollection.rescale(now)
+	}
+
+	for len(gramCollection.weights) <= gramIndex {
+		frequency := gramCollection.frequencies[len(gramCollection.weights)]
+
+		if len(gramCollection.weights) == gramIndex {
+			frequency -= count
+		}
+
+		gramCollection.weights = append(gramCollection.weights, float64(frequency))
+		gramCollection.totalWeight += float64(frequency)
+	}
+
+	weight := float64(count) * gramCollection.growth(now)
+
+	gramCollection.weights[gramIndex] += weight
+	gramCollection.totalWeight += weight
+	gramCollection.touch(gramIndex)
+}
+
+// rescale decays the stored weights to the given time, and moves the epoch up to it. It must be called with the write
+// lock held.
+func (gramCollection *GramCollection) rescale(now int64) {
+	decay := 1 / gramCollection.growth(now)
+
+	gramCollection.totalWeight = 0
+
+	for gramIndex := range gramCollection.weights {
+		gramCollection.weights[gramIndex] *= decay
+		gramCollection.totalWeight += gramCollection.weights[gramIndex]
+	}
+
+	gramCollection.epoch = now
+	gramCollection.touchAll()
+}
+
+// reduce takes count away from the frequency of a gram, and from the total, without taking the frequency below 0. The
+// gram's weight is reduced in proportion, since which of its occurrences are being taken away, and so how far each has
+// decayed, isn't known. It returns whether the gram has been left without a positive frequency, and must be called with
+// the write lock held.
+func (gramCollection *GramCollection) reduce(gramIndex, count int) bool {
+	frequency := gramCollection.frequencies[gramIndex]
+
+	if frequency <= 0 {
+		return false
+	}
+
+	if count > frequency {
+		count = frequency
+	}
+
+	if gramIndex < len(gramCollection.weights) {
+		weight := gramCollection.weights[gramIndex] * float64(count) / float64(frequency)
+
+		gramCollection.weights[gramIndex] -= weight
+		gramCollection.totalWeight -= weight
+	}
+
+	gramCollection.frequencies[gramIndex] -= count
+	gramCollection.TotalFrequencies -= count
+	gramCollection.touch(gramIndex)
+
+	return gramCollection.frequencies[gramIndex] == 0
+}
+
+// remapWeights renumbers the stored weights after the collection has been compacted, given the new index of each old
+// gram, or -1 for grams which were removed
+func (gramCollection *GramCollection) remapWeights(remap []int32) {
+	if len(gramCollection.weights) == 0 {
+		return
+	}
+
+	weights := make([]float64, len(gramCollection.frequencies))
+	gramCollection.totalWeight = 0
+
+	for gramIndex, newIndex := range remap {
+		if newIndex < 0 {
+			continue
+		}
+
+		// a gram which hasn't been weighed yet keeps its frequency, which is the weight it would have been given
+		weights[newIndex] = float64(gramCollection.frequencies[newIndex])
+
+		if gramIndex < len(gramCollection.weights) {
+			weights[newIndex] = gramCollection.weights[gramIndex]
+		}
+
+		gramCollection.totalWeight += weights[newIndex]
+	}
+
+	gramCollection.weights = weights
+}
+
+// Decay brings the weight of every gram up to date, and prunes the grams whose weight has fallen below PruneBelow,
+// removing their frequencies from the total, along with any words only they used. It does nothing unless HalfLife is
+// set. Weights decay whether or not Decay is called; calling it periodically keeps the collection from filling up with
+// grams too faded to matter.
+func (gramCollection *GramCollection) Decay() {
+	gramCollection.RW.Lock()
+	defer gramCollection.RW.Unlock()
+
+	if gramCollection.HalfLife <= 0 {
+		return
+	}
+
+	now := time.Now().UnixNano()
+
+	if gramCollection.epoch == 0 {
+		gramCollection.epoch = now
+	}
+
+	// grams learned before HalfLife was set are weighed as of the epoch, as they are everywhere else
+	for gramIndex := len(gramCollection.weights); gramIndex < len(gramCollection.frequencies); gramIndex++ {
+		gramCollection.weights = append(gramCollection.weights, float64(gramCollection.frequencies[gramIndex]))
+		gramCollection.totalWeight += float64(gramCollection.frequencies[gramIndex])
+	}
+
+	gramCollection.rescale(now)
+
+	pruned := false
+
+	for gramIndex, weight := range gramCollection.weights {
+		if weight < gramCollection.PruneBelow && gramCollection.reduce(gramIndex, gramCollection.frequencies[gramIndex]) {
+			pruned = true
+		}
+	}
+
+	if pruned {
+		gramCollection.compact()
+		gramCollection.publish()
+
+		return
+	}
+
+	gramCollection.changed()
+}
+
+// Weight returns the decayed weight of a gram as of now, or its frequency if HalfLife isn't set. Grams of a compiled
+// model the collection is layered over don't decay, so their frequencies are added as they are.
+func (gramCollection *GramCollection) Weight(gram []string) float64 {
+	if gramCollection.HalfLife <= 0 {
+		return float64(gramCollection.Frequency(gram))
+	}
+
+	gramCollection.RW.RLock()
+	defer gramCollection.RW.RUnlock()
+
+	ids, ok := gramCollection.vocabulary.lookup(gram)
+	if !ok {
+		return 0
+	}
+
+	weight := 0.0
+
+	if gramIndex := gramCollection.grams.find(ids); gramIndex > -1 {
+		weight += gramCollection.weightOf(gramIndex) / gramCollection.growth(time.Now().UnixNano())
+	}
+
+	if gramCollection.base != nil {
+		if gramIndex := gramCollection.base.find(ids); gramIndex > -1 {
+			weight += float64(gramCollection.base.frequency(gramIndex))
+		}
+	}
+
+	return weight
+}
+
+// TotalWeight returns the total decayed weight of every gram as of now, or the total frequency if HalfLife isn't set
+func (gramCollection *GramCollection) TotalWeight() float64 {
+	gramCollection.RW.RLock()
+	defer gramCollection.RW.RUnlock()
+
+	if gramCollection.HalfLife <= 0 {
+		return float64(gramCollection.TotalFrequencies)
+	}
+
+	total := gramCollection.totalWeight
+
+	// grams learned before HalfLife was set, and not learned since, still weigh their frequencies
+	for gramIndex := len(gramCollection.weights); gramIndex < len(gramCollection.frequencies); gramIndex++ {
+		total += float64(gramCollection.frequencies[gramIndex])
+	}
+
+	total /= gramCollection.growth(time.Now().UnixNano())
+
+	if gramCollection.base != nil {
+		total += float64(gramCollection.base.TotalFrequencies())
+	}
+
+	return total
+}
+
+// weightOf returns the stored weight of a gram, which is its frequency if it hasn't been weighed yet
+func (gramCollection *GramCollection) weightOf(gramIndex int) float64 {
+	if gramIndex < len(gramCollection.weights) {
+		return gramCollection.weights[gramIndex]
+	}
+
+	return float64(gramCollection.frequencies[gramIndex])
+}
@@ -0,0 +1,141 @@
+package gram
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// age makes everything learned so far seem to have been learned the given number of half-lives ago
+func age(grams *GramCollection, halfLives float64) {
+	grams.RW.Lock()
+	defer grams.RW.Unlock()
+
+	grams.epoch -= int64(halfLives * float64(grams.HalfLife))
+	grams.publish()
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-3*math.Max(math.Abs(a), math.Abs(b))
+}
+
+func TestDecay(t *testing.T) {
+	grams := NewCollection()
+	grams.HalfLife = time.Hour
+	grams.PruneBelow = 0.01
+
+	grams.AddGrams(map[string]int{"the old phrasing": 4, "the cat sat": 2})
+	age(grams, 10)
+	grams.AddGrams(map[string]int{"the new phrasing": 1, "the cat sat": 1})
+
+	for gram, expected := range map[string]float64{"the old phrasing": 4.0 / 1024, "the cat sat": 1 + 2.0/1024, "the new phrasing": 1} {
+		if weight := grams.Weight(strings.Fields(gram)); !near(weight, expected) {
+			t.Errorf("Expected %q to weigh %f, got %f", gram, expected, weight)
+		}
+	}
+
+	if total := grams.TotalWeight(); !near(total, 2+6.0/1024) {
+		t.Errorf("Expected a total weight of %f, got %f", 2+6.0/1024, total)
+	}
+
+	// the old phrasing has all but faded from generation, though its frequency still counts
+	old := 0
+
+	for i := 0; i < 200; i++ {
+		if text, _ := grams.BuildRandomText(3, 3); text == "the old phrasing" {
+			old++
+		}
+	}
+
+	if old > 10 {
+		t.Errorf("Expected the old phrasing to be generated rarely, got it %d times in 200", old)
+	}
+
+	if grams.Frequency(strings.Fields("the old phrasing")) != 4 {
+		t.Errorf("Expected the old phrasing to still have a frequency of 4")
+	}
+
+	// decaying prunes the old phrasing, whose weight has fallen below 0.01, and keeps the rest
+	grams.Decay()
+
+	if grams.Len() != 2 || grams.TotalFrequencies != 4 || grams.Frequency(strings.Fields("the old phrasing")) != 0 {
+		t.Errorf("Expected the old phrasing to be pruned, got %v with a total frequency of %d", counts(grams), grams.TotalFrequencies)
+	}
+
+	if weight := grams.Weight(strings.Fields("the cat sat")); !near(weight, 1+2.0/1024) {
+		t.Errorf("Expected decaying to keep the weight of \"the cat sat\", got %f", weight)
+	}
+
+	if total := grams.TotalWeight(); !near(total, 2+2.0/1024) {
+		t.Errorf("Expected a total weight of %f, got %f", 2+2.0/1024, total)
+	}
+
+	var buffer bytes.Buffer
+
+	if err := grams.Save(&buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := NewCollection()
+	restored.HalfLife = time.Hour
+
+	if err := restored.Load(&buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	if weight := restored.Weight(strings.Fields("the cat sat")); !near(weight, 1+2.0/1024) {
+		t.Errorf("Expected the weight of \"the cat sat\" to be restored from the snapshot, got %f", weight)
+	}
+}
+
+func TestDecay_Reduce(t *testing.T) {
+	grams := NewCollection()
+	grams.HalfLife = time.Hour
+
+	grams.AddDocumentGrams("doc", map[string]int{"the cat sat": 1, "the dog sat": 2})
+	age(grams, 1)
+	grams.AddGrams(map[string]int{"the cat sat": 1, "a cat sat": 1})
+
+	// half of "the cat sat" is unlearned, so it keeps half its weight of 0.5 + 1, while "the dog sat" goes altogether
+	if err := grams.Unlearn("doc"); err != nil {
+		t.Fatal(err)
+	}
+
+	if weight := grams.Weight(strings.Fields("the cat sat")); !near(weight, 0.75) {
+		t.Errorf("Expected \"the cat sat\" to weigh %f, got %f", 0.75, weight)
+	}
+
+	if total := grams.TotalWeight(); !near(total, 1.75) || grams.Len() != 2 {
+		t.Errorf("Expected 2 grams weighing %f, got %d weighing %f", 1.75, grams.Len(), total)
+	}
+}
+
+func TestDecay_Unweighed(t *testing.T) {
+	grams := NewCollection()
+	grams.AddGrams(map[string]int{"the cat sat": 3, "the dog sat": 1})
+
+	// grams learned before HalfLife was set weigh their frequencies until they start to decay
+	grams.HalfLife = time.Hour
+	grams.AddGrams(map[string]int{"a cat sat": 1})
+
+	if weight := grams.Weight(strings.Fields("the cat sat")); !near(weight, 3) {
+		t.Errorf("Expected \"the cat sat\" to weigh 3, got %f", weight)
+	}
+
+	if total := grams.TotalWeight(); !near(total, 5) {
+		t.Errorf("Expected a total weight of 5, got %f", total)
+	}
+
+	grams.PruneBelow = 1.5
+	grams.Decay()
+
+	if expected := map[string]int{"the cat sat": 3}; grams.Len() != 1 || grams.Frequency(strings.Fields("the cat sat")) != 3 {
+		t.Errorf("Expected %v, got %v", expected, counts(grams))
+	}
+
+	if _, err := grams.BuildRandomText(3, 3); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,102 @@
+package gram
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// criticalZ is the standard normal quantile for the significance level the distribution checks are run at. At 0.001 a
+// correct sampler would fail a check about once in a thousand seeds, so every check draws from the same fixed seed, and
+// passes or fails the same way on every run.
+const criticalZ = 3.090
+
+// chiSquaredCritical approximates the critical value of the chi-squared distribution with the given degrees of freedom,
+// using the Wilson-Hilferty transformation
+func chiSquaredCritical(degreesOfFreedom int) float64 {
+	k := float64(degreesOfFreedom)
+	v := 2 / (9 * k)
+
+	return k * math.Pow(1-v+criticalZ*math.Sqrt(v), 3)
+}
+
+// checkDistribution draws from a sampler repeatedly, and checks with Pearson's chi-squared test that the grams drawn
+// follow the given frequencies. Any sampler, past or future, can be checked the same way, given random to draw with.
+func checkDistribution(t *testing.T, name string, draws int, frequencies map[string]int, sample func(random func() float64) ([]string, error)) {
+	t.Helper()
+
+	random := rand.New(rand.NewSource(1))
+
+	total := 0
+
+	for _, frequency := range frequencies {
+		total += frequency
+	}
+
+	observed := map[string]int{}
+
+	for i := 0; i < draws; i++ {
+		g, err := sample(random.Float64)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err.Error())
+		}
+
+		key := strings.Join(g, " ")
+
+		if frequencies[key] <= 0 {
+			t.Fatalf("%s: drew %q, which has no frequency", name, key)
+		}
+
+		observed[key]++
+	}
+
+	statistic := 0.0
+	categories := 0
+
+	for key, frequency := range frequencies {
+		if frequency <= 0 {
+			continue
+		}
+
+		expected := float64(draws) * float64(frequency) / float64(total)
+		difference := float64(observed[key]) - expected
+
+		statistic += difference * difference / expected
+		categories++
+	}
+
+	if categories < 2 {
+		return
+	}
+
+	if critical := chiSquaredCritical(categories - 1); statistic > critical {
+		t.Errorf("%s: chi-squared statistic %.2f exceeds the critical value %.2f; observed %v for frequencies %v", name, statistic, critical, observed, frequencies)
+	}
+}
+
+func TestChiSquaredCritical(t *testing.T) {
+	// published critical values at a significance level of 0.001
+	tt := map[int]float64{
+		1:  10.828,
+		3:  16.266,
+		10: 29.588,
+	}
+
+	for degreesOfFreedom, expected := range tt {
+		if critical := chiSquaredCritical(degreesOfFreedom); math.Abs(critical-expected)/expected > 0.05 {
+			t.Errorf("Expected a critical value of about %.3f for %d degrees of freedom, got %.3f", expected, degreesOfFreedom, critical)
+		}
+	}
+}
+
+func TestWeightedRandomNGram_RareGram(t *testing.T) {
+	// drawing from 0 to the total frequency inclusive, rather than from 1, gave whichever gram came first an extra chance
+	// of being selected, roughly doubling how often a gram seen once was drawn here
+	frequencies := map[string]int{"a b c": 1, "b c d": 1000}
+
+	grams := NewCollection()
+	grams.AddGrams(frequencies)
+
+	checkDistribution(t, "rare gram", 200000, frequencies, grams.getWeightedRandomNGram)
+}
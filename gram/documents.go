@@ -0,0 +1,106 @@
+package gram
+
+import (
+	"github.com/pkg/errors"
+	"sort"
+)
+
+var ErrUnknownDocument = errors.New("Unknown document")
+
+// contribution is what has been learned under a single document ID: how much it added to the frequency of each gram,
+// by gram index, and how many documents it was learned from. Unlearning the ID takes exactly that back out again.
+type contribution struct {
+	grams     map[int32]int
+	documents int64
+}
+
+// contribution returns the record of what has been learned under a document ID, starting a new one if need be, or nil
+// if the ID is empty. It must be called with the write lock held.
+func (gramCollection *GramCollection) contribution(document string) *contribution {
+	if document == "" {
+		return nil
+	}
+
+	if gramCollection.contributions == nil {
+		gramCollection.contributions = map[string]*contribution{}
+	}
+
+	c, ok := gramCollection.contributions[document]
+
+	if !ok {
+		c = &contribution{grams: map[int32]int{}}
+		gramCollection.contributions[document] = c
+	}
+
+	return c
+}
+
+// Documents returns the IDs of the documents which can be unlearned, sorted
+func (gramCollection *GramCollection) Documents() []string {
+	gramCollection.RW.RLock()
+	defer gramCollection.RW.RUnlock()
+
+	documents := make([]string, 0, len(gramCollection.contributions))
+
+	for document := range gramCollection.contributions {
+		documents = append(documents, document)
+	}
+
+	sort.Strings(documents)
+
+	return documents
+}
+
+// Unlearn takes everything learned under a document ID back out of the collection. The frequency each gram was given
+// by the document is subtracted from it and from the total, though no frequency goes below 0, since grams may already
+// have been subtracted since. Grams left without a positive frequency are removed, along with any words no other gram
+// uses, and the document count is reduced by the number of documents learned under the ID. A new model is published
+// before Unlearn returns, so nothing generated afterwards draws on the document, whatever PublishInterval is. Grams
+// learned under an ID while it's being unlearned are recorded afresh, so a document should have finished learning
+// before it's unlearned.
+func (gramCollection *GramCollection) Unlearn(document string) error {
+	gramCollection.RW.Lock()
+	defer gramCollection.RW.Unlock()
+
+	c, ok := gramCollection.contributions[document]
+	if !ok {
+		return ErrUnknownDocument
+	}
+
+	removed := false
+
+	for gramIndex, count := range c.grams {
+		if gramCollection.reduce(int(gramIndex), count) {
+			removed = true
+		}
+	}
+
+	gramCollection.forgetSource(document, c.grams)
+
+	delete(gramCollection.contributions, document)
+	gramCollection.documents.Add(-c.documents)
+
+	if removed {
+		gramCollection.compact()
+	}
+
+	gramCollection.publish()
+
+	return nil
+}
+
+// remapContributions renumbers the grams recorded against each document after the collection has been compacted, given
+// the new index of each old gram, or -1 for grams which were removed
+func (gramCollection *GramCollection) remapContributions(remap []int32) {
+	for _, c := range gramCollection.contributions {
+		grams := make(map[int32]int, len(c.grams))
+
+		for gramIndex, count := range c.grams {
+			if newIndex := remap[gramIndex]; newIndex > -1 {
+				grams[newIndex] = count
+			}
+		}
+
+		c.grams = grams
+	}
+}
@@ -0,0 +1,190 @@
+package gram
+
+import (
+	"bytes"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUnlearn(t *testing.T) {
+	grams := NewCollection()
+
+	grams.AddDocuments("public", map[string]int{"the cat sat": 2, "the dog sat": 1}, 1)
+
+	grams.AddDocuments("secret", map[string]int{"the cat sat": 1, "the secret plan": 3}, 1)
+	grams.AddDocuments("secret", map[string]int{"the secret plan": 1}, 1)
+
+	grams.AddGrams(map[string]int{"a cat sat": 1})
+
+	if err := grams.Unlearn("secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := map[string]int{"the cat sat": 2, "the dog sat": 1, "a cat sat": 1}; !reflect.DeepEqual(counts(grams), expected) {
+		t.Errorf("Expected %v, got %v", expected, counts(grams))
+	}
+
+	if grams.TotalFrequencies != 4 || grams.Stats().Documents != 1 {
+		t.Errorf("Expected a total frequency of 4 from 1 document, got %d from %d", grams.TotalFrequencies, grams.Stats().Documents)
+	}
+
+	// the secret words are gone from the vocabulary and the index of grams containing each word
+	if _, ok := grams.vocabulary.ids["secret"]; ok {
+		t.Error("Expected \"secret\" to be dropped from the vocabulary")
+	}
+
+	if page, _ := grams.SearchGrams([]string{"the"}, "", Page{}); page.Total != 2 {
+		t.Errorf("Expected 2 grams starting with \"the\", got %v", gramTexts(page))
+	}
+
+	if err := grams.Unlearn("secret"); err != ErrUnknownDocument {
+		t.Errorf("Expected a document to be unlearned only once, got %v", err)
+	}
+
+	// the grams of the remaining document were renumbered when the collection was compacted
+	if err := grams.Unlearn("public"); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := map[string]int{"a cat sat": 1}; !reflect.DeepEqual(counts(grams), expected) || grams.TotalFrequencies != 1 {
+		t.Errorf("Expected %v with a total frequency of 1, got %v with %d", expected, counts(grams), grams.TotalFrequencies)
+	}
+
+	if documents := grams.Documents(); len(documents) != 0 {
+		t.Errorf("Expected no documents left to unlearn, got %v", documents)
+	}
+}
+
+func TestUnlearn_Published(t *testing.T) {
+	grams := NewCollection()
+
+	grams.AddGrams(map[string]int{"a dog ran": 1})
+	grams.AddDocumentGrams("secret", map[string]int{"the secret plan": 5})
+
+	// however long it is until the next model would be published, nothing generated after unlearning draws on the
+	// document
+	grams.PublishInterval = time.Hour
+
+	if err := grams.Unlearn("secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 20; i++ {
+		if text, err := grams.BuildRandomText(10, 3); err != nil || text != "a dog ran" {
+			t.Fatalf("Expected \"a dog ran\" to be generated, got %q, %v", text, err)
+		}
+	}
+
+	if page, _ := grams.SearchGrams(nil, "dog", Page{}); page.Total != 1 {
+		t.Errorf("Expected 1 gram containing \"dog\", got %v", gramTexts(page))
+	}
+}
+
+func TestUnlearn_Subtracted(t *testing.T) {
+	grams := NewCollection()
+	grams.AddDocumentGrams("doc", map[string]int{"the cat sat": 3, "the dog sat": 1})
+
+	if err := grams.Subtract(collection(map[string]int{"the cat sat": 2}), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// no frequency goes below 0, however much was subtracted in between
+	if err := grams.Unlearn("doc"); err != nil {
+		t.Fatal(err)
+	}
+
+	if grams.Len() != 0 || grams.TotalFrequencies != 0 {
+		t.Errorf("Expected nothing left, got %v with a total frequency of %d", counts(grams), grams.TotalFrequencies)
+	}
+}
+
+func TestUnlearn_Layered(t *testing.T) {
+	grams := NewLayeredCollection(compileTestModel(t, map[string]int{"the cat sat": 3, "the dog sat": 2}))
+
+	grams.AddDocumentGrams("doc", map[string]int{"the cat sat": 1, "the fish swam": 2})
+	grams.AddGrams(map[string]int{"a cat sat": 1})
+
+	if err := grams.Unlearn("doc"); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := map[string]int{"the cat sat": 3, "the dog sat": 2, "a cat sat": 1}; !reflect.DeepEqual(counts(grams), expected) {
+		t.Errorf("Expected %v, got %v", expected, counts(grams))
+	}
+
+	if grams.TotalFrequencies != 6 || grams.Len() != 3 {
+		t.Errorf("Expected 3 grams with a total frequency of 6, got %d with %d", grams.Len(), grams.TotalFrequencies)
+	}
+
+	if _, err := grams.BuildRandomText(10, 3); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUnlearn_Snapshot(t *testing.T) {
+	grams := NewCollection()
+	grams.AddDocumentGrams("doc", map[string]int{"the cat sat": 2})
+	grams.AddGrams(map[string]int{"the cat sat": 1, "a cat sat": 1})
+
+	var buffer bytes.Buffer
+
+	if err := grams.Save(&buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := NewCollection()
+
+	if err := restored.Load(&buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := restored.Unlearn("doc"); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := map[string]int{"the cat sat": 1, "a cat sat": 1}; !reflect.DeepEqual(counts(restored), expected) {
+		t.Errorf("Expected %v, got %v", expected, counts(restored))
+	}
+}
+
+func TestUnlearnHandler(t *testing.T) {
+	grams := NewCollection()
+	grams.AddDocumentGrams("doc", map[string]int{"the cat sat": 2})
+
+	router := httprouter.New()
+	router.Handle("GET", "/documents", DocumentsHandler(grams))
+	router.Handle("DELETE", "/documents/:id", UnlearnHandler(grams))
+
+	documents := func() string {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/documents", nil))
+
+		return strings.TrimSpace(recorder.Body.String())
+	}
+
+	if listed := documents(); listed != `["doc"]` {
+		t.Errorf("Expected the document to be listed, got %s", listed)
+	}
+
+	for _, expected := range []int{http.StatusNoContent, http.StatusNotFound} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodDelete, "/documents/doc", nil))
+
+		if recorder.Code != expected {
+			t.Errorf("Expected %d, got %d", expected, recorder.Code)
+		}
+	}
+
+	if listed := documents(); listed != `[]` {
+		t.Errorf("Expected no documents to be listed, got %s", listed)
+	}
+
+	if grams.Len() != 0 {
+		t.Errorf("Expected the document to be unlearned, got %v", counts(grams))
+	}
+}
@@ -0,0 +1,225 @@
+package gram
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// The formats grams can be exported in and imported from. Each row holds a gram's words, separated by single spaces in
+// TSV and CSV, and its frequency. TSV and CSV start with a header row.
+const (
+	FormatTSV  = "tsv"
+	FormatCSV  = "csv"
+	FormatJSON = "json" // JSON Lines, each line an object with gram and frequency fields, as in GramCount
+)
+
+// ExportFormats maps each format to its content type
+var ExportFormats = map[string]string{
+	FormatTSV:  "text/tab-separated-values; charset=utf-8",
+	FormatCSV:  "text/csv; charset=utf-8",
+	FormatJSON: "application/x-ndjson",
+}
+
+// ImportBatchSize is the number of grams read before they are added to the collection while importing
+const ImportBatchSize = 10000
+
+// maxRowSize is the longest row of a TSV import
+const maxRowSize = 1024 * 1024
+
+var ErrUnknownFormat = errors.New("Format must be tsv, csv or json")
+
+// Export writes every gram of the collection with a positive frequency, along with the frequency, in the given format.
+// The grams are read from the most recently published model, as generation and queries are, so exporting never takes
+// the collection's locks however long the grams take to write, though grams learned within the last PublishInterval
+// may not have been published yet.
+func (gramCollection *GramCollection) Export(w io.Writer, format string) error {
+	if _, ok := ExportFormats[format]; !ok {
+		return ErrUnknownFormat
+	}
+
+	m := gramCollection.current()
+
+	out := bufio.NewWriter(w)
+	csvOut := csv.NewWriter(out)
+	encoder := json.NewEncoder(out)
+
+	switch format {
+	case FormatTSV:
+		fmt.Fprint(out, "gram\tfrequency\n")
+	case FormatCSV:
+		csvOut.Write([]string{"gram", "frequency"})
+	}
+
+	var err error
+
+	m.each(func(ids []uint32, frequency int) {
+		if err != nil || frequency <= 0 {
+			return
+		}
+
+		switch format {
+		case FormatTSV:
+			_, err = fmt.Fprintf(out, "%s\t%d\n", m.text(ids), frequency)
+		case FormatCSV:
+			err = csvOut.Write([]string{m.text(ids), strconv.Itoa(frequency)})
+		case FormatJSON:
+			err = encoder.Encode(GramCount{Gram: m.wordsOf(ids), Frequency: frequency})
+		}
+	})
+
+	if err != nil {
+		return err
+	}
+
+	csvOut.Flush()
+
+	if err := csvOut.Error(); err != nil {
+		return err
+	}
+
+	return out.Flush()
+}
+
+// Import reads grams and their frequencies in the given format, as written by Export, and adds them to the collection,
+// in batches of ImportBatchSize. Every gram must have gramSize words, or if gramSize is 0, as many as the collection's
+// grams, or the first gram read if the collection is empty. The number of grams read is returned; if an error is
+// returned, the batches read before it have been added.
+func (gramCollection *GramCollection) Import(r io.Reader, format string, gramSize int) (int, error) {
+	if _, ok := ExportFormats[format]; !ok {
+		return 0, ErrUnknownFormat
+	}
+
+	if gramSize == 0 {
+		gramSize = gramCollection.GramSize()
+	}
+
+	next := rowReader(r, format)
+	counts := map[string]int{}
+	read := 0
+
+	flush := func() {
+		if len(counts) > 0 {
+			gramCollection.AddGrams(counts)
+			counts = map[string]int{}
+		}
+	}
+
+	for row := 1; ; row++ {
+		gram, frequency, err := next()
+		if err == io.EOF {
+			break
+		}
+
+		if err == nil && len(gram) == 0 {
+			err = errors.New("No gram")
+		}
+
+		if err == nil && gramSize != 0 && len(gram) != gramSize {
+			err = errors.Errorf("Expected a gram of %d words, got %d", gramSize, len(gram))
+		}
+
+		if err == nil && frequency < 1 {
+			err = errors.Errorf("Expected a frequency of at least 1, got %d", frequency)
+		}
+
+		if err != nil {
+			flush()
+			return read, errors.Errorf("Row %d: %s", row, err.Error())
+		}
+
+		gramSize = len(gram)
+		counts[strings.Join(gram, " ")] += frequency
+		read++
+
+		if len(counts) >= ImportBatchSize {
+			flush()
+		}
+	}
+
+	flush()
+
+	return read, nil
+}
+
+// rowReader returns a function which reads the next gram and frequency of an export, skipping the header row of TSV and
+// CSV, and returns io.EOF once there are no more
+func rowReader(r io.Reader, format string) func() ([]string, int, error) {
+	if format == FormatJSON {
+		decoder := json.NewDecoder(r)
+
+		return func() ([]string, int, error) {
+			var row GramCount
+
+			if err := decoder.Decode(&row); err != nil {
+				return nil, 0, err
+			}
+
+			for _, word := range row.Gram {
+				if strings.Join(strings.Fields(word), "") != word || word == "" {
+					return nil, 0, errors.Errorf("Invalid word %q", word)
+				}
+			}
+
+			return row.Gram, row.Frequency, nil
+		}
+	}
+
+	var fields func() ([]string, error)
+
+	if format == FormatCSV {
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = 2
+
+		fields = reader.Read
+	} else {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(nil, maxRowSize)
+
+		fields = func() ([]string, error) {
+			if !scanner.Scan() {
+				if err := scanner.Err(); err != nil {
+					return nil, err
+				}
+
+				return nil, io.EOF
+			}
+
+			row := strings.Split(scanner.Text(), "\t")
+
+			if len(row) != 2 {
+				return nil, errors.New("Expected a gram and a frequency separated by a tab")
+			}
+
+			return row, nil
+		}
+	}
+
+	first := true
+
+	return func() ([]string, int, error) {
+		row, err := fields()
+
+		if err == nil && first && row[0] == "gram" && row[1] == "frequency" {
+			row, err = fields()
+		}
+
+		first = false
+
+		if err != nil {
+			return nil, 0, err
+		}
+
+		frequency, err := strconv.Atoi(row[1])
+		if err != nil {
+			return nil, 0, errors.Errorf("Invalid frequency %q", row[1])
+		}
+
+		return strings.Fields(row[0]), frequency, nil
+	}
+}
@@ -0,0 +1,142 @@
+package gram
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExportImport(t *testing.T) {
+	counts := map[string]int{"a b c": 3, "b c d": 1, "c, \"d\" e": 2}
+
+	for format := range ExportFormats {
+		grams := NewCollection()
+		grams.AddGrams(counts)
+
+		var buf bytes.Buffer
+
+		if err := grams.Export(&buf, format); err != nil {
+			t.Fatal(err)
+		}
+
+		imported := NewCollection()
+
+		read, err := imported.Import(bytes.NewReader(buf.Bytes()), format, 0)
+		if err != nil {
+			t.Fatalf("%s: %s", format, err.Error())
+		}
+
+		exported := map[string]int{}
+
+		imported.Each(func(gram []string, frequency int) {
+			exported[strings.Join(gram, " ")] = frequency
+		})
+
+		if read != 3 || !reflect.DeepEqual(exported, counts) {
+			t.Errorf("%s: expected %v to be imported, got %d grams %v", format, counts, read, exported)
+		}
+
+		// importing is additive
+		if _, err := imported.Import(bytes.NewReader(buf.Bytes()), format, 3); err != nil || imported.Frequency([]string{"a", "b", "c"}) != 6 {
+			t.Errorf("%s: expected a second import to add to the first", format)
+		}
+	}
+}
+
+func TestExport_Formats(t *testing.T) {
+	grams := NewCollection()
+	grams.AddGram([]string{"a", "b", "c"})
+
+	expected := map[string]string{
+		FormatTSV:  "gram\tfrequency\na b c\t1\n",
+		FormatCSV:  "gram,frequency\na b c,1\n",
+		FormatJSON: "{\"gram\":[\"a\",\"b\",\"c\"],\"frequency\":1}\n",
+	}
+
+	for format, text := range expected {
+		var buf bytes.Buffer
+
+		if err := grams.Export(&buf, format); err != nil {
+			t.Fatal(err)
+		}
+
+		if buf.String() != text {
+			t.Errorf("%s: expected %q, got %q", format, text, buf.String())
+		}
+	}
+
+	if err := grams.Export(&bytes.Buffer{}, "xml"); err != ErrUnknownFormat {
+		t.Errorf("Expected an unknown format to be refused, got %v", err)
+	}
+}
+
+func TestImport_Invalid(t *testing.T) {
+	tt := []struct {
+		Format string
+		Text   string
+		Read   int
+	}{
+		{FormatTSV, "a b c\t1\na b\t1\n", 1},
+		{FormatTSV, "a b c\tx\n", 0},
+		{FormatTSV, "a b c\t0\n", 0},
+		{FormatTSV, "a b c 1\n", 0},
+		{FormatCSV, "a b c,1,2\n", 0},
+		{FormatJSON, "{\"gram\":[\"a\",\"b c\",\"d\"],\"frequency\":1}\n", 0},
+		{FormatJSON, "{\"gram\":[\"a\",\"b\",\"c\"],\"frequency\":1}\nnot json\n", 1},
+	}
+
+	for _, tc := range tt {
+		grams := NewCollection()
+
+		read, err := grams.Import(strings.NewReader(tc.Text), tc.Format, 3)
+		if err == nil {
+			t.Errorf("%s: expected %q to be refused", tc.Format, tc.Text)
+		}
+
+		// grams read before the error are kept
+		if read != tc.Read || grams.Len() != tc.Read {
+			t.Errorf("%s: expected %d grams to be imported before the error, got %d", tc.Format, tc.Read, grams.Len())
+		}
+	}
+}
+
+func TestExportImportHandlers(t *testing.T) {
+	grams := NewCollection()
+	grams.AddGrams(map[string]int{"a b c": 3, "b c d": 1})
+
+	recorder := httptest.NewRecorder()
+	ExportHandler(grams)(recorder, httptest.NewRequest(http.MethodGet, "/export?format=csv", nil), nil)
+
+	if recorder.Code != http.StatusOK || recorder.Header().Get("Content-Type") != ExportFormats[FormatCSV] {
+		t.Fatalf("Unexpected response %d %v", recorder.Code, recorder.Header())
+	}
+
+	imported := NewCollection()
+
+	request := httptest.NewRequest(http.MethodPost, "/import", recorder.Body)
+	request.Header.Set("Content-Type", "text/csv")
+
+	recorder = httptest.NewRecorder()
+	ImportHandler(imported, 3)(recorder, request, nil)
+
+	if recorder.Code != http.StatusOK || strings.TrimSpace(recorder.Body.String()) != "{\"grams\":2}" || imported.Frequency([]string{"a", "b", "c"}) != 3 {
+		t.Errorf("Unexpected response %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = httptest.NewRecorder()
+	ExportHandler(grams)(recorder, httptest.NewRequest(http.MethodGet, "/export?format=xml", nil), nil)
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("Expected an unknown format to be refused, got %d", recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	ImportHandler(imported, 2)(recorder, httptest.NewRequest(http.MethodPost, "/import", strings.NewReader("a b c\t1\n")), nil)
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("Expected grams of the wrong size to be refused, got %d", recorder.Code)
+	}
+}
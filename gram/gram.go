@@ -1,209 +1,357 @@
 package gram
 
 import (
-	"github.com/pkg/errors"
-	"math/rand"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// GramCollection holds every gram learned, along with how often each has been seen. Words are interned in a vocabulary,
+// and grams stored as packed tuples of word IDs, with their frequencies in a parallel array; see vocabulary.go. A
+// collection may be layered over a read-only compiled model, in which case it holds only what has been learned since,
+// and everything read from the collection merges the two; see compiled.go.
 type GramCollection struct {
-	Grams            [][]string
-	Frequencies      []int
-	Indices          []int
 	RW               sync.RWMutex
 	TotalFrequencies int
+	PublishInterval  time.Duration // the least time between publishing models for generation; 0 publishes every write
+	ProvenanceLimit  int           // the most documents recorded against each gram; 0 records none. See provenance.go
+	HalfLife         time.Duration // when set, each gram's weight for generation decays, halving every HalfLife; see decay.go
+	PruneBelow       float64       // grams whose decayed weight falls below this are pruned by Decay
+
+	vocabulary  vocabulary
+	grams       gramTable
+	frequencies []int     // the frequency of each gram in grams, across all learned texts
+	postings    [][]int32 // the indices of the grams containing each word, by word ID; see query.go
+
+	base    *Compiled // the compiled model the collection is layered over, if any
+	overlap int       // the number of grams held both in grams and in the base
+
+	contributions map[string]*contribution // what each document ID has added to the collection; see documents.go
+	sources       vocabulary               // the document IDs recorded for provenance, interned
+	provenance    [][]uint32               // the IDs, in sources, of the documents each gram was learned from; see provenance.go
+
+	weights     []float64 // the stored weight of each gram, relative to epoch, when HalfLife is set; see decay.go
+	totalWeight float64   // the total of weights
+	epoch       int64     // the time weights are stored relative to, in nanoseconds since the epoch, or 0 if nothing has been weighed
+
+	published   atomic.Pointer[model]
+	publishedAt atomic.Int64
+	scheduled   atomic.Bool
+	publishing  sync.Mutex   // held while a model is published, since publish may be called with only the read lock held
+	staleGrams  map[int]bool // the chunks of grams written to since the last model was published; see publish
+	staleWords  map[int]bool // the chunks of words whose postings have changed since the last model was published
+	staleAll    bool         // whether nothing can be shared with the last model published
+
+	documents atomic.Int64 // the number of documents learned
+	learnedAt atomic.Int64 // when the last document was learned, in nanoseconds since the epoch
 }
 
 // Creates a new collection
 func NewCollection() *GramCollection {
 	grams := new(GramCollection)
-	grams.Grams = [][]string{}  // Grams is an array of string arrays
-	grams.Frequencies = []int{} // Frequencies is an array of ints corresponding to each Gram's frequency across all learned texts
-	grams.Indices = []int{}     // indices is an array of ints specifying the order in which the Grams should be iterated
+	grams.vocabulary = newVocabulary()
+	grams.sources = newVocabulary()
+	grams.frequencies = []int{}
 	return grams
 }
 
-// Adding a new gram involves append a gram ([]string) to a 2D array, as well as adding a frequency of 1 (since this will
-// be the first time we've encountered this specific gram), as well as a default index, and then incrementing the total
-// frequencies of all grams across all learned texts
-func (gramCollection *GramCollection) addNewGram(newNgram []string) {
-	gramCollection.Grams = append(gramCollection.Grams, newNgram)
-	gramCollection.Frequencies = append(gramCollection.Frequencies, 1)
-	gramCollection.Indices = append(gramCollection.Indices, len(gramCollection.Indices))
-	gramCollection.TotalFrequencies += 1
-}
+// NewLayeredCollection creates a collection layered over a compiled model. Grams learned are added to the collection,
+// while the compiled model is only ever read. The vocabulary starts out with the model's words, in order, so that a
+// word has the same ID in both.
+func NewLayeredCollection(base *Compiled) *GramCollection {
+	grams := NewCollection()
+	grams.base = base
+	grams.grams.size = base.GramSize()
+	grams.TotalFrequencies = base.TotalFrequencies()
+
+	grams.vocabulary.words = make([]string, 0, base.words())
+
+	for id := 0; id < base.words(); id++ {
+		word := base.word(uint32(id))
 
-// Updating a frequency increments a frequency at a given index, gramIndex, and then increments the total frequencies of
-// all grams across all learned texts
-func (gramCollection *GramCollection) updateFrequency(gramIndex int) {
-	gramCollection.Frequencies[gramIndex] = gramCollection.Frequencies[gramIndex] + 1
-	gramCollection.TotalFrequencies += 1
+		grams.vocabulary.words = append(grams.vocabulary.words, word)
+		grams.vocabulary.ids[word] = uint32(id)
+	}
+
+	return grams
 }
 
-// getIndex fetches the index of a particular gram within the array of grams. If the gram is not found, -1 is returned
-func (gramCollection *GramCollection) getIndex(newNgram []string) int {
+// add adds count to the frequency of a gram, adding the gram first if it's new, and then adds count to the total
+// frequencies of all grams across all learned texts. Every gram in a collection has the same number of words, set by
+// the first gram added, and grams of any other size are ignored. The index of the gram is returned, or -1 if it was
+// ignored. It must be called with the write lock held.
+func (gramCollection *GramCollection) add(newNgram []string, count int) int {
+	if len(newNgram) == 0 || (gramCollection.grams.size != 0 && len(newNgram) != gramCollection.grams.size) {
+		return -1
+	}
 
-	for gramIndex, gram := range gramCollection.Grams {
+	gramIndex := gramCollection.getIndex(newNgram)
 
-		match := true
-		for wordIndex := range gram {
-			if gram[wordIndex] != newNgram[wordIndex] {
-				match = false
-				break
-			}
+	if gramIndex > -1 {
+		gramCollection.frequencies[gramIndex] += count
+		gramCollection.touch(gramIndex)
+	} else {
+		ids := make([]uint32, len(newNgram))
+
+		for i, word := range newNgram {
+			ids[i] = gramCollection.vocabulary.intern(word)
+		}
+
+		gramIndex = gramCollection.grams.insert(ids)
+		gramCollection.frequencies = append(gramCollection.frequencies, count)
+		gramCollection.postings = indexGram(gramCollection.postings, ids, gramIndex)
+
+		for _, id := range ids {
+			gramCollection.touchWord(id)
 		}
 
-		if match {
-			return gramIndex
+		if gramCollection.base != nil && gramCollection.base.find(ids) > -1 {
+			gramCollection.overlap++
 		}
 	}
 
-	return -1
-}
+	gramCollection.TotalFrequencies += count
 
-// getWeightedRandomNGram returns a random gram from the array of grams, taking the gram's frequency into account.
-// First, the gram indices are shuffled to ensure that the grams are iterated in a random order. Next, a random number R
-// between 1 and the total frequency count of all grams is generated. Next, the grams are iterated in a random order,
-// and for each gram, the corresponding frequency is subtracted from R. When the value of R falls to zero or less, the
-// current gram is returned.
-func (grams *GramCollection) getWeightedRandomNGram() ([]string, error) {
+	if gramCollection.HalfLife > 0 {
+		gramCollection.addWeight(gramIndex, count)
+	}
 
-	grams.RW.Lock()
-	defer grams.RW.Unlock()
+	return gramIndex
+}
 
-	if len(grams.Grams) == 0 {
-		return []string{}, errors.New("No grams to fetch randomly")
+// getIndex fetches the index of a particular gram within the table of grams. If the gram is not found, -1 is returned
+func (gramCollection *GramCollection) getIndex(newNgram []string) int {
+	ids, ok := gramCollection.vocabulary.lookup(newNgram)
+	if !ok {
+		return -1
 	}
 
-	// if we only have a single gram, return it
-	if len(grams.Grams) == 1 {
-		return grams.Grams[0], nil
+	return gramCollection.grams.find(ids)
+}
+
+// words returns the words with the given IDs
+func (gramCollection *GramCollection) words(ids []uint32) []string {
+	words := make([]string, len(ids))
+
+	for i, id := range ids {
+		words[i] = gramCollection.vocabulary.words[id]
 	}
 
-	grams.Shuffle()
+	return words
+}
 
-	randomIndex := rand.Intn(grams.TotalFrequencies + 1)
+// GramSize returns the number of words in each gram of the collection, or 0 if nothing has been learned yet
+func (gramCollection *GramCollection) GramSize() int {
+	gramCollection.RW.RLock()
+	defer gramCollection.RW.RUnlock()
 
-	for _, gramIndex := range grams.Indices {
+	return gramCollection.grams.size
+}
 
-		randomIndex -= grams.Frequencies[gramIndex]
+// Len returns the number of distinct grams in the collection
+func (gramCollection *GramCollection) Len() int {
+	gramCollection.RW.RLock()
+	defer gramCollection.RW.RUnlock()
 
-		if randomIndex <= 0 {
-			return grams.Grams[gramIndex], nil
-		}
+	if gramCollection.base != nil {
+		return gramCollection.grams.len() + gramCollection.base.Len() - gramCollection.overlap
 	}
 
-	return []string{}, errors.New("Unable to fetch a random n gram")
+	return gramCollection.grams.len()
 }
 
-// BuildRandomText returns a random string of text based on the grams learned from the learned texts. First, a random
-// gram is selected as the starting point. Next, a subsequent gram is determined, and the last element of the random
-// gram is appended to the starting point. This process repeats until no subsequent gram can be determined.
-func (grams *GramCollection) BuildRandomText(maxWords, gramSize int) (string, error) {
+// Frequency returns how often a gram has been seen, or 0 if it never has
+func (gramCollection *GramCollection) Frequency(gram []string) int {
+	gramCollection.RW.RLock()
+	defer gramCollection.RW.RUnlock()
 
-	startPoint, err := grams.getWeightedRandomNGram()
+	ids, ok := gramCollection.vocabulary.lookup(gram)
+	if !ok {
+		return 0
+	}
 
-	if err != nil {
-		return "", err
+	frequency := 0
+
+	if gramIndex := gramCollection.grams.find(ids); gramIndex > -1 {
+		frequency += gramCollection.frequencies[gramIndex]
 	}
 
-	complete := []string{}
+	if gramCollection.base != nil {
+		if gramIndex := gramCollection.base.find(ids); gramIndex > -1 {
+			frequency += gramCollection.base.frequency(gramIndex)
+		}
+	}
 
-	complete = append(complete, startPoint...)
+	return frequency
+}
 
-	nextGram, err := grams.getNext(startPoint, gramSize)
+// Each calls fn with every gram in the collection, in the order the grams were first learned, holding the read lock
+// throughout. The grams of a compiled model the collection is layered over come first, in the model's order. The gram
+// passed to fn is a fresh slice, which fn may keep.
+func (gramCollection *GramCollection) Each(fn func(gram []string, frequency int)) {
+	gramCollection.RW.RLock()
+	defer gramCollection.RW.RUnlock()
 
-	if err != nil {
-		return strings.Join(complete, " "), nil
-	}
+	gramCollection.eachIDs(func(ids []uint32, frequency int) {
+		fn(gramCollection.words(ids), frequency)
+	})
+}
 
-	for len(nextGram) > 0 {
-		nextElement := nextGram[len(nextGram)-1]
+// eachIDs calls fn with the word IDs of every gram in the collection, merging the grams of the compiled model the
+// collection is layered over, if any, with those learned since. The IDs passed to fn must not be modified or kept. It
+// must be called with either lock held.
+func (gramCollection *GramCollection) eachIDs(fn func(ids []uint32, frequency int)) {
+	base := gramCollection.base
 
-		complete = append(complete, nextElement)
+	if base != nil {
+		for gramIndex := 0; gramIndex < base.Len(); gramIndex++ {
+			ids := base.gram(gramIndex)
+			frequency := base.frequency(gramIndex)
 
-		// for unigrams, we need to consider a maximum length
-		if maxWords > 0 && len(complete) >= maxWords {
-			break
+			if learned := gramCollection.grams.find(ids); learned > -1 {
+				frequency += gramCollection.frequencies[learned]
+			}
+
+			fn(ids, frequency)
 		}
+	}
 
-		nextGram, err = grams.getNext(nextGram, gramSize)
+	for gramIndex, frequency := range gramCollection.frequencies {
+		ids := gramCollection.grams.gram(gramIndex)
 
-		if err != nil {
-			break
+		if base != nil && base.find(ids) > -1 {
+			continue
 		}
-	}
 
-	return strings.Join(complete, " "), nil
+		fn(ids, frequency)
+	}
 }
 
-// getNext returns a gram from a set of grams whose first two words match the last two words of currentNGram. With the
-// set of grams determined, a single gram is randomly selected, taking the gram frequency into account.
-func (grams *GramCollection) getNext(currentNGram []string, gramSize int) ([]string, error) {
+// Grams returns every gram in the collection, in the order the grams were first learned. Each gram is built afresh
+// from the vocabulary, so this is intended for small collections; use Each to visit the grams of a large one.
+func (gramCollection *GramCollection) Grams() [][]string {
+	grams := [][]string{}
 
-	grams.RW.RLock()
-	defer grams.RW.RUnlock()
+	gramCollection.Each(func(gram []string, frequency int) {
+		grams = append(grams, gram)
+	})
 
-	results := NewCollection()
+	return grams
+}
 
-	for _, gramIndex := range grams.Indices {
-		gram := grams.Grams[gramIndex]
+// getWeightedRandomNGram returns a random gram from the most recently published model, taking the gram's frequency
+// into account, drawn with random
+func (grams *GramCollection) getWeightedRandomNGram(random func() float64) ([]string, error) {
+	m := grams.current()
 
-		matchingGramFound := true
+	ids, err := m.weightedRandomNGram(random)
+	if err != nil {
+		return []string{}, err
+	}
 
-		for gramElementIndex := 0; gramElementIndex < gramSize-1; gramElementIndex++ {
+	return m.wordsOf(ids), nil
+}
 
-			// check that the last two elements of the previous n gram match the first two elements of the current ngram
-			if currentNGram[gramElementIndex+1] != gram[gramElementIndex] {
-				matchingGramFound = false
-				break
-			}
-		}
+// BuildRandomText returns a random string of text based on the grams learned from the learned texts. First, a random
+// gram is selected as the starting point. Next, a subsequent gram is determined, and the last element of the random
+// gram is appended to the starting point. This process repeats until no subsequent gram can be determined. The whole
+// text is built from a single published model, without taking any locks.
+func (grams *GramCollection) BuildRandomText(maxWords, gramSize int) (string, error) {
 
-		if matchingGramFound {
-			results.Grams = append(results.Grams, gram)
-			results.Frequencies = append(results.Frequencies, grams.Frequencies[gramIndex])
-			results.Indices = append(results.Indices, len(results.Indices))
-			results.TotalFrequencies += grams.Frequencies[gramIndex]
-		}
+	m := grams.current()
+
+	complete, _, err := m.buildRandom(maxWords, gramSize)
+
+	if err != nil {
+		return "", err
 	}
 
-	randomGram, err := results.getWeightedRandomNGram()
+	return m.text(complete), nil
+}
+
+// getNext returns a gram from the most recently published model whose first two words match the last two words of
+// currentNGram, taking the gram frequency into account, drawn with random
+func (grams *GramCollection) getNext(currentNGram []string, gramSize int, random func() float64) ([]string, error) {
+	m := grams.current()
 
+	prefix, ok := m.lookup(currentNGram[1:gramSize])
+	if !ok {
+		return []string{}, errNoGrams
+	}
+
+	ids, err := m.next(prefix, random)
 	if err != nil {
 		return []string{}, err
 	}
 
-	return randomGram, nil
+	return m.wordsOf(ids), nil
+}
+
+func (gramCollection *GramCollection) AddGram(newNgram []string) {
 
+	gramCollection.RW.Lock()
+	defer gramCollection.RW.Unlock()
+
+	gramCollection.add(newNgram, 1)
+
+	gramCollection.changed()
 }
 
-// Shuffle shuffles the array of indices for the gram collection. This array of indices is used to determine which index
-// in the gram collection should be read from. Hence, if we shuffle the array of indices, we effectively read from the
-// gram collection in a random order.
-func (grams *GramCollection) Shuffle() {
+// AddGrams adds a batch of locally counted grams to the collection, taking the write lock only once. Each key of counts
+// is a gram's words joined by single spaces, and each value is the number of times that gram was seen. New grams are
+// added in sorted order, so that learning the same batch always gives the same collection.
+func (gramCollection *GramCollection) AddGrams(counts map[string]int) {
 
-	rand.Seed(time.Now().UnixNano())
+	gramCollection.AddDocumentGrams("", counts)
 
-	// randomize the gram indices
-	rand.Shuffle(len(grams.Indices), func(i, j int) {
-		grams.Indices[i], grams.Indices[j] = grams.Indices[j], grams.Indices[i]
-	})
+}
 
+// AddDocumentGrams adds a batch of grams as AddGrams does, recording them against a document ID so that they can be
+// unlearned later. An empty ID records nothing.
+func (gramCollection *GramCollection) AddDocumentGrams(document string, counts map[string]int) {
+	gramCollection.AddDocuments(document, counts, 0)
 }
 
-func (gramCollection *GramCollection) AddGram(newNgram []string) {
+// AddDocuments adds a batch of grams as AddDocumentGrams does, and records that the given number of whole documents have
+// been learned, under the document ID if it isn't empty, taking the write lock only once for the lot. Learners counting
+// many small documents under one ID, such as the records of a JSON Lines upload, can then add them a batch at a time.
+func (gramCollection *GramCollection) AddDocuments(document string, counts map[string]int, documents int) {
+
+	keys := make([]string, 0, len(counts))
+
+	for key := range counts {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
 
 	gramCollection.RW.Lock()
 	defer gramCollection.RW.Unlock()
 
-	gramIndex := gramCollection.getIndex(newNgram)
+	contribution := gramCollection.contribution(document)
 
-	if gramIndex > -1 {
-		gramCollection.updateFrequency(gramIndex)
-	} else {
-		gramCollection.addNewGram(newNgram)
+	for _, key := range keys {
+		if count := counts[key]; count > 0 {
+			if gramIndex := gramCollection.add(strings.Split(key, " "), count); gramIndex > -1 && contribution != nil {
+				contribution.grams[int32(gramIndex)] += count
+
+				if gramCollection.ProvenanceLimit > 0 {
+					gramCollection.recordSource(gramIndex, document)
+				}
+			}
+		}
 	}
+
+	if documents > 0 {
+		if contribution != nil {
+			contribution.documents += int64(documents)
+		}
+
+		gramCollection.documents.Add(int64(documents))
+		gramCollection.learnedAt.Store(time.Now().UnixNano())
+	}
+
+	gramCollection.changed()
 }
@@ -2,25 +2,26 @@ package gram
 
 import (
 	"fmt"
+	"math/rand"
 	"strings"
 	"testing"
 )
 
-func TestShuffle(t *testing.T) {
-	grams := NewCollection()
-
-	grams.Indices = []int{0, 1, 2, 4, 5}
-
-	grams.Shuffle()
+// newTestCollection builds a collection from the grams at the given indices, each with the corresponding frequency.
+// Indices without a gram or a frequency are skipped.
+func newTestCollection(grams [][]string, frequencies []int, indices []int) *GramCollection {
+	collection := NewCollection()
 
-	for _, v := range grams.Indices {
-		fmt.Println(v)
+	for _, gramIndex := range indices {
+		if gramIndex < len(grams) && gramIndex < len(frequencies) {
+			collection.add(grams[gramIndex], frequencies[gramIndex])
+		}
 	}
+
+	return collection
 }
 
 func TestGetIndex(t *testing.T) {
-	grams := NewCollection()
-
 	tt := []struct {
 		Grams         [][]string
 		Search        []string
@@ -66,7 +67,11 @@ func TestGetIndex(t *testing.T) {
 	}
 
 	for _, v := range tt {
-		grams.Grams = v.Grams
+		grams := NewCollection()
+
+		for _, g := range v.Grams {
+			grams.add(g, 1)
+		}
 
 		index := grams.getIndex(v.Search)
 
@@ -106,16 +111,16 @@ func TestAddNewGram(t *testing.T) {
 		grams := NewCollection()
 
 		for _, g := range v.GramsToAdd {
-			grams.addNewGram(g)
+			grams.add(g, 1)
 		}
 
-		if len(v.Grams) != len(grams.Grams) {
-			t.Error("len(v.Grams) != len(grams.Grams)")
+		if len(v.Grams) != grams.Len() {
+			t.Error("len(v.Grams) != grams.Len()")
 		}
 
 		for i := 0; i < len(v.GramsToAdd); i++ {
 			g1 := v.GramsToAdd[i]
-			g2 := grams.Grams[i]
+			g2 := grams.Grams()[i]
 
 			for j := range g1 {
 				if g1[j] != g2[j] {
@@ -128,15 +133,9 @@ func TestAddNewGram(t *testing.T) {
 			t.Error("grams.TotalFrequencies != v.TotalFrequencies")
 		}
 
-		for i := range grams.Frequencies {
-			if v.Frequencies[i] != grams.Frequencies[i] {
-				t.Error("v.Frequencies[i] != grams.Frequencies[i]")
-			}
-		}
-
-		for i := range grams.Indices {
-			if v.Indices[i] != grams.Indices[i] {
-				t.Error("v.IndicesToUpdate[i] != grams.IndicesToUpdate[i]")
+		for i := range grams.frequencies {
+			if v.Frequencies[i] != grams.frequencies[i] {
+				t.Error("v.Frequencies[i] != grams.frequencies[i]")
 			}
 		}
 	}
@@ -169,14 +168,16 @@ func TestUpdateFrequency(t *testing.T) {
 
 		grams := NewCollection()
 
-		grams.Frequencies = v.StartingFrequencies
+		for i, frequency := range v.StartingFrequencies {
+			grams.add([]string{fmt.Sprint(i)}, frequency)
+		}
 
 		for _, v := range v.IndicesToUpdate {
-			grams.updateFrequency(v)
+			grams.add([]string{fmt.Sprint(v)}, 1)
 		}
 
 		for i := range v.ExpectedFrequencies {
-			if grams.Frequencies[i] != v.ExpectedFrequencies[i] {
+			if grams.frequencies[i] != v.ExpectedFrequencies[i] {
 				t.Error("Mismatch of frequencies")
 			}
 		}
@@ -268,12 +269,7 @@ func TestGetWeightedRandomNGram(t *testing.T) {
 
 	for _, v := range tt {
 
-		grams := NewCollection()
-
-		grams.Grams = v.Grams
-		grams.Indices = v.Indices
-		grams.Frequencies = v.Frequencies
-		grams.TotalFrequencies = v.TotalFrequencies
+		grams := newTestCollection(v.Grams, v.Frequencies, v.Indices)
 
 		stats := struct {
 			Token     [][]string
@@ -284,7 +280,7 @@ func TestGetWeightedRandomNGram(t *testing.T) {
 		}
 
 		for i := 0; i < 1000; i++ {
-			randomNGram, err := grams.getWeightedRandomNGram()
+			randomNGram, err := grams.getWeightedRandomNGram(rand.Float64)
 
 			if err != nil {
 				t.Error(err.Error())
@@ -367,14 +363,9 @@ func TestGetWeightedRandomNGram_BadData(t *testing.T) {
 
 	for _, v := range tt {
 
-		grams := NewCollection()
-
-		grams.Grams = v.Grams
-		grams.Indices = v.Indices
-		grams.Frequencies = v.Frequencies
-		grams.TotalFrequencies = v.TotalFrequencies
+		grams := newTestCollection(v.Grams, v.Frequencies, v.Indices)
 
-		randomNGram, _ := grams.getWeightedRandomNGram()
+		randomNGram, _ := grams.getWeightedRandomNGram(rand.Float64)
 
 		if len(randomNGram) != len(v.Expected) {
 			t.Fail()
@@ -535,12 +526,7 @@ func TestBuildRandomText(t *testing.T) {
 	}
 
 	for _, v := range tt {
-		grams := NewCollection()
-
-		grams.Grams = v.Grams
-		grams.Frequencies = v.Frequencies
-		grams.TotalFrequencies = v.TotalFrequency
-		grams.Indices = v.Indices
+		grams := newTestCollection(v.Grams, v.Frequencies, v.Indices)
 
 		randomString, _ := grams.BuildRandomText(v.Maxwords, v.GramSize)
 
@@ -618,14 +604,9 @@ func TestGetNext(t *testing.T) {
 	}
 
 	for _, v := range tt {
-		grams := NewCollection()
-
-		grams.Grams = v.Grams
-		grams.Frequencies = v.Frequencies
-		grams.TotalFrequencies = v.TotalFrequency
-		grams.Indices = v.Indices
+		grams := newTestCollection(v.Grams, v.Frequencies, v.Indices)
 
-		nextGram, _ := grams.getNext(v.CurrentGram, v.GramSize)
+		nextGram, _ := grams.getNext(v.CurrentGram, v.GramSize, rand.Float64)
 
 		for i := range nextGram {
 			if nextGram[i] != v.ExpectedGram[i] {
@@ -716,20 +697,48 @@ func TestAddGram(t *testing.T) {
 	}
 
 	for _, v := range tt {
-		grams := NewCollection()
-
-		grams.Grams = v.Grams
-		grams.Frequencies = v.Frequencies
-		grams.TotalFrequencies = v.TotalFrequency
-		grams.Indices = v.Indices
+		grams := newTestCollection(v.Grams, v.Frequencies, v.Indices)
 
 		grams.AddGram(v.CurrentGram)
 
-		for i := range grams.Frequencies {
-			if grams.Frequencies[i] != v.ExpectedFrequencies[i] {
+		for i := range grams.frequencies {
+			if grams.frequencies[i] != v.ExpectedFrequencies[i] {
 				t.Fail()
 			}
 		}
 	}
 
 }
+
+func TestAddGrams(t *testing.T) {
+	grams := NewCollection()
+
+	grams.AddGram([]string{"this", "is", "a"})
+
+	grams.AddGrams(map[string]int{
+		"this is a":      2,
+		"is a sample":    1,
+		"a sample text":  0,
+		"sample text is": 4,
+	})
+
+	expected := map[string]int{
+		"this is a":      3,
+		"is a sample":    1,
+		"sample text is": 4,
+	}
+
+	if grams.Len() != len(expected) {
+		t.Fatalf("Expected %d grams, got %v", len(expected), grams.Grams())
+	}
+
+	for i, g := range grams.Grams() {
+		if grams.frequencies[i] != expected[strings.Join(g, " ")] {
+			t.Errorf("Expected %v to have frequency %d, got %d", g, expected[strings.Join(g, " ")], grams.frequencies[i])
+		}
+	}
+
+	if grams.TotalFrequencies != 8 {
+		t.Errorf("Expected a total frequency of 8, got %d", grams.TotalFrequencies)
+	}
+}
@@ -0,0 +1,298 @@
+package gram
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// StatsHandler reports statistics on what the collection has learned
+func StatsHandler(gramCollection *GramCollection) func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+
+	return func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+		WriteJSON(writer, http.StatusOK, gramCollection.Stats())
+	}
+
+}
+
+// GramsHandler searches for the grams starting with the words of the prefix parameter, containing the word given by
+// the contains parameter, or both
+func GramsHandler(gramCollection *GramCollection) func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+
+	return func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+		query := request.URL.Query()
+
+		page, err := parsePage(query, "limit")
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		result, err := gramCollection.SearchGrams(strings.Fields(query.Get("prefix")), query.Get("contains"), page)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		WriteJSON(writer, http.StatusOK, result)
+	}
+
+}
+
+// TopGramsHandler lists the most frequent grams, n at a time
+func TopGramsHandler(gramCollection *GramCollection) func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+
+	return func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+		page, err := parsePage(request.URL.Query(), "n")
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		WriteJSON(writer, http.StatusOK, gramCollection.TopGrams(page))
+	}
+
+}
+
+// SuccessorsHandler lists the words following the word in the path
+func SuccessorsHandler(gramCollection *GramCollection) func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	return neighboursHandler(gramCollection.Successors)
+}
+
+// PredecessorsHandler lists the words preceding the word in the path
+func PredecessorsHandler(gramCollection *GramCollection) func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	return neighboursHandler(gramCollection.Predecessors)
+}
+
+func neighboursHandler(neighbours func(word string, page Page) (WordPage, error)) func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+
+	return func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+		page, err := parsePage(request.URL.Query(), "limit")
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		result, err := neighbours(params.ByName("word"), page)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		WriteJSON(writer, http.StatusOK, result)
+	}
+
+}
+
+// ExportHandler streams every gram and its frequency in the format given by the format parameter, TSV by default
+func ExportHandler(gramCollection *GramCollection) func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+
+	return func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+		format := request.URL.Query().Get("format")
+
+		if format == "" {
+			format = FormatTSV
+		}
+
+		contentType, ok := ExportFormats[format]
+		if !ok {
+			http.Error(writer, ErrUnknownFormat.Error(), http.StatusBadRequest)
+			return
+		}
+
+		writer.Header().Set("Content-Type", contentType)
+
+		if err := gramCollection.Export(writer, format); err != nil {
+			log.Printf("Error exporting grams: %s", err.Error())
+		}
+	}
+
+}
+
+// ImportHandler adds the grams and frequencies of an export to the collection. The format is given by the format
+// parameter, or else by the content type, and is TSV by default. Every gram must have gramSize words.
+func ImportHandler(gramCollection *GramCollection, gramSize int) func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+
+	return func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+		read, err := gramCollection.Import(request.Body, requestFormat(request), gramSize)
+		if err != nil {
+			http.Error(writer, fmt.Sprintf("%s; %d grams were imported before the error", err.Error(), read), http.StatusBadRequest)
+			return
+		}
+
+		WriteJSON(writer, http.StatusOK, map[string]int{"grams": read})
+	}
+
+}
+
+// DocumentsHandler lists the IDs of the documents which can be unlearned
+func DocumentsHandler(gramCollection *GramCollection) func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+
+	return func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+		WriteJSON(writer, http.StatusOK, gramCollection.Documents())
+	}
+
+}
+
+// UnlearnHandler takes everything learned under a document ID back out of the collection
+func UnlearnHandler(gramCollection *GramCollection) func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+
+	return func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+		if err := gramCollection.Unlearn(params.ByName("id")); err == ErrUnknownDocument {
+			http.Error(writer, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		writer.WriteHeader(http.StatusNoContent)
+	}
+
+}
+
+// MergeHandler adds the grams of an export, read as by ImportHandler, to the collection, with each frequency multiplied
+// by the weight parameter, 1 by default
+func MergeHandler(gramCollection *GramCollection, gramSize int) func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+
+	return combineHandler(gramCollection, gramSize, gramCollection.Add)
+
+}
+
+// SubtractHandler takes the grams of an export, read as by ImportHandler, away from the collection, with each frequency
+// multiplied by the weight parameter, 1 by default
+func SubtractHandler(gramCollection *GramCollection, gramSize int) func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+
+	return combineHandler(gramCollection, gramSize, gramCollection.Subtract)
+
+}
+
+func combineHandler(gramCollection *GramCollection, gramSize int, combine func(other *GramCollection, weight float64) error) func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+
+	return func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+		weight := 1.0
+
+		if value := request.URL.Query().Get("weight"); value != "" {
+			var err error
+
+			if weight, err = strconv.ParseFloat(value, 64); err != nil {
+				http.Error(writer, ErrInvalidWeight.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		other, read, err := readUpload(request, gramSize)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := combine(other, weight); err == ErrCompiledBase {
+			http.Error(writer, err.Error(), http.StatusConflict)
+			return
+		} else if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		WriteJSON(writer, http.StatusOK, map[string]int{"grams": read})
+	}
+
+}
+
+// DiffHandler compares the collection, as A, with the grams of an export, read as by ImportHandler, as B. The limit
+// parameter limits the length of each list of differences.
+func DiffHandler(gramCollection *GramCollection, gramSize int) func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+
+	return func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+		page, err := parsePage(request.URL.Query(), "limit")
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		other, _, err := readUpload(request, gramSize)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		diff, err := DiffCollections(gramCollection, other, page.Limit)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		WriteJSON(writer, http.StatusOK, diff)
+	}
+
+}
+
+// readUpload reads the export in the body of a request into a new collection, refusing grams of any size but gramSize,
+// and returns it along with the number of grams read
+func readUpload(request *http.Request, gramSize int) (*GramCollection, int, error) {
+	other := NewCollection()
+
+	read, err := other.Import(request.Body, requestFormat(request), 0)
+	if err != nil {
+		return nil, read, err
+	}
+
+	if size := other.GramSize(); size != 0 && size != gramSize {
+		return nil, read, ErrGramSizeMismatch
+	}
+
+	return other, read, nil
+}
+
+// requestFormat returns the export format of the body of a request, given by the format parameter, or else by the
+// content type, and TSV by default
+func requestFormat(request *http.Request) string {
+	if format := request.URL.Query().Get("format"); format != "" {
+		return format
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(request.Header.Get("Content-Type"))
+
+	for name, contentType := range ExportFormats {
+		if formatType, _, _ := mime.ParseMediaType(contentType); formatType == mediaType {
+			return name
+		}
+	}
+
+	return FormatTSV
+}
+
+// parsePage reads the offset, sort order and limit of a page of results from a query string, with the limit given by
+// the named parameter
+func parsePage(query url.Values, limit string) (Page, error) {
+	page := Page{Sort: query.Get("sort")}
+
+	for name, value := range map[string]*int{"offset": &page.Offset, limit: &page.Limit} {
+		if query.Get(name) == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(query.Get(name))
+		if err != nil || n < 0 {
+			return page, fmt.Errorf("%s must be a number from 0", name)
+		}
+
+		*value = n
+	}
+
+	return page, nil
+}
+
+// WriteJSON writes value as a JSON response with the given status code
+func WriteJSON(writer http.ResponseWriter, statusCode int, value interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(statusCode)
+
+	if err := json.NewEncoder(writer).Encode(value); err != nil {
+		log.Printf("Error writing response: %s", err.Error())
+	}
+}
@@ -0,0 +1,90 @@
+package gram
+
+import "unsafe"
+
+// mapEntryBytes is a rough estimate of the memory taken by each entry of the vocabulary's map, beyond the key's bytes:
+// the string header and ID, plus the map's own bookkeeping and spare capacity
+const mapEntryBytes = 48
+
+// contributionEntryBytes is a rough estimate of the memory taken by each gram recorded against a document: the gram
+// index and frequency, plus the map's own bookkeeping and spare capacity
+const contributionEntryBytes = 24
+
+// MemoryUsage is an estimate of the memory held by a collection, for sizing servers, including the index of the grams
+// containing each word, the record of what each document ID has added, and the provenance of each gram. It counts the
+// capacity of the collection's slices rather than just their length, since that's what is actually allocated. The
+// most recently published model is counted as ModelBytes: its copies of the frequencies and weights, and the samplers
+// and indices it has built so far as generation and queries needed them, which for a model that has been generated
+// from for a while can be as large again as the collection. A compiled model the collection is layered over is counted
+// separately, as MappedBytes, since it's paged in from its file by the operating system rather than allocated.
+type MemoryUsage struct {
+	Words           int   `json:"words"`
+	Grams           int   `json:"grams"`
+	VocabularyBytes int64 `json:"vocabulary_bytes"`
+	GramBytes       int64 `json:"gram_bytes"`
+	FrequencyBytes  int64 `json:"frequency_bytes"`
+	IndexBytes      int64 `json:"index_bytes"`
+	DocumentBytes   int64 `json:"document_bytes"`
+	ProvenanceBytes int64 `json:"provenance_bytes"`
+	ModelBytes      int64 `json:"model_bytes"`
+	TotalBytes      int64 `json:"total_bytes"`
+	MappedBytes     int64 `json:"mapped_bytes"`
+}
+
+// Memory estimates the memory held by the collection and its published model
+func (gramCollection *GramCollection) Memory() MemoryUsage {
+	m := gramCollection.current()
+
+	gramCollection.RW.RLock()
+	defer gramCollection.RW.RUnlock()
+
+	usage := MemoryUsage{
+		Words: len(gramCollection.vocabulary.words),
+		Grams: gramCollection.grams.len(),
+	}
+
+	mappedWords := 0
+
+	if base := gramCollection.base; base != nil {
+		usage.Grams += base.Len() - gramCollection.overlap
+		usage.MappedBytes = int64(len(base.data))
+		mappedWords = base.words()
+	}
+
+	for _, word := range gramCollection.vocabulary.words[mappedWords:] {
+		usage.VocabularyBytes += int64(len(word))
+	}
+
+	usage.VocabularyBytes += int64(cap(gramCollection.vocabulary.words)) * int64(unsafe.Sizeof(""))
+	usage.VocabularyBytes += int64(len(gramCollection.vocabulary.ids)) * mapEntryBytes
+
+	usage.GramBytes = 4 * int64(cap(gramCollection.grams.ids)+cap(gramCollection.grams.slots))
+	usage.FrequencyBytes = int64(cap(gramCollection.frequencies))*int64(unsafe.Sizeof(0)) + 8*int64(cap(gramCollection.weights))
+
+	usage.IndexBytes = int64(cap(gramCollection.postings)) * int64(unsafe.Sizeof([]int32{}))
+
+	for _, grams := range gramCollection.postings {
+		usage.IndexBytes += 4 * int64(cap(grams))
+	}
+
+	for document, c := range gramCollection.contributions {
+		usage.DocumentBytes += int64(len(document)) + mapEntryBytes + int64(len(c.grams))*contributionEntryBytes
+	}
+
+	usage.ProvenanceBytes = int64(cap(gramCollection.provenance)) * int64(unsafe.Sizeof([]uint32{}))
+
+	for _, sources := range gramCollection.provenance {
+		usage.ProvenanceBytes += 4 * int64(cap(sources))
+	}
+
+	for _, document := range gramCollection.sources.words {
+		usage.ProvenanceBytes += int64(len(document)) + mapEntryBytes
+	}
+
+	usage.ModelBytes = m.memory()
+
+	usage.TotalBytes = usage.VocabularyBytes + usage.GramBytes + usage.FrequencyBytes + usage.IndexBytes +
+		usage.DocumentBytes + usage.ProvenanceBytes + usage.ModelBytes
+
+	return usage
+}
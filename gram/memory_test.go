@@ -0,0 +1,46 @@
+package gram
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMemory(t *testing.T) {
+	grams := NewCollection()
+
+	empty := grams.Memory()
+
+	// a thousand distinct grams over only ten distinct words
+	for i := 0; i < 1000; i++ {
+		grams.AddGram([]string{fmt.Sprint(i % 10), fmt.Sprint(i / 10 % 10), fmt.Sprint(i / 100)})
+	}
+
+	usage := grams.Memory()
+
+	if usage.Words != 10 || usage.Grams != 1000 {
+		t.Errorf("Expected 10 words and 1000 grams, got %d words and %d grams", usage.Words, usage.Grams)
+	}
+
+	if usage.TotalBytes <= empty.TotalBytes || usage.TotalBytes != usage.VocabularyBytes+usage.GramBytes+usage.FrequencyBytes+usage.IndexBytes+usage.DocumentBytes+usage.ProvenanceBytes+usage.ModelBytes {
+		t.Errorf("Unexpected memory usage %+v", usage)
+	}
+
+	// each gram costs its three packed word IDs, a frequency, its share of the hash table and an entry in the postings of
+	// each of its words, rather than three string headers and a slice header
+	if perGram := (usage.TotalBytes - usage.ModelBytes) / int64(usage.Grams); perGram > 64 {
+		t.Errorf("Expected at most 64 bytes per gram, got %d", perGram)
+	}
+
+	// the published model holds its own copy of the frequencies, and builds samplers as text is generated from it
+	if usage.ModelBytes < 8*int64(usage.Grams) {
+		t.Errorf("Expected the model's copy of the frequencies to be counted, got %d bytes", usage.ModelBytes)
+	}
+
+	if _, err := grams.BuildRandomText(10, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	if generated := grams.Memory(); generated.ModelBytes < usage.ModelBytes+12*int64(usage.Grams) {
+		t.Errorf("Expected the samplers built for generation to be counted, got %d bytes rather than %d", generated.ModelBytes, usage.ModelBytes)
+	}
+}
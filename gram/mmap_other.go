@@ -0,0 +1,19 @@
+//go:build !unix
+
+package gram
+
+import (
+	"io"
+	"os"
+)
+
+// mapFile reads a whole file into memory, where it can't be memory mapped
+func mapFile(file *os.File, size int) ([]byte, func() error, error) {
+	data := make([]byte, size)
+
+	if _, err := io.ReadFull(file, data); err != nil {
+		return nil, nil, err
+	}
+
+	return data, func() error { return nil }, nil
+}
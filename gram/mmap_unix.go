@@ -0,0 +1,22 @@
+//go:build unix
+
+package gram
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapFile maps a file read-only into memory, returning the mapped bytes and a function which unmaps them
+func mapFile(file *os.File, size int) ([]byte, func() error, error) {
+	if size == 0 {
+		return []byte{}, func() error { return nil }, nil
+	}
+
+	data, err := syscall.Mmap(int(file.Fd()), 0, size, syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return data, func() error { return syscall.Munmap(data) }, nil
+}
@@ -0,0 +1,533 @@
+package gram
+
+import (
+	"github.com/pkg/errors"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+var errNoGrams = errors.New("No grams to fetch randomly")
+
+// model is an immutable copy of the grams in a collection. Generation only ever reads from the most recently published
+// model, which is swapped in atomically, so any number of generators can run without taking the collection's locks and
+// without holding up learners. A collection layered over a compiled model publishes the grams learned since, and draws
+// from both.
+type model struct {
+	words       []string // the vocabulary when the model was published
+	size        int
+	ids         []uint32 // the packed grams when the model was published
+	frequencies chunked[int]
+	weights     chunked[float64] // the stored weight of each gram, drawn by when HalfLife is set; see decay.go
+	decay       float64          // what the stored weights are multiplied by to give their weight when published
+	total       int
+	postings    chunked[[]int32] // the indices of the grams containing each word when the model was published
+	base        *Compiled
+	sources     []string          // the document IDs recorded for provenance when the model was published
+	provenance  chunked[[]uint32] // the IDs, in sources, of the documents each gram was learned from; see provenance.go
+
+	// samplers are built lazily, the first time they're needed, and thrown away along with the model once a newer model
+	// is published. built estimates the memory they take, for Memory.
+	built      atomic.Int64
+	allOnce    sync.Once
+	all        *sampler
+	prefixOnce sync.Once
+	prefixes   map[string][]int32 // the indices of the grams starting with each run of gramSize-1 words
+	samplers   sync.Map           // a *sampler for each prefix that has been looked up
+	idsOnce    sync.Once
+	wordIDs    map[string]uint32 // the ID of each word in words
+	statsOnce  sync.Once
+	stats      Stats
+	topOnce    sync.Once
+	topGrams   []match // the most frequent grams, most frequent first
+}
+
+// current returns the most recently published model, publishing the first one if nothing has been published yet
+func (gramCollection *GramCollection) current() *model {
+	if m := gramCollection.published.Load(); m != nil {
+		return m
+	}
+
+	gramCollection.RW.RLock()
+	defer gramCollection.RW.RUnlock()
+
+	return gramCollection.publish()
+}
+
+// publish swaps in a new model for generators to use. Words and grams are only ever appended to a collection, never
+// changed in place, so the model shares them with the collection, capped at their current length.
+// The frequencies, weights and the headers of the postings and provenance are copied a chunk at a time, and only the
+// chunks written to since the last model was published are copied; the rest are shared with that model, so publishing
+// costs in proportion to what has changed rather than to the size of the collection. It must be called with either lock
+// held.
+func (gramCollection *GramCollection) publish() *model {
+	gramCollection.publishing.Lock()
+	defer gramCollection.publishing.Unlock()
+
+	previous := gramCollection.published.Load()
+
+	if previous == nil || gramCollection.staleAll {
+		previous = &model{}
+	}
+
+	staleGram := func(chunk int) bool {
+		return gramCollection.staleGrams[chunk]
+	}
+
+	staleWord := func(chunk int) bool {
+		return gramCollection.staleWords[chunk]
+	}
+
+	words := gramCollection.vocabulary.words
+	ids := gramCollection.grams.ids
+	frequencies := gramCollection.frequencies
+
+	postings := publishChunks(len(gramCollection.postings), func(id int) []int32 {
+		grams := gramCollection.postings[id]
+		return grams[:len(grams):len(grams)]
+	}, previous.postings, staleWord)
+
+	provenance := publishChunks(len(gramCollection.provenance), func(gramIndex int) []uint32 {
+		sources := gramCollection.provenance[gramIndex]
+		return sources[:len(sources):len(sources)]
+	}, previous.provenance, staleGram)
+
+	var weights chunked[float64]
+
+	if gramCollection.HalfLife > 0 && gramCollection.epoch != 0 {
+		// grams which haven't been weighed yet are weighted by their frequency
+		weights = publishChunks(len(frequencies), func(gramIndex int) float64 {
+			if gramIndex < len(gramCollection.weights) {
+				return gramCollection.weights[gramIndex]
+			}
+
+			return float64(frequencies[gramIndex])
+		}, previous.weights, staleGram)
+	}
+
+	m := &model{
+		words: words[:len(words):len(words)],
+		size:  gramCollection.grams.size,
+		ids:   ids[:len(ids):len(ids)],
+		frequencies: publishChunks(len(frequencies), func(gramIndex int) int {
+			return frequencies[gramIndex]
+		}, previous.frequencies, staleGram),
+		weights:    weights,
+		decay:      1 / gramCollection.growth(time.Now().UnixNano()),
+		total:      gramCollection.TotalFrequencies,
+		postings:   postings,
+		base:       gramCollection.base,
+		sources:    gramCollection.sources.words[:len(gramCollection.sources.words):len(gramCollection.sources.words)],
+		provenance: provenance,
+	}
+
+	gramCollection.staleGrams = nil
+	gramCollection.staleWords = nil
+	gramCollection.staleAll = false
+
+	gramCollection.published.Store(m)
+	gramCollection.publishedAt.Store(time.Now().UnixNano())
+
+	return m
+}
+
+// publishChunk is the number of values, such as frequencies, in each chunk of a published model
+const publishChunk = 1024
+
+// chunked is a published copy of one of a collection's slices, held in chunks of publishChunk values so that successive
+// models can share the chunks which haven't changed between them
+type chunked[T any] struct {
+	chunks [][]T
+	length int
+}
+
+func (c chunked[T]) at(i int) T {
+	return c.chunks[i/publishChunk][i%publishChunk]
+}
+
+func (c chunked[T]) len() int {
+	return c.length
+}
+
+// memory estimates the memory taken by the chunks, given the size of each value
+func (c chunked[T]) memory(size int64) int64 {
+	return int64(c.length)*size + int64(cap(c.chunks))*int64(unsafe.Sizeof([]T{}))
+}
+
+// publishChunks copies length values, given by value, into chunks. A chunk of previous is shared rather than copied if
+// it's complete, holding the same values as before, and stale doesn't report it as written to since previous was
+// published.
+func publishChunks[T any](length int, value func(i int) T, previous chunked[T], stale func(chunk int) bool) chunked[T] {
+	c := chunked[T]{chunks: make([][]T, 0, (length+publishChunk-1)/publishChunk), length: length}
+
+	for start := 0; start < length; start += publishChunk {
+		chunk := start / publishChunk
+		end := min(start+publishChunk, length)
+
+		if chunk < len(previous.chunks) && len(previous.chunks[chunk]) == end-start && !stale(chunk) {
+			c.chunks = append(c.chunks, previous.chunks[chunk])
+			continue
+		}
+
+		values := make([]T, end-start)
+
+		for i := range values {
+			values[i] = value(start + i)
+		}
+
+		c.chunks = append(c.chunks, values)
+	}
+
+	return c
+}
+
+// touch records that the frequency, weight or provenance of a gram has changed, so that the next model published
+// copies its chunk afresh rather than sharing the last model's. It must be called with the write lock held.
+func (gramCollection *GramCollection) touch(gramIndex int) {
+	if gramCollection.staleGrams == nil {
+		gramCollection.staleGrams = map[int]bool{}
+	}
+
+	gramCollection.staleGrams[gramIndex/publishChunk] = true
+}
+
+// touchWord records that the grams containing a word have changed, as touch does for a gram
+func (gramCollection *GramCollection) touchWord(id uint32) {
+	if gramCollection.staleWords == nil {
+		gramCollection.staleWords = map[int]bool{}
+	}
+
+	gramCollection.staleWords[int(id)/publishChunk] = true
+}
+
+// touchAll records that every gram and word may have changed, such as when the collection has been compacted or
+// loaded, so that the next model published shares nothing with the last. It must be called with the write lock held.
+func (gramCollection *GramCollection) touchAll() {
+	gramCollection.staleAll = true
+}
+
+// changed is called with the write lock held after every write to the collection. Once PublishInterval has passed
+// since the last model was published, a new model is published straight away; otherwise one is scheduled for when the
+// interval is up, so that the last write is never left unpublished.
+func (gramCollection *GramCollection) changed() {
+	wait := gramCollection.PublishInterval - time.Since(time.Unix(0, gramCollection.publishedAt.Load()))
+
+	if wait <= 0 {
+		gramCollection.publish()
+		return
+	}
+
+	if !gramCollection.scheduled.CompareAndSwap(false, true) {
+		return
+	}
+
+	time.AfterFunc(wait, func() {
+		gramCollection.RW.RLock()
+		defer gramCollection.RW.RUnlock()
+
+		gramCollection.scheduled.Store(false)
+		gramCollection.publish()
+	})
+}
+
+// gram returns the word IDs of the gram at the given index
+func (m *model) gram(gramIndex int) []uint32 {
+	return m.ids[gramIndex*m.size : (gramIndex+1)*m.size : (gramIndex+1)*m.size]
+}
+
+// wordsOf returns the words with the given IDs
+func (m *model) wordsOf(ids []uint32) []string {
+	words := make([]string, len(ids))
+
+	for i, id := range ids {
+		words[i] = m.words[id]
+	}
+
+	return words
+}
+
+// lookup returns the IDs the model gives each of the words, or false if any of the words isn't in the model. The
+// collection renumbers its words when it's compacted, so words are always looked up in the model they'll be matched
+// against, never in the collection's vocabulary.
+func (m *model) lookup(words []string) ([]uint32, bool) {
+	m.idsOnce.Do(func() {
+		m.wordIDs = make(map[string]uint32, len(m.words))
+
+		for id, word := range m.words {
+			m.wordIDs[word] = uint32(id)
+		}
+
+		// the words themselves are shared with the collection
+		m.built.Add(int64(len(m.wordIDs)) * mapEntryBytes)
+	})
+
+	ids := make([]uint32, len(words))
+
+	for i, word := range words {
+		id, ok := m.wordIDs[word]
+		if !ok {
+			return nil, false
+		}
+
+		ids[i] = id
+	}
+
+	return ids, true
+}
+
+// text joins the words with the given IDs with single spaces
+func (m *model) text(ids []uint32) string {
+	return strings.Join(m.wordsOf(ids), " ")
+}
+
+// weightedRandomNGram returns the IDs of a random gram from the model, taking the gram's frequency into account. Draws
+// are made with random, which returns a number in [0, 1).
+func (m *model) weightedRandomNGram(random func() float64) ([]uint32, error) {
+	m.allOnce.Do(func() {
+		all := make([]int32, m.frequencies.len())
+
+		for i := range all {
+			all[i] = int32(i)
+		}
+
+		m.all = m.newSampler(all)
+		m.built.Add(m.all.memory())
+	})
+
+	if m.base == nil {
+		return m.draw(m.all, 0, 0, random)
+	}
+
+	return m.draw(m.all, 0, m.base.Len(), random)
+}
+
+// next returns the IDs of a gram starting with the given words, selected at random from every such gram, taking the
+// gram frequency into account, drawn with random as weightedRandomNGram does
+func (m *model) next(prefixIDs []uint32, random func() float64) ([]uint32, error) {
+	m.groupPrefixes()
+
+	lo, hi := 0, 0
+
+	if m.base != nil {
+		lo, hi = m.base.prefixRange(prefixIDs)
+	}
+
+	prefix := prefixKey(prefixIDs)
+
+	if s, ok := m.samplers.Load(prefix); ok {
+		return m.draw(s.(*sampler), lo, hi, random)
+	}
+
+	s, loaded := m.samplers.LoadOrStore(prefix, m.newSampler(m.prefixes[prefix]))
+
+	if !loaded {
+		m.built.Add(int64(len(prefix)) + mapEntryBytes + s.(*sampler).memory())
+	}
+
+	return m.draw(s.(*sampler), lo, hi, random)
+}
+
+// groupPrefixes groups the model's grams by their first gramSize-1 words, the first time it's called
+func (m *model) groupPrefixes() {
+	m.prefixOnce.Do(func() {
+		m.prefixes = map[string][]int32{}
+
+		for gramIndex := 0; gramIndex < m.frequencies.len(); gramIndex++ {
+			gram := m.gram(gramIndex)
+			prefix := prefixKey(gram[:len(gram)-1])
+
+			m.prefixes[prefix] = append(m.prefixes[prefix], int32(gramIndex))
+		}
+
+		for prefix, grams := range m.prefixes {
+			m.built.Add(int64(len(prefix)) + mapEntryBytes + int64(unsafe.Sizeof(grams)) + 4*int64(cap(grams)))
+		}
+	})
+}
+
+// buildRandom builds random text from the model, as described by BuildRandomText, returning the IDs of its words along
+// with the gram each word was drawn from
+func (m *model) buildRandom(maxWords, gramSize int) ([]uint32, [][]uint32, error) {
+
+	startPoint, err := m.weightedRandomNGram(rand.Float64)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	complete := []uint32{}
+	from := [][]uint32{}
+
+	for range startPoint {
+		from = append(from, startPoint)
+	}
+
+	complete = append(complete, startPoint...)
+
+	nextGram, err := m.next(startPoint[1:gramSize], rand.Float64)
+
+	if err != nil {
+		return complete, from, nil
+	}
+
+	for {
+		nextElement := nextGram[len(nextGram)-1]
+
+		complete = append(complete, nextElement)
+		from = append(from, nextGram)
+
+		// for unigrams, we need to consider a maximum length
+		if maxWords > 0 && len(complete) >= maxWords {
+			break
+		}
+
+		nextGram, err = m.next(nextGram[1:gramSize], rand.Float64)
+
+		if err != nil {
+			break
+		}
+	}
+
+	return complete, from, nil
+}
+
+// find returns the index of a gram in the model, or -1 if the model doesn't hold it
+func (m *model) find(ids []uint32) int {
+	m.groupPrefixes()
+
+	for _, gramIndex := range m.prefixes[prefixKey(ids[:len(ids)-1])] {
+		if equalIDs(m.gram(int(gramIndex)), ids) {
+			return int(gramIndex)
+		}
+	}
+
+	return -1
+}
+
+// each calls fn with the IDs of every gram in the model, merging the grams of the compiled model the collection is
+// layered over, if any, with those learned since, as GramCollection.eachIDs does
+func (m *model) each(fn func(ids []uint32, frequency int)) {
+	if m.base != nil {
+		for gramIndex := 0; gramIndex < m.base.Len(); gramIndex++ {
+			ids := m.base.gram(gramIndex)
+			frequency := m.base.frequency(gramIndex)
+
+			if learned := m.find(ids); learned > -1 {
+				frequency += m.frequencies.at(learned)
+			}
+
+			fn(ids, frequency)
+		}
+	}
+
+	for gramIndex := 0; gramIndex < m.frequencies.len(); gramIndex++ {
+		ids := m.gram(gramIndex)
+
+		if m.base != nil && m.base.find(ids) > -1 {
+			continue
+		}
+
+		fn(ids, m.frequencies.at(gramIndex))
+	}
+}
+
+// draw returns the IDs of a random gram, either from the sampler or from the grams lo up to hi of the compiled model
+// the collection is layered over, choosing between the two in proportion to their total weight. Grams of a compiled
+// model don't decay, so their weights are their frequencies.
+func (m *model) draw(s *sampler, lo, hi int, random func() float64) ([]uint32, error) {
+	baseTotal := 0
+
+	if m.base != nil {
+		baseTotal = m.base.weight(lo, hi)
+	}
+
+	learned := s.total() * m.decay
+
+	if baseTotal <= 0 && learned <= 0 {
+		return nil, errNoGrams
+	}
+
+	r := random() * (float64(baseTotal) + learned)
+
+	if r < float64(baseTotal) {
+		return m.base.gram(m.base.pick(lo, hi, int(r)+1)), nil
+	}
+
+	return m.gram(s.pick((r - float64(baseTotal)) / m.decay)), nil
+}
+
+// sampler draws weighted random grams from a fixed set. The cumulative weight of the grams is found once, so that each
+// draw is a binary search for a random number between 0 and the total weight.
+type sampler struct {
+	grams      []int32
+	cumulative []float64
+}
+
+// newSampler builds a sampler over the grams at the given indices of the model. Each gram is weighted by its frequency,
+// or by its stored weight if the model has weights. Grams without a positive frequency or weight can never be drawn, so
+// they are left out.
+func (m *model) newSampler(indices []int32) *sampler {
+	s := &sampler{}
+	total := 0.0
+
+	for _, gramIndex := range indices {
+		frequency := m.frequencies.at(int(gramIndex))
+		weight := float64(frequency)
+
+		if m.weights.len() > 0 {
+			weight = m.weights.at(int(gramIndex))
+		}
+
+		if frequency <= 0 || weight <= 0 {
+			continue
+		}
+
+		total += weight
+
+		s.grams = append(s.grams, gramIndex)
+		s.cumulative = append(s.cumulative, total)
+	}
+
+	return s
+}
+
+// memory estimates the memory taken by the sampler
+func (s *sampler) memory() int64 {
+	return 4*int64(cap(s.grams)) + 8*int64(cap(s.cumulative))
+}
+
+// memory estimates the memory held by the model beyond what it shares with the collection: its copies of the
+// frequencies and weights, the headers of its postings and provenance, and the samplers and indices built so far.
+// Chunks shared with the model published before are counted too, since that model is dropped once this one is
+// published.
+func (m *model) memory() int64 {
+	bytes := m.frequencies.memory(int64(unsafe.Sizeof(0))) + m.weights.memory(8)
+	bytes += m.postings.memory(int64(unsafe.Sizeof([]int32{}))) + m.provenance.memory(int64(unsafe.Sizeof([]uint32{})))
+
+	return bytes + m.built.Load()
+}
+
+// total returns the total weight of the sampler's grams
+func (s *sampler) total() float64 {
+	if len(s.cumulative) == 0 {
+		return 0
+	}
+
+	return s.cumulative[len(s.cumulative)-1]
+}
+
+// pick returns the index in the model of the gram where the running total first passes r, between 0 and the total
+func (s *sampler) pick(r float64) int {
+	i := sort.Search(len(s.cumulative), func(i int) bool { return s.cumulative[i] > r })
+
+	// rounding may leave r a whisker past the total
+	if i == len(s.cumulative) {
+		i--
+	}
+
+	return int(s.grams[i])
+}
@@ -0,0 +1,173 @@
+package gram
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPublishInterval(t *testing.T) {
+	grams := NewCollection()
+	grams.PublishInterval = 50 * time.Millisecond
+
+	// nothing has been published yet, so the first write is published straight away
+	grams.AddGram([]string{"a", "b", "c"})
+
+	if n := grams.current().frequencies.len(); n != 1 {
+		t.Fatalf("Expected the first gram to be published, got %d grams", n)
+	}
+
+	grams.AddGrams(map[string]int{"b c d": 1})
+
+	if n := grams.current().frequencies.len(); n != 1 {
+		t.Errorf("Expected the second gram to wait for the publish interval, got %d grams", n)
+	}
+
+	deadline := time.Now().Add(time.Second)
+
+	for grams.current().frequencies.len() != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the second gram to be published once the interval was up")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if total := grams.current().total; total != 2 {
+		t.Errorf("Expected a published total frequency of 2, got %d", total)
+	}
+}
+
+func TestBuildRandomText_WhileLearning(t *testing.T) {
+	grams := NewCollection()
+	grams.AddGram([]string{"a", "b", "c"})
+
+	var wg sync.WaitGroup
+
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+
+		for i := 0; i < 200; i++ {
+			grams.AddGrams(map[string]int{"b c a": 1, "c a b": 1})
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+
+		for i := 0; i < 200; i++ {
+			if _, err := grams.BuildRandomText(10, 3); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+
+	wg.Wait()
+}
+
+func TestWeightedRandomNGram_Distribution(t *testing.T) {
+	frequencies := map[string]int{"a b c": 70, "a b d": 20, "b c d": 9, "c d e": 1, "d e f": 0}
+
+	grams := NewCollection()
+	grams.AddGrams(frequencies)
+
+	checkDistribution(t, "every gram", 100000, frequencies, grams.getWeightedRandomNGram)
+
+	// a draw following [a b] only ever sees the grams starting with [a b]
+	following := func(random func() float64) ([]string, error) {
+		return grams.getNext([]string{"x", "a", "b"}, 3, random)
+	}
+
+	checkDistribution(t, "following [a b]", 100000, map[string]int{"a b c": 70, "a b d": 20}, following)
+
+	// learning and unlearning publish a new model, whose sampler for [a b] is built afresh from the new frequencies
+	grams.AddGrams(map[string]int{"a b c": 30})
+
+	checkDistribution(t, "following [a b] after learning", 100000, map[string]int{"a b c": 100, "a b d": 20}, following)
+
+	grams.AddDocumentGrams("doc", map[string]int{"a b e": 10})
+
+	checkDistribution(t, "following [a b] after learning a document", 100000, map[string]int{"a b c": 100, "a b d": 20, "a b e": 10}, following)
+
+	if err := grams.Unlearn("doc"); err != nil {
+		t.Fatal(err)
+	}
+
+	checkDistribution(t, "following [a b] after unlearning", 100000, map[string]int{"a b c": 100, "a b d": 20}, following)
+}
+
+func TestNext_Invalidated(t *testing.T) {
+	grams := NewCollection()
+	grams.AddGram([]string{"a", "b", "c"})
+
+	if _, err := grams.getNext([]string{"a", "b", "c"}, 3, rand.Float64); err == nil {
+		t.Fatal("Expected no gram to follow [a b c]")
+	}
+
+	// learning publishes a new model, so the empty sampler built for [b c] is thrown away
+	grams.AddGram([]string{"b", "c", "d"})
+
+	next, err := grams.getNext([]string{"a", "b", "c"}, 3, rand.Float64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(next, " ") != "b c d" {
+		t.Errorf("Expected [b c d], got %v", next)
+	}
+}
+
+func TestPublish_SharesChunks(t *testing.T) {
+	grams := NewCollection()
+	counts := map[string]int{}
+
+	for i := 0; i < 3*publishChunk; i++ {
+		counts[fmt.Sprintf("a%d b c", i)] = 1
+	}
+
+	grams.AddGrams(counts)
+
+	before := grams.current()
+
+	grams.AddGrams(map[string]int{"a5 b c": 1})
+
+	after := grams.current()
+	gramIndex := grams.getIndex([]string{"a5", "b", "c"})
+
+	if before.frequencies.at(gramIndex) != 1 || after.frequencies.at(gramIndex) != 2 {
+		t.Errorf("Expected a frequency of 1 before and 2 after, got %d and %d", before.frequencies.at(gramIndex), after.frequencies.at(gramIndex))
+	}
+
+	// only the chunk holding the gram learned again is copied; no word has been added to a gram, so no postings are
+	for chunk := range after.frequencies.chunks {
+		shared := &before.frequencies.chunks[chunk][0] == &after.frequencies.chunks[chunk][0]
+
+		if shared == (chunk == gramIndex/publishChunk) {
+			t.Errorf("Expected only chunk %d of the frequencies to be copied, got chunk %d shared %v", gramIndex/publishChunk, chunk, shared)
+		}
+	}
+
+	for chunk := range after.postings.chunks {
+		if &before.postings.chunks[chunk][0] != &after.postings.chunks[chunk][0] {
+			t.Errorf("Expected chunk %d of the postings to be shared", chunk)
+		}
+	}
+
+	// unlearning a gram away compacts the collection, renumbering every gram, so nothing is shared
+	grams.AddDocumentGrams("doc", map[string]int{"z b c": 1})
+
+	if err := grams.Unlearn("doc"); err != nil {
+		t.Fatal(err)
+	}
+
+	compacted := grams.current()
+
+	if compacted.frequencies.len() != 3*publishChunk || &compacted.frequencies.chunks[0][0] == &after.frequencies.chunks[0][0] {
+		t.Errorf("Expected the compacted frequencies to be copied afresh")
+	}
+}
@@ -0,0 +1,115 @@
+package gram
+
+// SourcedWord is a generated word, along with the documents the gram it was generated from was learned from
+type SourcedWord struct {
+	Word      string   `json:"word"`
+	Documents []string `json:"documents"`
+}
+
+// SourcedText is generated text, along with where each of its words came from
+type SourcedText struct {
+	Text  string        `json:"text"`
+	Words []SourcedWord `json:"words"`
+}
+
+// recordSource records that a gram was learned from a document, unless the gram already has ProvenanceLimit documents
+// recorded against it. It must be called with the write lock held.
+func (gramCollection *GramCollection) recordSource(gramIndex int, document string) {
+	id := gramCollection.sources.intern(document)
+
+	for len(gramCollection.provenance) <= gramIndex {
+		gramCollection.provenance = append(gramCollection.provenance, nil)
+	}
+
+	sources := gramCollection.provenance[gramIndex]
+
+	if len(sources) < gramCollection.ProvenanceLimit && !containsID(sources, id) {
+		gramCollection.provenance[gramIndex] = append(sources, id)
+		gramCollection.touch(gramIndex)
+	}
+}
+
+// forgetSource removes a document from the documents recorded against each of the given grams. The lists are replaced
+// rather than changed in place, since published models share them. It must be called with the write lock held.
+func (gramCollection *GramCollection) forgetSource(document string, grams map[int32]int) {
+	id, ok := gramCollection.sources.ids[document]
+	if !ok {
+		return
+	}
+
+	for gramIndex := range grams {
+		if int(gramIndex) >= len(gramCollection.provenance) || !containsID(gramCollection.provenance[gramIndex], id) {
+			continue
+		}
+
+		sources := []uint32{}
+
+		for _, source := range gramCollection.provenance[gramIndex] {
+			if source != id {
+				sources = append(sources, source)
+			}
+		}
+
+		gramCollection.provenance[gramIndex] = sources
+		gramCollection.touch(int(gramIndex))
+	}
+}
+
+// remapProvenance renumbers the documents recorded against each gram after the collection has been compacted, given
+// the new index of each old gram, or -1 for grams which were removed
+func (gramCollection *GramCollection) remapProvenance(remap []int32) {
+	if len(gramCollection.provenance) == 0 {
+		return
+	}
+
+	provenance := [][]uint32{}
+
+	for gramIndex, sources := range gramCollection.provenance {
+		if newIndex := remap[gramIndex]; newIndex > -1 {
+			for len(provenance) <= int(newIndex) {
+				provenance = append(provenance, nil)
+			}
+
+			provenance[newIndex] = sources
+		}
+	}
+
+	gramCollection.provenance = provenance
+}
+
+// BuildSourcedText builds random text as BuildRandomText does, annotating each word with the documents the gram it was
+// generated from was learned from. The words of the first gram all come from that gram. Only documents learned while
+// ProvenanceLimit was set are known, and grams of a compiled model the collection is layered over have none.
+func (grams *GramCollection) BuildSourcedText(maxWords, gramSize int) (SourcedText, error) {
+	m := grams.current()
+
+	words, from, err := m.buildRandom(maxWords, gramSize)
+	if err != nil {
+		return SourcedText{}, err
+	}
+
+	text := SourcedText{Text: m.text(words), Words: make([]SourcedWord, len(words))}
+
+	for i, id := range words {
+		text.Words[i] = SourcedWord{Word: m.words[id], Documents: m.sourcesOf(from[i])}
+	}
+
+	return text, nil
+}
+
+// sourcesOf returns the documents recorded against a gram of the model
+func (m *model) sourcesOf(ids []uint32) []string {
+	documents := []string{}
+
+	if m.provenance.len() == 0 {
+		return documents
+	}
+
+	if gramIndex := m.find(ids); gramIndex > -1 && gramIndex < m.provenance.len() {
+		for _, id := range m.provenance.at(gramIndex) {
+			documents = append(documents, m.sources[id])
+		}
+	}
+
+	return documents
+}
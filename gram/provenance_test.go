@@ -0,0 +1,106 @@
+package gram
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestBuildSourcedText(t *testing.T) {
+	grams := NewCollection()
+	grams.ProvenanceLimit = 2
+
+	grams.AddDocumentGrams("first", map[string]int{"the cat sat": 1})
+	grams.AddDocumentGrams("second", map[string]int{"the cat sat": 1, "cat sat down": 1})
+	grams.AddDocumentGrams("third", map[string]int{"the cat sat": 1})
+	grams.AddDocumentGrams("second", map[string]int{"cat sat down": 1})
+
+	// the text either starts from "the cat sat", which only the first two documents are recorded against, or from "cat sat
+	// down"
+	expected := map[string]SourcedText{
+		"the cat sat down": {
+			Text: "the cat sat down",
+			Words: []SourcedWord{
+				{"the", []string{"first", "second"}},
+				{"cat", []string{"first", "second"}},
+				{"sat", []string{"first", "second"}},
+				{"down", []string{"second"}},
+			},
+		},
+		"cat sat down": {
+			Text: "cat sat down",
+			Words: []SourcedWord{
+				{"cat", []string{"second"}},
+				{"sat", []string{"second"}},
+				{"down", []string{"second"}},
+			},
+		},
+	}
+
+	for i := 0; i < 20; i++ {
+		text, err := grams.BuildSourcedText(10, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(text, expected[text.Text]) {
+			t.Errorf("Expected %+v, got %+v", expected[text.Text], text)
+		}
+	}
+
+	// grams learned without a document ID have no provenance
+	untraced := NewCollection()
+	untraced.ProvenanceLimit = 2
+	untraced.AddGrams(map[string]int{"the cat sat": 1})
+
+	if text, _ := untraced.BuildSourcedText(10, 3); len(text.Words) != 3 || len(text.Words[0].Documents) != 0 {
+		t.Errorf("Expected no documents, got %+v", text)
+	}
+}
+
+func TestProvenance_Unlearn(t *testing.T) {
+	grams := NewCollection()
+	grams.ProvenanceLimit = 2
+
+	grams.AddDocumentGrams("first", map[string]int{"a dog ran": 1, "the cat sat": 1})
+	grams.AddDocumentGrams("second", map[string]int{"the cat sat": 1})
+
+	before, _ := grams.BuildSourcedText(10, 3)
+
+	// unlearning "first" removes "a dog ran", so "the cat sat" is renumbered, and keeps only "second"
+	if err := grams.Unlearn("first"); err != nil {
+		t.Fatal(err)
+	}
+
+	text, err := grams.BuildSourcedText(10, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if text.Text != "the cat sat" || !reflect.DeepEqual(text.Words[0].Documents, []string{"second"}) {
+		t.Errorf("Expected \"the cat sat\" from the second document, got %+v", text)
+	}
+
+	var buffer bytes.Buffer
+
+	if err := grams.Save(&buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := NewCollection()
+
+	if err := restored.Load(&buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	if text, _ := restored.BuildSourcedText(10, 3); !reflect.DeepEqual(text.Words[2].Documents, []string{"second"}) {
+		t.Errorf("Expected provenance to be restored from the snapshot, got %+v", text)
+	}
+
+	// text built before unlearning is left as it was
+	for _, word := range before.Words {
+		if len(word.Documents) == 0 {
+			t.Errorf("Expected every word to have a document, got %+v", before)
+		}
+	}
+}
@@ -0,0 +1,461 @@
+package gram
+
+import (
+	"container/heap"
+	"github.com/pkg/errors"
+	"sort"
+	"strings"
+)
+
+const (
+	DefaultLimit = 50   // the number of results returned when a page has no limit
+	MaxLimit     = 1000 // the most results returned in a single page
+	MaxTop       = 1000 // the number of most frequent grams kept for each published model
+)
+
+// Results can be sorted by frequency, most frequent first, or alphabetically. Ties in frequency are broken
+// alphabetically, so that paging through results always visits each result once.
+const (
+	SortFrequency    = "frequency"
+	SortAlphabetical = "alphabetical"
+)
+
+var (
+	ErrEmptyQuery  = errors.New("Either a prefix or a word the grams contain must be given")
+	ErrUnknownSort = errors.New("Results can only be sorted by frequency or alphabetically")
+)
+
+// Page selects part of a sorted list of results
+type Page struct {
+	Offset int
+	Limit  int    // DefaultLimit if not given, and at most MaxLimit
+	Sort   string // SortFrequency if not given
+}
+
+// GramCount is a gram along with how often it has been seen
+type GramCount struct {
+	Gram      []string `json:"gram"`
+	Frequency int      `json:"frequency"`
+}
+
+// WordCount is a word along with how often it has been seen
+type WordCount struct {
+	Word      string `json:"word"`
+	Frequency int    `json:"frequency"`
+}
+
+// GramPage is a page of grams, along with the total number of grams matched
+type GramPage struct {
+	Total  int         `json:"total"`
+	Offset int         `json:"offset"`
+	Limit  int         `json:"limit"`
+	Grams  []GramCount `json:"grams"`
+}
+
+// WordPage is a page of words, along with the total number of words matched
+type WordPage struct {
+	Total  int         `json:"total"`
+	Offset int         `json:"offset"`
+	Limit  int         `json:"limit"`
+	Words  []WordCount `json:"words"`
+}
+
+// SearchGrams returns a page of the grams starting with the words of prefix and containing the word contains. Either
+// may be left empty, but not both. Candidate grams are found through an index of the grams containing each word, rather
+// than by scanning every gram, and read from the most recently published model, so searching never holds up learners.
+func (gramCollection *GramCollection) SearchGrams(prefix []string, contains string, page Page) (GramPage, error) {
+	if len(prefix) == 0 && contains == "" {
+		return GramPage{}, ErrEmptyQuery
+	}
+
+	if err := page.normalise(); err != nil {
+		return GramPage{}, err
+	}
+
+	result := GramPage{Offset: page.Offset, Limit: page.Limit, Grams: []GramCount{}}
+
+	words := append([]string{}, prefix...)
+
+	if contains != "" {
+		words = append(words, contains)
+	}
+
+	m := gramCollection.current()
+
+	ids, ok := m.lookup(words)
+	if !ok || len(prefix) > m.size {
+		return result, nil
+	}
+
+	matches := m.search(ids[:len(prefix)], ids[len(prefix):])
+	m.sortMatches(matches, page.Sort)
+
+	result.Total = len(matches)
+
+	for _, match := range matches[page.start(len(matches)):page.end(len(matches))] {
+		result.Grams = append(result.Grams, GramCount{Gram: m.wordsOf(match.ids), Frequency: match.frequency})
+	}
+
+	return result, nil
+}
+
+// TopGrams returns a page of the most frequent grams. Only the MaxTop most frequent grams are kept, found once for each
+// published model, so paging past them returns nothing.
+func (gramCollection *GramCollection) TopGrams(page Page) GramPage {
+	page.normalise()
+
+	m := gramCollection.current()
+	top := m.top()
+
+	result := GramPage{Total: len(top), Offset: page.Offset, Limit: page.Limit, Grams: []GramCount{}}
+
+	for _, match := range top[page.start(len(top)):page.end(len(top))] {
+		result.Grams = append(result.Grams, GramCount{Gram: m.wordsOf(match.ids), Frequency: match.frequency})
+	}
+
+	return result
+}
+
+// Successors returns a page of the words which follow word, with the total frequency of the grams starting with word
+// followed by each of them
+func (gramCollection *GramCollection) Successors(word string, page Page) (WordPage, error) {
+	return gramCollection.neighbours(word, page, func(m *model, id uint32) map[uint32]int {
+		counts := map[uint32]int{}
+
+		for _, match := range m.search([]uint32{id}, nil) {
+			counts[match.ids[1]] += match.frequency
+		}
+
+		return counts
+	})
+}
+
+// Predecessors returns a page of the words which precede word, with the total frequency of the grams starting with
+// each of them followed by word
+func (gramCollection *GramCollection) Predecessors(word string, page Page) (WordPage, error) {
+	return gramCollection.neighbours(word, page, func(m *model, id uint32) map[uint32]int {
+		counts := map[uint32]int{}
+
+		for _, match := range m.search(nil, []uint32{id}) {
+			if match.ids[1] == id {
+				counts[match.ids[0]] += match.frequency
+			}
+		}
+
+		return counts
+	})
+}
+
+// neighbours returns a page of the words counted by count, for the successors or predecessors of a word
+func (gramCollection *GramCollection) neighbours(word string, page Page, count func(m *model, id uint32) map[uint32]int) (WordPage, error) {
+	if err := page.normalise(); err != nil {
+		return WordPage{}, err
+	}
+
+	result := WordPage{Offset: page.Offset, Limit: page.Limit, Words: []WordCount{}}
+
+	m := gramCollection.current()
+	ids, ok := m.lookup([]string{word})
+
+	// a gram of a single word has no neighbours
+	if !ok || m.size < 2 {
+		return result, nil
+	}
+
+	counts := count(m, ids[0])
+	words := make([]WordCount, 0, len(counts))
+
+	for id, frequency := range counts {
+		words = append(words, WordCount{Word: m.words[id], Frequency: frequency})
+	}
+
+	sort.Slice(words, func(i, j int) bool {
+		if page.Sort == SortFrequency && words[i].Frequency != words[j].Frequency {
+			return words[i].Frequency > words[j].Frequency
+		}
+
+		return words[i].Word < words[j].Word
+	})
+
+	result.Total = len(words)
+	result.Words = append(result.Words, words[page.start(len(words)):page.end(len(words))]...)
+
+	return result, nil
+}
+
+// normalise fills in the defaults of a page, and checks its sort order
+func (page *Page) normalise() error {
+	if page.Offset < 0 {
+		page.Offset = 0
+	}
+
+	if page.Limit <= 0 {
+		page.Limit = DefaultLimit
+	}
+
+	if page.Limit > MaxLimit {
+		page.Limit = MaxLimit
+	}
+
+	if page.Sort == "" {
+		page.Sort = SortFrequency
+	}
+
+	if page.Sort != SortFrequency && page.Sort != SortAlphabetical {
+		return ErrUnknownSort
+	}
+
+	return nil
+}
+
+// start and end return the bounds of the page within a list of total results
+func (page Page) start(total int) int {
+	if page.Offset > total {
+		return total
+	}
+
+	return page.Offset
+}
+
+func (page Page) end(total int) int {
+	if page.Offset+page.Limit > total {
+		return total
+	}
+
+	return page.Offset + page.Limit
+}
+
+// indexGram adds the index of a gram to the postings of each distinct word in it, returning the postings
+func indexGram(postings [][]int32, ids []uint32, gramIndex int) [][]int32 {
+	for i, id := range ids {
+		if containsID(ids[:i], id) {
+			continue
+		}
+
+		for int(id) >= len(postings) {
+			postings = append(postings, nil)
+		}
+
+		postings[id] = append(postings[id], int32(gramIndex))
+	}
+
+	return postings
+}
+
+func containsID(ids []uint32, id uint32) bool {
+	for _, other := range ids {
+		if other == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasPrefix(ids, prefix []uint32) bool {
+	return len(prefix) <= len(ids) && equalIDs(prefix, ids[:len(prefix)])
+}
+
+// match is a gram found by a query, with its frequency across the model and any compiled model it's layered over
+type match struct {
+	ids       []uint32
+	frequency int
+}
+
+// search returns the grams with a positive frequency which start with prefix and contain every word of contains. At
+// least one word must be given, since candidates are found through the postings of the first word given.
+func (m *model) search(prefix, contains []uint32) []match {
+	matches := []match{}
+
+	accept := func(ids []uint32) bool {
+		for _, id := range contains {
+			if !containsID(ids, id) {
+				return false
+			}
+		}
+
+		return hasPrefix(ids, prefix)
+	}
+
+	key := append(append([]uint32{}, prefix...), contains...)[0]
+
+	if int(key) < m.postings.len() {
+		for _, gramIndex := range m.postings.at(int(key)) {
+			ids := m.gram(int(gramIndex))
+			frequency := m.frequencies.at(int(gramIndex))
+
+			if frequency <= 0 || !accept(ids) || m.base != nil && m.base.find(ids) > -1 {
+				continue
+			}
+
+			matches = append(matches, match{ids: ids, frequency: frequency})
+		}
+	}
+
+	if m.base == nil {
+		return matches
+	}
+
+	consider := func(gramIndex int) {
+		ids := m.base.gram(gramIndex)
+
+		if !accept(ids) {
+			return
+		}
+
+		frequency := m.base.frequency(gramIndex)
+
+		if learned := m.find(ids); learned > -1 {
+			frequency += m.frequencies.at(learned)
+		}
+
+		if frequency > 0 {
+			matches = append(matches, match{ids: ids, frequency: frequency})
+		}
+	}
+
+	if len(prefix) > 0 {
+		lo, hi := m.base.prefixedRange(prefix)
+
+		for gramIndex := lo; gramIndex < hi; gramIndex++ {
+			consider(gramIndex)
+		}
+	} else {
+		for _, gramIndex := range m.base.containing(key) {
+			consider(int(gramIndex))
+		}
+	}
+
+	return matches
+}
+
+// top returns the MaxTop most frequent grams of the model, most frequent first, finding them the first time it's called
+func (m *model) top() []match {
+	m.topOnce.Do(func() {
+		h := &matchHeap{m: m}
+
+		m.each(func(ids []uint32, frequency int) {
+			candidate := match{ids: ids, frequency: frequency}
+
+			switch {
+			case frequency <= 0:
+			case h.Len() < MaxTop:
+				heap.Push(h, candidate)
+			case m.ranksBefore(candidate, h.matches[0]):
+				h.matches[0] = candidate
+				heap.Fix(h, 0)
+			}
+		})
+
+		m.sortMatches(h.matches, SortFrequency)
+		m.topGrams = h.matches
+	})
+
+	return m.topGrams
+}
+
+// matchHeap is a heap of matches with the lowest ranked at the top, so that it can be replaced by a higher ranked match
+type matchHeap struct {
+	m       *model
+	matches []match
+}
+
+func (h *matchHeap) Len() int           { return len(h.matches) }
+func (h *matchHeap) Less(i, j int) bool { return h.m.ranksBefore(h.matches[j], h.matches[i]) }
+func (h *matchHeap) Swap(i, j int)      { h.matches[i], h.matches[j] = h.matches[j], h.matches[i] }
+func (h *matchHeap) Push(x interface{}) { h.matches = append(h.matches, x.(match)) }
+
+func (h *matchHeap) Pop() interface{} {
+	last := h.matches[len(h.matches)-1]
+	h.matches = h.matches[:len(h.matches)-1]
+
+	return last
+}
+
+// ranksBefore returns whether a is more frequent than b, or equally frequent and alphabetically first
+func (m *model) ranksBefore(a, b match) bool {
+	if a.frequency != b.frequency {
+		return a.frequency > b.frequency
+	}
+
+	return m.compareWords(a.ids, b.ids) < 0
+}
+
+func (m *model) sortMatches(matches []match, order string) {
+	sort.Slice(matches, func(i, j int) bool {
+		if order == SortAlphabetical {
+			return m.compareWords(matches[i].ids, matches[j].ids) < 0
+		}
+
+		return m.ranksBefore(matches[i], matches[j])
+	})
+}
+
+// compareWords compares two grams alphabetically, word by word
+func (m *model) compareWords(a, b []uint32) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if c := strings.Compare(m.words[a[i]], m.words[b[i]]); c != 0 {
+			return c
+		}
+	}
+
+	return len(a) - len(b)
+}
+
+// prefixedRange returns the range of grams starting with the given words, of which there may be any number up to the
+// gram size
+func (c *Compiled) prefixedRange(prefix []uint32) (int, int) {
+	lo := sort.Search(c.Len(), func(i int) bool {
+		return compareIDs(c.gram(i)[:len(prefix)], prefix) >= 0
+	})
+
+	hi := lo + sort.Search(c.Len()-lo, func(i int) bool {
+		return compareIDs(c.gram(lo + i)[:len(prefix)], prefix) > 0
+	})
+
+	return lo, hi
+}
+
+// containing returns the indices of the grams containing a word. The grams containing each word are indexed in memory
+// the first time this is called, since the index isn't part of the compiled model's file.
+func (c *Compiled) containing(id uint32) []uint32 {
+	c.postingsOnce.Do(func() {
+		offsets := make([]int, c.words()+1)
+
+		for gramIndex := 0; gramIndex < c.Len(); gramIndex++ {
+			gram := c.gram(gramIndex)
+
+			for i, word := range gram {
+				if !containsID(gram[:i], word) {
+					offsets[word+1]++
+				}
+			}
+		}
+
+		for i := 1; i < len(offsets); i++ {
+			offsets[i] += offsets[i-1]
+		}
+
+		grams := make([]uint32, offsets[len(offsets)-1])
+		next := append([]int{}, offsets...)
+
+		for gramIndex := 0; gramIndex < c.Len(); gramIndex++ {
+			gram := c.gram(gramIndex)
+
+			for i, word := range gram {
+				if !containsID(gram[:i], word) {
+					grams[next[word]] = uint32(gramIndex)
+					next[word]++
+				}
+			}
+		}
+
+		c.postingOffsets, c.postingGrams = offsets, grams
+	})
+
+	if int(id) >= c.words() {
+		return nil
+	}
+
+	return c.postingGrams[c.postingOffsets[id]:c.postingOffsets[id+1]]
+}
@@ -0,0 +1,249 @@
+package gram
+
+import (
+	"encoding/json"
+	"github.com/julienschmidt/httprouter"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var queryCounts = map[string]int{
+	"the cat sat":  3,
+	"the cat ran":  1,
+	"the dog sat":  2,
+	"a cat sat":    2,
+	"cat sat down": 4,
+	"sat the cat":  1,
+}
+
+// gramTexts joins the words of each gram of a page, keeping their frequencies
+func gramTexts(page GramPage) map[string]int {
+	texts := map[string]int{}
+
+	for _, g := range page.Grams {
+		texts[strings.Join(g.Gram, " ")] = g.Frequency
+	}
+
+	return texts
+}
+
+func gramOrder(page GramPage) []string {
+	order := []string{}
+
+	for _, g := range page.Grams {
+		order = append(order, strings.Join(g.Gram, " "))
+	}
+
+	return order
+}
+
+func TestSearchGrams(t *testing.T) {
+	grams := NewCollection()
+	grams.AddGrams(queryCounts)
+
+	tt := []struct {
+		Prefix   string
+		Contains string
+		Page     Page
+		Total    int
+		Expected []string
+	}{
+		{Prefix: "the", Total: 3, Expected: []string{"the cat sat", "the dog sat", "the cat ran"}},
+		{Prefix: "the cat", Total: 2, Expected: []string{"the cat sat", "the cat ran"}},
+		{Prefix: "the cat sat", Total: 1, Expected: []string{"the cat sat"}},
+		{Prefix: "the cat sat down", Total: 0, Expected: []string{}},
+		{Prefix: "the fish", Total: 0, Expected: []string{}},
+		{Contains: "cat", Total: 5, Expected: []string{"cat sat down", "the cat sat", "a cat sat", "sat the cat", "the cat ran"}},
+		{Contains: "cat", Page: Page{Sort: SortAlphabetical}, Total: 5, Expected: []string{"a cat sat", "cat sat down", "sat the cat", "the cat ran", "the cat sat"}},
+		{Contains: "cat", Page: Page{Offset: 1, Limit: 2}, Total: 5, Expected: []string{"the cat sat", "a cat sat"}},
+		{Contains: "cat", Page: Page{Offset: 10}, Total: 5, Expected: []string{}},
+		{Prefix: "the", Contains: "sat", Total: 2, Expected: []string{"the cat sat", "the dog sat"}},
+	}
+
+	for _, tc := range tt {
+		page, err := grams.SearchGrams(strings.Fields(tc.Prefix), tc.Contains, tc.Page)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if page.Total != tc.Total || !reflect.DeepEqual(gramOrder(page), tc.Expected) {
+			t.Errorf("Expected %d grams %v for prefix %q containing %q, got %d grams %v", tc.Total, tc.Expected, tc.Prefix, tc.Contains, page.Total, gramOrder(page))
+		}
+	}
+
+	if _, err := grams.SearchGrams(nil, "", Page{}); err != ErrEmptyQuery {
+		t.Errorf("Expected an empty query to be refused, got %v", err)
+	}
+
+	if _, err := grams.SearchGrams(nil, "cat", Page{Sort: "length"}); err != ErrUnknownSort {
+		t.Errorf("Expected an unknown sort order to be refused, got %v", err)
+	}
+}
+
+func TestTopGrams(t *testing.T) {
+	grams := NewCollection()
+	grams.AddGrams(queryCounts)
+
+	page := grams.TopGrams(Page{Limit: 4})
+
+	// "the dog sat" and "a cat sat" are equally frequent, and ordered alphabetically
+	if expected := []string{"cat sat down", "the cat sat", "a cat sat", "the dog sat"}; page.Total != 6 || !reflect.DeepEqual(gramOrder(page), expected) {
+		t.Errorf("Expected %v, got %v of %d", expected, gramOrder(page), page.Total)
+	}
+
+	if page := grams.TopGrams(Page{Offset: 4, Limit: 4}); len(page.Grams) != 2 {
+		t.Errorf("Expected the last 2 grams, got %v", gramOrder(page))
+	}
+
+	// only the most frequent grams are kept
+	for i := 0; i < MaxTop; i++ {
+		grams.AddGram([]string{"x", "y", strings.Repeat("z", i+1)})
+	}
+
+	if page := grams.TopGrams(Page{Limit: 2}); page.Total != MaxTop || !reflect.DeepEqual(gramOrder(page), []string{"cat sat down", "the cat sat"}) {
+		t.Errorf("Expected the top %d grams, got %v of %d", MaxTop, gramOrder(page), page.Total)
+	}
+}
+
+func TestSuccessorsPredecessors(t *testing.T) {
+	grams := NewCollection()
+	grams.AddGrams(queryCounts)
+
+	successors, err := grams.Successors("the", Page{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := []WordCount{{"cat", 4}, {"dog", 2}}; !reflect.DeepEqual(successors.Words, expected) {
+		t.Errorf("Expected successors %v, got %v", expected, successors.Words)
+	}
+
+	predecessors, err := grams.Predecessors("cat", Page{Sort: SortAlphabetical})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := []WordCount{{"a", 2}, {"the", 4}}; !reflect.DeepEqual(predecessors.Words, expected) {
+		t.Errorf("Expected predecessors %v, got %v", expected, predecessors.Words)
+	}
+
+	if none, _ := grams.Successors("fish", Page{}); none.Total != 0 || none.Words == nil {
+		t.Errorf("Expected no successors of an unknown word, got %v", none)
+	}
+}
+
+func TestSearchGrams_Compacted(t *testing.T) {
+	grams := NewCollection()
+	grams.AddGrams(queryCounts)
+	grams.current()
+
+	// compacting away the only gram with "a" renumbers every word, though generators are left on the model published
+	// before until the next one is published
+	grams.RW.Lock()
+	grams.reduce(grams.getIndex([]string{"a", "cat", "sat"}), 2)
+	grams.compact()
+	grams.RW.Unlock()
+
+	if page, _ := grams.SearchGrams(nil, "cat", Page{}); page.Total != 5 || gramTexts(page)["a cat sat"] != 2 {
+		t.Errorf("Expected the 5 grams containing \"cat\" in the published model, got %v", gramTexts(page))
+	}
+
+	if successors, _ := grams.Successors("the", Page{}); !reflect.DeepEqual(successors.Words, []WordCount{{"cat", 4}, {"dog", 2}}) {
+		t.Errorf("Expected the successors of \"the\" in the published model, got %v", successors.Words)
+	}
+
+	for i := 0; i < 20; i++ {
+		if next, err := grams.getNext([]string{"a", "the", "cat"}, 3, rand.Float64); err != nil || next[0] != "the" || next[1] != "cat" {
+			t.Fatalf("Expected a gram starting with \"the cat\", got %v, %v", next, err)
+		}
+	}
+}
+
+func TestSearchGrams_Layered(t *testing.T) {
+	base := compileTestModel(t, map[string]int{"the cat sat": 3, "the dog sat": 2, "a cat sat": 2})
+
+	grams := NewLayeredCollection(base)
+	grams.AddGrams(map[string]int{"the cat sat": 1, "the cat ran": 1, "sat the cat": 1})
+
+	page, err := grams.SearchGrams([]string{"the"}, "", Page{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := map[string]int{"the cat sat": 4, "the dog sat": 2, "the cat ran": 1}; !reflect.DeepEqual(gramTexts(page), expected) {
+		t.Errorf("Expected %v, got %v", expected, gramTexts(page))
+	}
+
+	page, err = grams.SearchGrams(nil, "cat", Page{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := map[string]int{"the cat sat": 4, "a cat sat": 2, "the cat ran": 1, "sat the cat": 1}; !reflect.DeepEqual(gramTexts(page), expected) {
+		t.Errorf("Expected %v, got %v", expected, gramTexts(page))
+	}
+
+	if top := grams.TopGrams(Page{Limit: 1}); !reflect.DeepEqual(gramTexts(top), map[string]int{"the cat sat": 4}) || top.Total != 5 {
+		t.Errorf("Expected \"the cat sat\" to be the most frequent of 5 grams, got %v of %d", gramTexts(top), top.Total)
+	}
+
+	predecessors, _ := grams.Predecessors("cat", Page{})
+
+	if expected := []WordCount{{"the", 5}, {"a", 2}}; !reflect.DeepEqual(predecessors.Words, expected) {
+		t.Errorf("Expected predecessors %v, got %v", expected, predecessors.Words)
+	}
+}
+
+func TestGramHandlers(t *testing.T) {
+	grams := NewCollection()
+	grams.AddGrams(queryCounts)
+
+	router := httprouter.New()
+	router.Handle("GET", "/grams", GramsHandler(grams))
+	router.Handle("GET", "/grams/top", TopGramsHandler(grams))
+	router.Handle("GET", "/words/:word/successors", SuccessorsHandler(grams))
+	router.Handle("GET", "/words/:word/predecessors", PredecessorsHandler(grams))
+
+	get := func(target string, result interface{}) int {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+
+		if recorder.Code == http.StatusOK {
+			if err := json.NewDecoder(recorder.Body).Decode(result); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		return recorder.Code
+	}
+
+	var page GramPage
+
+	if code := get("/grams?prefix=the+cat&limit=1", &page); code != http.StatusOK || page.Total != 2 || !reflect.DeepEqual(gramOrder(page), []string{"the cat sat"}) {
+		t.Errorf("Unexpected response %d %+v", code, page)
+	}
+
+	if code := get("/grams/top?n=1&offset=1", &page); code != http.StatusOK || !reflect.DeepEqual(gramOrder(page), []string{"the cat sat"}) {
+		t.Errorf("Unexpected response %d %+v", code, page)
+	}
+
+	var words WordPage
+
+	if code := get("/words/sat/successors", &words); code != http.StatusOK || !reflect.DeepEqual(words.Words, []WordCount{{"the", 1}}) {
+		t.Errorf("Unexpected response %d %+v", code, words)
+	}
+
+	if code := get("/words/sat/predecessors", &words); code != http.StatusOK || !reflect.DeepEqual(words.Words, []WordCount{{"cat", 4}}) {
+		t.Errorf("Unexpected response %d %+v", code, words)
+	}
+
+	for _, target := range []string{"/grams", "/grams?contains=cat&limit=x", "/grams?contains=cat&offset=-1", "/grams?contains=cat&sort=length", "/words/sat/successors?sort=length"} {
+		if code := get(target, nil); code != http.StatusBadRequest {
+			t.Errorf("Expected %s to be refused, got %d", target, code)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package gram
+
+import (
+	"encoding/gob"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"sort"
+)
+
+// snapshot is the on-disk representation of a gram collection. The collection itself can't be encoded directly, since
+// gob refuses to encode the embedded mutex. Grams is only read, from snapshots written before words were interned.
+type snapshot struct {
+	Words            []string
+	Size             int
+	IDs              []uint32
+	Grams            [][]string
+	Frequencies      []int
+	TotalFrequencies int
+	Documents        int64
+	LearnedAt        int64
+	Contributions    map[string]snapshotContribution
+	Sources          []string
+	Provenance       [][]uint32
+	Weights          []float64
+	Epoch            int64
+}
+
+// snapshotContribution is what has been learned under a document ID, with the index of each gram and the frequency it
+// added in parallel arrays
+type snapshotContribution struct {
+	Grams       []int32
+	Frequencies []int
+	Documents   int64
+}
+
+// Save writes the vocabulary, grams and frequencies of the collection to w, holding the read lock so that learners
+// can't modify the collection part way through the write. A collection layered over a compiled model saves only what
+// has been learned since, along with just the words that needs.
+func (gramCollection *GramCollection) Save(w io.Writer) error {
+	gramCollection.RW.RLock()
+	defer gramCollection.RW.RUnlock()
+
+	s := snapshot{
+		Words:            gramCollection.vocabulary.words,
+		Size:             gramCollection.grams.size,
+		IDs:              gramCollection.grams.ids,
+		Frequencies:      gramCollection.frequencies,
+		TotalFrequencies: gramCollection.TotalFrequencies,
+		Documents:        gramCollection.documents.Load(),
+		LearnedAt:        gramCollection.learnedAt.Load(),
+		Contributions:    map[string]snapshotContribution{},
+		Sources:          gramCollection.sources.words,
+		Provenance:       gramCollection.provenance,
+		Weights:          gramCollection.weights,
+		Epoch:            gramCollection.epoch,
+	}
+
+	for document, c := range gramCollection.contributions {
+		saved := snapshotContribution{Grams: make([]int32, 0, len(c.grams)), Documents: c.documents}
+
+		for gramIndex := range c.grams {
+			saved.Grams = append(saved.Grams, gramIndex)
+		}
+
+		sort.Slice(saved.Grams, func(i, j int) bool { return saved.Grams[i] < saved.Grams[j] })
+
+		for _, gramIndex := range saved.Grams {
+			saved.Frequencies = append(saved.Frequencies, c.grams[gramIndex])
+		}
+
+		s.Contributions[document] = saved
+	}
+
+	if gramCollection.base != nil {
+		s.Words, s.IDs = []string{}, make([]uint32, len(gramCollection.grams.ids))
+		s.TotalFrequencies -= gramCollection.base.TotalFrequencies()
+
+		renumbered := map[uint32]uint32{}
+
+		for i, id := range gramCollection.grams.ids {
+			if _, ok := renumbered[id]; !ok {
+				renumbered[id] = uint32(len(s.Words))
+				s.Words = append(s.Words, gramCollection.vocabulary.words[id])
+			}
+
+			s.IDs[i] = renumbered[id]
+		}
+	}
+
+	return gob.NewEncoder(w).Encode(s)
+}
+
+// Load replaces the contents of the collection with a snapshot previously written by Save. A collection layered over a
+// compiled model keeps the model, and loads the snapshot on top of it.
+func (gramCollection *GramCollection) Load(r io.Reader) error {
+	var s snapshot
+
+	if err := gob.NewDecoder(r).Decode(&s); err != nil {
+		return err
+	}
+
+	vocabulary := newVocabulary()
+	grams := gramTable{}
+	frequencies := []int{}
+	postings := [][]int32{}
+	total := s.TotalFrequencies
+	overlap := 0
+
+	if s.Grams == nil && (s.Size < 0 || s.Size*len(s.Frequencies) != len(s.IDs) || s.Size == 0 && len(s.Frequencies) > 0) {
+		return errors.New("Snapshot grams and frequencies don't match")
+	}
+
+	if s.Grams != nil || gramCollection.base != nil {
+		// an older snapshot, holding every gram in full, or one loaded over a compiled model, whose word IDs won't match
+		// the model's; either way the grams are added one at a time
+		restored := NewCollection()
+
+		if gramCollection.base != nil {
+			restored = NewLayeredCollection(gramCollection.base)
+
+			if s.Grams == nil && s.Size != 0 && s.Size != restored.grams.size {
+				return errors.New("Snapshot grams are a different size to the compiled model's")
+			}
+		}
+
+		if s.Grams != nil {
+			for i, gram := range s.Grams {
+				if i < len(s.Frequencies) {
+					restored.add(gram, s.Frequencies[i])
+				}
+			}
+		} else {
+			for i, frequency := range s.Frequencies {
+				gram := make([]string, s.Size)
+
+				for j, id := range s.IDs[i*s.Size : (i+1)*s.Size] {
+					if int(id) >= len(s.Words) {
+						return errors.New("Snapshot grams refer to words missing from the vocabulary")
+					}
+
+					gram[j] = s.Words[id]
+				}
+
+				restored.add(gram, frequency)
+			}
+		}
+
+		vocabulary, grams, frequencies, postings = restored.vocabulary, restored.grams, restored.frequencies, restored.postings
+
+		if gramCollection.base != nil {
+			total, overlap = restored.TotalFrequencies, restored.overlap
+		}
+	} else {
+		for _, word := range s.Words {
+			vocabulary.intern(word)
+		}
+
+		grams.size = s.Size
+		grams.ids = s.IDs
+
+		if len(vocabulary.words) != len(s.Words) {
+			return errors.New("Snapshot vocabulary holds duplicate words")
+		}
+
+		for _, id := range s.IDs {
+			if int(id) >= len(s.Words) {
+				return errors.New("Snapshot grams refer to words missing from the vocabulary")
+			}
+		}
+
+		grams.rehash(2 * grams.len())
+		frequencies = s.Frequencies
+
+		for gramIndex := 0; gramIndex < grams.len(); gramIndex++ {
+			postings = indexGram(postings, grams.gram(gramIndex), gramIndex)
+		}
+	}
+
+	if frequencies == nil {
+		frequencies = []int{}
+	}
+
+	contributions := map[string]*contribution{}
+
+	for document, saved := range s.Contributions {
+		if len(saved.Grams) != len(saved.Frequencies) {
+			return errors.New("Snapshot document grams and frequencies don't match")
+		}
+
+		c := &contribution{grams: make(map[int32]int, len(saved.Grams)), documents: saved.Documents}
+
+		for i, gramIndex := range saved.Grams {
+			if gramIndex < 0 || int(gramIndex) >= len(frequencies) {
+				return errors.New("Snapshot documents refer to grams missing from the snapshot")
+			}
+
+			c.grams[gramIndex] = saved.Frequencies[i]
+		}
+
+		contributions[document] = c
+	}
+
+	sources := newVocabulary()
+
+	for _, document := range s.Sources {
+		sources.intern(document)
+	}
+
+	if len(sources.words) != len(s.Sources) || len(s.Provenance) > len(frequencies) {
+		return errors.New("Snapshot provenance doesn't match its grams")
+	}
+
+	if len(s.Weights) > len(frequencies) {
+		return errors.New("Snapshot weights don't match its grams")
+	}
+
+	totalWeight := 0.0
+
+	for _, weight := range s.Weights {
+		totalWeight += weight
+	}
+
+	for _, ids := range s.Provenance {
+		for _, id := range ids {
+			if int(id) >= len(s.Sources) {
+				return errors.New("Snapshot provenance refers to unknown documents")
+			}
+		}
+	}
+
+	gramCollection.RW.Lock()
+	defer gramCollection.RW.Unlock()
+
+	gramCollection.vocabulary = vocabulary
+	gramCollection.grams = grams
+	gramCollection.frequencies = frequencies
+	gramCollection.postings = postings
+	gramCollection.TotalFrequencies = total
+	gramCollection.overlap = overlap
+	gramCollection.contributions = contributions
+	gramCollection.sources = sources
+	gramCollection.provenance = s.Provenance
+	gramCollection.weights = s.Weights
+	gramCollection.totalWeight = totalWeight
+	gramCollection.epoch = s.Epoch
+	gramCollection.documents.Store(s.Documents)
+	gramCollection.learnedAt.Store(s.LearnedAt)
+	gramCollection.touchAll()
+
+	gramCollection.changed()
+
+	return nil
+}
+
+// SaveFile writes a snapshot of the collection to path. The snapshot is written to a temporary file first and then
+// renamed into place, so a crash part way through never leaves a truncated snapshot behind
+func (gramCollection *GramCollection) SaveFile(path string) error {
+	tmp := path + ".tmp"
+
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	if err := gramCollection.Save(file); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// LoadFile loads a snapshot previously written by SaveFile. A missing file is not an error, since there's nothing to
+// restore the first time the server runs
+func (gramCollection *GramCollection) LoadFile(path string) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	return gramCollection.Load(file)
+}
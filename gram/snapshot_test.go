@@ -0,0 +1,101 @@
+package gram
+
+import (
+	"bytes"
+	"encoding/gob"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveLoad(t *testing.T) {
+	grams := NewCollection()
+
+	grams.AddGram([]string{"this", "is", "a"})
+	grams.AddGram([]string{"is", "a", "test"})
+	grams.AddDocuments("", map[string]int{"this is a": 1}, 1)
+
+	var buf bytes.Buffer
+
+	if err := grams.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewCollection()
+
+	if err := loaded.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.TotalFrequencies != 3 {
+		t.Errorf("Expected total frequency of 3, got %d", loaded.TotalFrequencies)
+	}
+
+	if loaded.Len() != 2 || len(loaded.vocabulary.words) != 4 {
+		t.Fatalf("Expected 2 grams of 4 words, got %v", loaded.Grams())
+	}
+
+	if loaded.getIndex([]string{"this", "is", "a"}) != 0 || loaded.frequencies[0] != 2 {
+		t.Fail()
+	}
+
+	if stats := loaded.Stats(); stats.Documents != 1 || stats.LastLearned == nil {
+		t.Errorf("Expected the documents learned to be restored, got %d", stats.Documents)
+	}
+}
+
+func TestSaveLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "model.gob")
+
+	grams := NewCollection()
+
+	// loading a missing snapshot leaves the collection empty
+	if err := grams.LoadFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	grams.AddGram([]string{"fish", "swim", "blub"})
+
+	if err := grams.SaveFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Error("Expected temporary snapshot to be removed")
+	}
+
+	loaded := NewCollection()
+
+	if err := loaded.LoadFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.getIndex([]string{"fish", "swim", "blub"}) != 0 {
+		t.Fail()
+	}
+}
+
+func TestLoad_Legacy(t *testing.T) {
+	var buf bytes.Buffer
+
+	// snapshots written before words were interned hold every gram in full
+	legacy := snapshot{
+		Grams:            [][]string{{"this", "is", "a"}, {"is", "a", "test"}},
+		Frequencies:      []int{2, 1},
+		TotalFrequencies: 3,
+	}
+
+	if err := gob.NewEncoder(&buf).Encode(legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewCollection()
+
+	if err := loaded.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.Len() != 2 || loaded.Frequency([]string{"this", "is", "a"}) != 2 || loaded.TotalFrequencies != 3 {
+		t.Errorf("Unexpected grams %v loaded from a legacy snapshot", loaded.Grams())
+	}
+}
@@ -0,0 +1,82 @@
+package gram
+
+import "time"
+
+// Stats summarises what a collection has learned
+type Stats struct {
+	GramSize         int         `json:"gram_size"`
+	Grams            int         `json:"grams"`
+	TotalFrequencies int         `json:"total_frequencies"`
+	TotalWeight      float64     `json:"total_weight,omitempty"` // the total decayed weight of every gram, when HalfLife is set
+	Words            int         `json:"words"`
+	Singletons       int         `json:"singletons"`        // the number of grams seen exactly once
+	Prefixes         int         `json:"prefixes"`          // the number of distinct runs of gramSize-1 words starting a gram
+	AverageBranching float64     `json:"average_branching"` // the average number of grams starting with each prefix
+	Memory           MemoryUsage `json:"memory"`
+	Documents        int64       `json:"documents"`
+	LastLearned      *time.Time  `json:"last_learned,omitempty"`
+}
+
+// Stats summarises the collection. The grams are counted from the most recently published model, once per model, so
+// learners are only held up while memory usage is estimated, however large the collection.
+func (gramCollection *GramCollection) Stats() Stats {
+	m := gramCollection.current()
+
+	m.statsOnce.Do(func() {
+		m.stats = m.count()
+	})
+
+	stats := m.stats
+	stats.Memory = gramCollection.Memory()
+	stats.Documents = gramCollection.documents.Load()
+
+	if gramCollection.HalfLife > 0 {
+		stats.TotalWeight = gramCollection.TotalWeight()
+	}
+
+	if learnedAt := gramCollection.learnedAt.Load(); learnedAt != 0 {
+		lastLearned := time.Unix(0, learnedAt)
+		stats.LastLearned = &lastLearned
+	}
+
+	return stats
+}
+
+// count counts the grams and prefixes of the model
+func (m *model) count() Stats {
+	stats := Stats{
+		GramSize:         m.size,
+		TotalFrequencies: m.total,
+		Words:            len(m.words),
+	}
+
+	m.each(func(ids []uint32, frequency int) {
+		stats.Grams++
+
+		if frequency == 1 {
+			stats.Singletons++
+		}
+	})
+
+	m.groupPrefixes()
+	stats.Prefixes = len(m.prefixes)
+
+	if m.base != nil {
+		stats.Prefixes += len(m.base.prefixOffsets) - 1
+
+		// don't count prefixes learned since the compiled model twice
+		for _, grams := range m.prefixes {
+			first := m.gram(int(grams[0]))
+
+			if lo, hi := m.base.prefixRange(first[:len(first)-1]); lo < hi {
+				stats.Prefixes--
+			}
+		}
+	}
+
+	if stats.Prefixes > 0 {
+		stats.AverageBranching = float64(stats.Grams) / float64(stats.Prefixes)
+	}
+
+	return stats
+}
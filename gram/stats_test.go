@@ -0,0 +1,66 @@
+package gram
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	grams := NewCollection()
+
+	if stats := grams.Stats(); stats.Grams != 0 || stats.AverageBranching != 0 || stats.LastLearned != nil {
+		t.Errorf("Expected empty stats, got %+v", stats)
+	}
+
+	grams.AddDocuments("", map[string]int{"a b c": 1, "a b d": 2, "b c d": 1, "c d e": 3}, 1)
+
+	stats := grams.Stats()
+
+	if stats.GramSize != 3 || stats.Grams != 4 || stats.TotalFrequencies != 7 || stats.Words != 5 {
+		t.Errorf("Expected 4 grams of 3 over 5 words with total frequency 7, got %+v", stats)
+	}
+
+	// "a b" is followed by two words, "b c" and "c d" by one each
+	if stats.Singletons != 2 || stats.Prefixes != 3 || stats.AverageBranching != 4.0/3 {
+		t.Errorf("Expected 2 singletons and 3 prefixes, got %+v", stats)
+	}
+
+	if stats.Documents != 1 || stats.LastLearned == nil || stats.Memory.Grams != 4 {
+		t.Errorf("Expected 1 document, got %+v", stats)
+	}
+}
+
+func TestStats_Layered(t *testing.T) {
+	base := compileTestModel(t, map[string]int{"a b c": 1, "a b d": 2})
+
+	grams := NewLayeredCollection(base)
+	grams.AddGrams(map[string]int{"a b c": 1, "a b e": 1, "b c d": 1})
+
+	stats := grams.Stats()
+
+	// "a b c" is now seen twice; "a b" is a prefix of the compiled model and of the learned grams, and counted once
+	if stats.Grams != 4 || stats.Singletons != 2 || stats.Prefixes != 2 || stats.TotalFrequencies != 6 {
+		t.Errorf("Expected 4 grams, 2 singletons and 2 prefixes, got %+v", stats)
+	}
+}
+
+func TestStatsHandler(t *testing.T) {
+	grams := NewCollection()
+	grams.AddGram([]string{"a", "b", "c"})
+
+	recorder := httptest.NewRecorder()
+
+	StatsHandler(grams)(recorder, httptest.NewRequest(http.MethodGet, "/stats", nil), nil)
+
+	var stats Stats
+
+	if err := json.NewDecoder(recorder.Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+
+	if recorder.Code != http.StatusOK || stats.Grams != 1 || stats.TotalFrequencies != 1 {
+		t.Errorf("Unexpected response %d %+v", recorder.Code, stats)
+	}
+}
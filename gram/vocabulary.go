@@ -0,0 +1,168 @@
+package gram
+
+import (
+	"encoding/binary"
+	"strings"
+)
+
+// vocabulary interns words, so that each distinct word is stored once however many grams it appears in, and grams can
+// refer to words by a 4 byte ID rather than a 16 byte string header
+type vocabulary struct {
+	words []string // the word for each ID
+	ids   map[string]uint32
+}
+
+func newVocabulary() vocabulary {
+	return vocabulary{words: []string{}, ids: map[string]uint32{}}
+}
+
+// intern returns the ID of a word, adding it to the vocabulary if it hasn't been seen before. The word is copied, so
+// that the vocabulary never holds on to the larger string a word might have been sliced from.
+func (v *vocabulary) intern(word string) uint32 {
+	if id, ok := v.ids[word]; ok {
+		return id
+	}
+
+	word = strings.Clone(word)
+	id := uint32(len(v.words))
+
+	v.words = append(v.words, word)
+	v.ids[word] = id
+
+	return id
+}
+
+// lookup returns the IDs of each of the words, or false if any of the words isn't in the vocabulary
+func (v *vocabulary) lookup(words []string) ([]uint32, bool) {
+	ids := make([]uint32, len(words))
+
+	for i, word := range words {
+		id, ok := v.ids[word]
+		if !ok {
+			return nil, false
+		}
+
+		ids[i] = id
+	}
+
+	return ids, true
+}
+
+// gramTable stores fixed size grams as packed tuples of word IDs, along with an open addressing hash table for finding
+// the index of a gram without comparing it against every other gram
+type gramTable struct {
+	size  int      // the number of words in each gram, set by the first gram added
+	ids   []uint32 // gram i is ids[i*size : (i+1)*size]
+	slots []uint32 // each slot holds a gram index plus one, or 0 if the slot is empty
+}
+
+func (t *gramTable) len() int {
+	if t.size == 0 {
+		return 0
+	}
+
+	return len(t.ids) / t.size
+}
+
+func (t *gramTable) gram(index int) []uint32 {
+	return t.ids[index*t.size : (index+1)*t.size : (index+1)*t.size]
+}
+
+// hashIDs is FNV-1a over the bytes of each ID
+func hashIDs(ids []uint32) uint32 {
+	hash := uint32(2166136261)
+
+	for _, id := range ids {
+		for i := 0; i < 4; i++ {
+			hash ^= (id >> (8 * i)) & 0xff
+			hash *= 16777619
+		}
+	}
+
+	return hash
+}
+
+// find returns the index of a gram, or -1 if the table doesn't hold it
+func (t *gramTable) find(ids []uint32) int {
+	if len(t.slots) == 0 || len(ids) != t.size {
+		return -1
+	}
+
+	mask := uint32(len(t.slots) - 1)
+
+	for slot := hashIDs(ids) & mask; t.slots[slot] != 0; slot = (slot + 1) & mask {
+		index := int(t.slots[slot] - 1)
+
+		if equalIDs(t.gram(index), ids) {
+			return index
+		}
+	}
+
+	return -1
+}
+
+// insert appends a gram which isn't already in the table, returning its index
+func (t *gramTable) insert(ids []uint32) int {
+	if t.size == 0 {
+		t.size = len(ids)
+	}
+
+	index := t.len()
+	t.ids = append(t.ids, ids...)
+
+	// keep the table at most half full, so that probe sequences stay short
+	if 2*(index+1) > len(t.slots) {
+		t.rehash(2 * len(t.slots))
+	} else {
+		t.place(index)
+	}
+
+	return index
+}
+
+func (t *gramTable) place(index int) {
+	mask := uint32(len(t.slots) - 1)
+	slot := hashIDs(t.gram(index)) & mask
+
+	for t.slots[slot] != 0 {
+		slot = (slot + 1) & mask
+	}
+
+	t.slots[slot] = uint32(index + 1)
+}
+
+// rehash rebuilds the hash table with at least the given number of slots, rounded up to a power of two
+func (t *gramTable) rehash(minimum int) {
+	slots := 16
+
+	for slots < minimum {
+		slots *= 2
+	}
+
+	t.slots = make([]uint32, slots)
+
+	for index := 0; index < t.len(); index++ {
+		t.place(index)
+	}
+}
+
+func equalIDs(a, b []uint32) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// prefixKey packs IDs into a string, for use as a map key
+func prefixKey(ids []uint32) string {
+	key := make([]byte, 4*len(ids))
+
+	for i, id := range ids {
+		binary.LittleEndian.PutUint32(key[4*i:], id)
+	}
+
+	return string(key)
+}
@@ -0,0 +1,46 @@
+package gram
+
+import (
+	"testing"
+)
+
+func TestVocabulary(t *testing.T) {
+	v := newVocabulary()
+
+	text := "the cat sat on the mat"
+	a := v.intern(text[4:7])
+	b := v.intern("cat")
+
+	if a != b || len(v.words) != 1 || v.words[a] != "cat" {
+		t.Errorf("Expected a single interned word, got %v", v.words)
+	}
+
+	if _, ok := v.lookup([]string{"cat", "dog"}); ok {
+		t.Error("Expected lookup of an unknown word to fail")
+	}
+}
+
+func TestGramTable(t *testing.T) {
+	table := gramTable{}
+
+	// enough grams to grow the hash table several times
+	for i := uint32(0); i < 10000; i++ {
+		if index := table.insert([]uint32{i, i * 7, i % 3}); index != int(i) {
+			t.Fatalf("Expected gram %d to be inserted at %d, got %d", i, i, index)
+		}
+	}
+
+	for i := uint32(0); i < 10000; i++ {
+		if index := table.find([]uint32{i, i * 7, i % 3}); index != int(i) {
+			t.Fatalf("Expected to find gram %d, got %d", i, index)
+		}
+	}
+
+	if table.find([]uint32{1, 2, 3}) != -1 || table.find([]uint32{1, 7}) != -1 {
+		t.Error("Expected missing grams not to be found")
+	}
+
+	if 2*table.len() > len(table.slots) {
+		t.Errorf("Expected the hash table to stay at most half full, got %d grams in %d slots", table.len(), len(table.slots))
+	}
+}
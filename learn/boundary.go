@@ -0,0 +1,105 @@
+package learn
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// Boundary describes where a single document should be split into separately learned segments. Grams never span a
+// boundary, and the boundary lines themselves are not learned.
+type Boundary struct {
+	Paragraphs bool   // split at blank lines
+	Delimiter  string // split at lines consisting of just this delimiter, e.g. "---"
+}
+
+func (boundary Boundary) none() bool {
+	return !boundary.Paragraphs && boundary.Delimiter == ""
+}
+
+// isBoundary reports whether a complete line marks a boundary
+func (boundary Boundary) isBoundary(line []byte) bool {
+	trimmed := bytes.TrimSpace(line)
+
+	if boundary.Paragraphs && len(trimmed) == 0 {
+		return true
+	}
+
+	return boundary.Delimiter != "" && string(trimmed) == boundary.Delimiter
+}
+
+// segmenter reads a single segment of a document at a time, reporting io.EOF at each boundary
+type segmenter struct {
+	reader    *bufio.Reader
+	boundary  Boundary
+	lineStart bool
+	atEnd     bool // the current segment has ended
+	eof       bool // the document has ended
+	pending   []byte
+}
+
+// segments splits r at each boundary, calling learn with a reader for each segment in turn
+func segments(r io.Reader, boundary Boundary, learn func(io.Reader) error) error {
+	if boundary.none() {
+		return learn(r)
+	}
+
+	s := &segmenter{reader: bufio.NewReader(r), boundary: boundary, lineStart: true}
+
+	for !s.eof {
+		s.atEnd = false
+
+		if err := learn(s); err != nil {
+			return err
+		}
+
+		// skip anything the segment's reader left unread, so that the next segment starts after the boundary
+		if _, err := io.Copy(io.Discard, s); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *segmenter) Read(p []byte) (int, error) {
+	for len(s.pending) == 0 {
+		if s.atEnd || s.eof {
+			return 0, io.EOF
+		}
+
+		if err := s.fill(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+
+	return n, nil
+}
+
+// fill reads the next line, or the next part of a long line, ending the segment if it is a boundary line
+func (s *segmenter) fill() error {
+	fragment, err := s.reader.ReadSlice('\n')
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return err
+	}
+
+	if err == io.EOF {
+		s.eof = true
+	}
+
+	atLineStart := s.lineStart
+	s.lineStart = err != bufio.ErrBufferFull
+
+	// a line too long for the buffer is never a boundary, so only complete lines need to be checked
+	if atLineStart && s.lineStart && s.boundary.isBoundary(fragment) && (len(fragment) > 0 || !s.eof) {
+		s.atEnd = true
+		return nil
+	}
+
+	s.pending = append(s.pending[:0], fragment...)
+
+	return nil
+}
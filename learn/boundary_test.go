@@ -0,0 +1,114 @@
+package learn
+
+import (
+	"github.com/fergloragain/trigrams/gram"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestSegments(t *testing.T) {
+	tt := []struct {
+		Boundary Boundary
+		Text     string
+		Expected []string
+	}{
+		{
+			Boundary: Boundary{},
+			Text:     "one\n\ntwo\n---\nthree",
+			Expected: []string{"one\n\ntwo\n---\nthree"},
+		},
+		{
+			Boundary: Boundary{Paragraphs: true},
+			Text:     "one\nstill one\n  \t\ntwo\r\n\r\nthree",
+			Expected: []string{"one\nstill one\n", "two\r\n", "three"},
+		},
+		{
+			Boundary: Boundary{Delimiter: "---"},
+			Text:     "one\n\ntwo\n --- \nthree --- four\n---\n",
+			Expected: []string{"one\n\ntwo\n", "three --- four\n", ""},
+		},
+		{
+			Boundary: Boundary{Paragraphs: true, Delimiter: "%%"},
+			Text:     "one\n%%\ntwo\n\nthree\n",
+			Expected: []string{"one\n", "two\n", "three\n"},
+		},
+		{
+			// a line much longer than the read buffer is passed through intact
+			Boundary: Boundary{Paragraphs: true},
+			Text:     strings.Repeat("word ", 2000) + "\n\nend",
+			Expected: []string{strings.Repeat("word ", 2000) + "\n", "end"},
+		},
+	}
+
+	for _, test := range tt {
+		for _, reader := range []io.Reader{strings.NewReader(test.Text), iotest.OneByteReader(strings.NewReader(test.Text))} {
+			found := []string{}
+
+			err := segments(reader, test.Boundary, func(segment io.Reader) error {
+				text, err := io.ReadAll(segment)
+				found = append(found, string(text))
+				return err
+			})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(found) != len(test.Expected) {
+				t.Errorf("Expected %d segments, got %q", len(test.Expected), found)
+				continue
+			}
+
+			for i := range found {
+				if found[i] != test.Expected[i] {
+					t.Errorf("Expected %q, got %q", test.Expected, found)
+				}
+			}
+		}
+	}
+}
+
+func TestSegments_PartialRead(t *testing.T) {
+	found := []string{}
+
+	// a learner which stops reading part way through a segment doesn't leak the rest into the next segment
+	err := segments(strings.NewReader("one two\n\nthree"), Boundary{Paragraphs: true}, func(segment io.Reader) error {
+		buf := make([]byte, 3)
+		n, _ := segment.Read(buf)
+		found = append(found, string(buf[:n]))
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(found) != 2 || found[0] != "one" || found[1] != "thr" {
+		t.Errorf("Unexpected segments %q", found)
+	}
+}
+
+func TestProcess_Paragraphs(t *testing.T) {
+	task := &Task{
+		Body:     ioutil.NopCloser(strings.NewReader("A B\n\nC D")),
+		Boundary: Boundary{Paragraphs: true},
+		Gram:     gram.NewCollection(),
+	}
+
+	if err := task.Process(2, false, regexReplacements); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(task.Gram.Grams()) != 2 {
+		t.Fatalf("Expected 2 grams, got %v", task.Gram.Grams())
+	}
+
+	for _, g := range task.Gram.Grams() {
+		if g[0] == "B" && g[1] == "C" {
+			t.Error("Expected no gram to span two paragraphs")
+		}
+	}
+}
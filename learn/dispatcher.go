@@ -1,41 +1,70 @@
 package learn
 
+import (
+	"context"
+	"github.com/fergloragain/trigrams/pool"
+)
+
 type LearnDispatcher struct {
 	numberOfWorkers int
-	WorkerPool      chan chan Task
+	queueSize       int
+	pool            *pool.Pool[Task, struct{}]
 }
 
-// Create a generation dispatcher, specifying a number of workers to read from the queue of learn tasks
-func NewDispatcher(maxWorkers int) *LearnDispatcher {
-	pool := make(chan chan Task, maxWorkers)
-	return &LearnDispatcher{WorkerPool: pool, numberOfWorkers: maxWorkers}
+// Create a learn dispatcher, specifying a number of workers to process learn tasks and the number of tasks that may
+// wait in the queue for a free worker
+func NewDispatcher(maxWorkers, maxQueue int) *LearnDispatcher {
+	return &LearnDispatcher{numberOfWorkers: maxWorkers, queueSize: maxQueue}
 }
 
-// Run the learn dispatcher by launching each worker and then listening to the learn queue
-func (dispatcher *LearnDispatcher) Run(learnQueue chan Task, gramSize int, strip bool) {
-	// starting n number of workers
-	for i := 0; i < dispatcher.numberOfWorkers; i++ {
-		worker := NewWorker(dispatcher.WorkerPool)
-		worker.Start(gramSize, strip)
-	}
+// Run the learn dispatcher by starting a pool of workers, each of which processes learn tasks into grams of the given
+// size. Unless a task says otherwise, a large document is split into as many shards as there are workers, and the shards
+// learned in parallel.
+func (dispatcher *LearnDispatcher) Run(gramSize int, strip bool) {
+	dispatcher.pool = pool.New(dispatcher.numberOfWorkers, dispatcher.queueSize, func(task Task) (struct{}, error) {
+		if task.Shards == 0 {
+			task.Shards = dispatcher.numberOfWorkers
+		}
+
+		return struct{}{}, task.Process(gramSize, strip, regexReplacements)
+	})
 
-	go dispatcher.dispatch(learnQueue)
+	dispatcher.pool.Start()
 }
 
-// listen to the learn queue and once a learn request comes in, retrieve a worker from the worker pool and
-// hand the request off to the worker for processing
-func (dispatcher *LearnDispatcher) dispatch(learnQueue chan Task) {
-	for {
-		select {
-		// listen for a learn request
-		case learnTask := <-learnQueue:
-			go func(task Task) {
-				// obtain a worker from the worker pool
-				learnWorker := <-dispatcher.WorkerPool
+// Learn queues a learn task, blocking while the queue is full, and waits for a worker to finish processing it
+func (dispatcher *LearnDispatcher) Learn(task Task) error {
+	_, err := dispatcher.pool.Do(task)
+	return err
+}
 
-				// dispatch the job to the worker job channel
-				learnWorker <- task
-			}(learnTask)
-		}
+// LearnAsync queues a learn task without waiting for it to be processed, calling done with the outcome once a worker
+// has finished with it. If the queue is full, pool.ErrQueueFull is returned and done is never called.
+func (dispatcher *LearnDispatcher) LearnAsync(task Task, done func(error)) error {
+	result, err := dispatcher.pool.TrySubmit(task)
+	if err != nil {
+		return err
 	}
+
+	go func() {
+		done((<-result).Err)
+	}()
+
+	return nil
+}
+
+// Resize changes the number of workers processing learn tasks
+func (dispatcher *LearnDispatcher) Resize(workers int) {
+	dispatcher.pool.Resize(workers)
+}
+
+// Stats reports the size and activity of the worker pool
+func (dispatcher *LearnDispatcher) Stats() pool.Stats {
+	return dispatcher.pool.Stats()
+}
+
+// Stop stops accepting learn tasks and waits for the workers to finish everything already queued. If ctx expires
+// first, the context error is returned.
+func (dispatcher *LearnDispatcher) Stop(ctx context.Context) error {
+	return dispatcher.pool.Stop(ctx)
 }
@@ -1,46 +1,89 @@
 package learn
 
 import (
+	"context"
 	"github.com/fergloragain/trigrams/gram"
 	"io/ioutil"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestNewDispatcher(t *testing.T) {
-	d := NewDispatcher(1)
+	d := NewDispatcher(1, 2)
 
-	if d.WorkerPool == nil {
+	if d.numberOfWorkers != 1 {
 		t.Fail()
 	}
 
-	if d.numberOfWorkers != 1 {
+	if d.queueSize != 2 {
 		t.Fail()
 	}
 }
 
 func TestRun(t *testing.T) {
-	d := NewDispatcher(1)
+	d := NewDispatcher(1, 1)
 
-	if d.WorkerPool == nil {
-		t.Fail()
+	d.Run(1, false)
+
+	if d.pool == nil {
+		t.Fatal("Expected Run to start a worker pool")
 	}
 
-	if d.numberOfWorkers != 1 {
+	reader := strings.NewReader("")
+	r := ioutil.NopCloser(reader)
+
+	err := d.Learn(Task{
+		Body: r,
+		Gram: gram.NewCollection(),
+	})
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	if d.Stats().Completed != 1 {
 		t.Fail()
 	}
+}
 
-	learnQueue := make(chan Task)
+func TestDispatcherStop(t *testing.T) {
+	d := NewDispatcher(2, 2)
 
-	go d.Run(learnQueue, 1, false)
+	d.Run(1, false)
 
-	reader := strings.NewReader("")
+	gramCollection := gram.NewCollection()
 
-	r := ioutil.NopCloser(reader)
+	done := make(chan error, 2)
 
-	learnQueue <- Task{
-		Body: r,
-		Gram: gram.NewCollection(),
+	for _, text := range []string{"A B", "C D"} {
+		go func(text string) {
+			done <- d.Learn(Task{
+				Body: ioutil.NopCloser(strings.NewReader(text)),
+				Gram: gramCollection,
+			})
+		}(text)
+	}
+
+	for d.Stats().Submitted != 2 {
+		time.Sleep(time.Millisecond)
 	}
 
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := d.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// every queued task has been processed by the time Stop returns
+	if d.Stats().Completed != 2 {
+		t.Error("Expected queued tasks to be processed")
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	}
 }
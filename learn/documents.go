@@ -0,0 +1,224 @@
+package learn
+
+import (
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// BodyError is returned when a body can't be learned because it's malformed, such as a corrupt archive or compressed
+// stream, a broken multipart upload, or a record which can't be parsed, rather than because of a fault on the server
+type BodyError struct {
+	Err error
+}
+
+func (e BodyError) Error() string {
+	return e.Err.Error()
+}
+
+func (e BodyError) Unwrap() error {
+	return e.Err
+}
+
+// malformed marks an error as the fault of the body being learned
+func malformed(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return BodyError{err}
+}
+
+// malformedReader marks the errors reading a decoded body, other than io.EOF, as the fault of the body
+type malformedReader struct {
+	reader io.Reader
+}
+
+func (r malformedReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if err != nil && err != io.EOF {
+		err = malformed(err)
+	}
+
+	return n, err
+}
+
+// Document is a single text within a learn request. A plain request body is a single document, whereas a multipart
+// upload or an archive may hold many.
+type Document struct {
+	Name      string
+	MediaType string
+	Body      io.Reader
+}
+
+// documents decodes body according to its content encoding and content type, and calls learn with each document it
+// contains, in order. Everything is streamed, except for zip archives, which must be copied to a temporary file since
+// their index lives at the end of the archive.
+func documents(body io.Reader, contentType, contentEncoding string, learn func(Document) error) error {
+	decoded, err := decode(body, contentEncoding)
+	if err != nil {
+		return err
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+
+	if mediaType == "multipart/form-data" {
+		return multipartDocuments(decoded, params["boundary"], learn)
+	}
+
+	return archiveDocuments(Document{MediaType: mediaType, Body: decoded}, learn)
+}
+
+// decode undoes a Content-Encoding of gzip or deflate
+func decode(body io.Reader, contentEncoding string) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(contentEncoding)) {
+	case "", "identity":
+		return body, nil
+	case "gzip", "x-gzip":
+		decoded, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, malformed(err)
+		}
+
+		return malformedReader{decoded}, nil
+	case "deflate":
+		// the HTTP deflate encoding is a zlib stream, not raw deflate
+		decoded, err := zlib.NewReader(body)
+		if err != nil {
+			return nil, malformed(err)
+		}
+
+		return malformedReader{decoded}, nil
+	default:
+		return nil, malformed(fmt.Errorf("Unsupported content encoding %s", contentEncoding))
+	}
+}
+
+// multipartDocuments treats each file in a multipart/form-data upload as a separate document. Form fields which aren't
+// files are ignored.
+func multipartDocuments(body io.Reader, boundary string, learn func(Document) error) error {
+	if boundary == "" {
+		return malformed(fmt.Errorf("Multipart upload has no boundary"))
+	}
+
+	reader := multipart.NewReader(body, boundary)
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return malformed(err)
+		}
+
+		if part.FileName() == "" {
+			part.Close()
+			continue
+		}
+
+		mediaType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+
+		err = archiveDocuments(Document{Name: part.FileName(), MediaType: mediaType, Body: malformedReader{part}}, learn)
+
+		part.Close()
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// archiveDocuments unpacks a gzip or zip archive, recognised either by its media type or its file extension, into its
+// documents. Anything else is learned as a single document.
+func archiveDocuments(document Document, learn func(Document) error) error {
+	extension := strings.ToLower(path.Ext(document.Name))
+	mediaType := document.MediaType
+
+	switch {
+	case mediaType == "application/gzip" || mediaType == "application/x-gzip" || extension == ".gz":
+		uncompressed, err := gzip.NewReader(document.Body)
+		if err != nil {
+			return malformed(err)
+		}
+
+		return learn(Document{Name: strings.TrimSuffix(document.Name, path.Ext(document.Name)), Body: malformedReader{uncompressed}})
+	case mediaType == "application/zip" || mediaType == "application/x-zip-compressed" || extension == ".zip":
+		return zipDocuments(document.Body, learn)
+	default:
+		return learn(document)
+	}
+}
+
+// zipDocuments learns each text file in a zip archive as a separate document. Whether a file holds text is sniffed from
+// its first few bytes, so that images and other binaries packed alongside the text are skipped.
+func zipDocuments(body io.Reader, learn func(Document) error) error {
+	file, err := spool(io.NopCloser(body))
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	archive, err := zip.NewReader(file, info.Size())
+	if err != nil {
+		return malformed(err)
+	}
+
+	for _, entry := range archive.File {
+		if entry.FileInfo().IsDir() {
+			continue
+		}
+
+		contents, err := entry.Open()
+		if err != nil {
+			return malformed(err)
+		}
+
+		body := bufio.NewReader(malformedReader{contents})
+
+		if text, err := isText(body); err != nil || !text {
+			contents.Close()
+
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		err = learn(Document{Name: entry.Name, Body: body})
+
+		contents.Close()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isText sniffs the start of a body to see whether it holds text, without consuming it
+func isText(body *bufio.Reader) (bool, error) {
+	start, err := body.Peek(512)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return false, err
+	}
+
+	return strings.HasPrefix(http.DetectContentType(start), "text/"), nil
+}
@@ -0,0 +1,193 @@
+package learn
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"github.com/fergloragain/trigrams/gram"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"testing"
+)
+
+func gzipped(text string) []byte {
+	var buf bytes.Buffer
+
+	w := gzip.NewWriter(&buf)
+	w.Write([]byte(text))
+	w.Close()
+
+	return buf.Bytes()
+}
+
+func deflated(text string) []byte {
+	var buf bytes.Buffer
+
+	w := zlib.NewWriter(&buf)
+	w.Write([]byte(text))
+	w.Close()
+
+	return buf.Bytes()
+}
+
+func zipped(files map[string]string, order []string) []byte {
+	var buf bytes.Buffer
+
+	w := zip.NewWriter(&buf)
+
+	for _, name := range order {
+		f, _ := w.Create(name)
+		f.Write([]byte(files[name]))
+	}
+
+	w.Close()
+
+	return buf.Bytes()
+}
+
+// multipartBody builds a form with a plain field followed by the given files, returning the body and its content type
+func multipartBody(names []string, contents [][]byte) ([]byte, string) {
+	var buf bytes.Buffer
+
+	w := multipart.NewWriter(&buf)
+
+	w.WriteField("comment", "this field is not learned")
+
+	for i, name := range names {
+		f, _ := w.CreateFormFile("files", name)
+		f.Write(contents[i])
+	}
+
+	w.Close()
+
+	return buf.Bytes(), w.FormDataContentType()
+}
+
+func TestDocuments(t *testing.T) {
+	form, formType := multipartBody(
+		[]string{"a.txt", "b.txt.gz", "c.zip"},
+		[][]byte{
+			[]byte("first file"),
+			gzipped("second file"),
+			zipped(map[string]string{"d.txt": "third file", "e.txt": "fourth file"}, []string{"d.txt", "e.txt"}),
+		},
+	)
+
+	tt := []struct {
+		Body            []byte
+		ContentType     string
+		ContentEncoding string
+		Expected        []string
+		Error           bool
+	}{
+		{
+			Body:     []byte("plain text"),
+			Expected: []string{"plain text"},
+		},
+		{
+			Body:            gzipped("gzip encoded"),
+			ContentEncoding: "gzip",
+			Expected:        []string{"gzip encoded"},
+		},
+		{
+			Body:            deflated("deflate encoded"),
+			ContentEncoding: "deflate",
+			Expected:        []string{"deflate encoded"},
+		},
+		{
+			Body:        gzipped("gzip archive"),
+			ContentType: "application/gzip",
+			Expected:    []string{"gzip archive"},
+		},
+		{
+			Body:        zipped(map[string]string{"a.txt": "one", "dir/b.txt": "two"}, []string{"a.txt", "dir/b.txt"}),
+			ContentType: "application/zip",
+			Expected:    []string{"one", "two"},
+		},
+		{
+			// binaries packed alongside the text are skipped
+			Body:        zipped(map[string]string{"a.txt": "one", "b.png": "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"}, []string{"a.txt", "b.png"}),
+			ContentType: "application/zip",
+			Expected:    []string{"one"},
+		},
+		{
+			Body:        form,
+			ContentType: formType,
+			Expected:    []string{"first file", "second file", "third file", "fourth file"},
+		},
+		{
+			Body:            []byte("plain text"),
+			ContentEncoding: "br",
+			Error:           true,
+		},
+		{
+			Body:        []byte("no boundary"),
+			ContentType: "multipart/form-data",
+			Error:       true,
+		},
+	}
+
+	for _, test := range tt {
+		found := []string{}
+
+		err := documents(bytes.NewReader(test.Body), test.ContentType, test.ContentEncoding, func(document Document) error {
+			text, err := io.ReadAll(document.Body)
+			found = append(found, string(text))
+			return err
+		})
+
+		if test.Error {
+			if err == nil {
+				t.Errorf("Expected an error for %q", test.ContentEncoding+test.ContentType)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if len(found) != len(test.Expected) {
+			t.Errorf("Expected %v, got %v", test.Expected, found)
+			continue
+		}
+
+		for i := range found {
+			if found[i] != test.Expected[i] {
+				t.Errorf("Expected %v, got %v", test.Expected, found)
+			}
+		}
+	}
+}
+
+func TestProcess_Multipart(t *testing.T) {
+	form, formType := multipartBody([]string{"a.txt", "b.txt"}, [][]byte{[]byte("A B"), []byte("C D")})
+
+	task := &Task{
+		Body:        ioutil.NopCloser(bytes.NewReader(form)),
+		ContentType: formType,
+		Gram:        gram.NewCollection(),
+	}
+
+	if err := task.Process(2, false, regexReplacements); err != nil {
+		t.Fatal(err)
+	}
+
+	// each file is learned separately, so there is no [B C] gram spanning the two files
+	if len(task.Gram.Grams()) != 2 {
+		t.Fatalf("Expected 2 grams, got %v", task.Gram.Grams())
+	}
+
+	for _, g := range task.Gram.Grams() {
+		if g[0] == "B" && g[1] == "C" {
+			t.Error("Expected no gram to span two files")
+		}
+	}
+
+	if stats := task.Gram.Stats(); stats.Documents != 2 || stats.LastLearned == nil {
+		t.Errorf("Expected 2 documents to have been learned, got %d", stats.Documents)
+	}
+}
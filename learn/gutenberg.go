@@ -0,0 +1,197 @@
+package learn
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+)
+
+// GutenbergHeaderLimit is the number of bytes searched for a Project Gutenberg start marker. If no marker turns up
+// within the limit, the text is assumed not to be a Gutenberg text and is passed through untouched.
+const GutenbergHeaderLimit = 64 * 1024
+
+const (
+	gutenbergSearching = iota
+	gutenbergCredits
+	gutenbergBody
+	gutenbergDone
+)
+
+// gutenbergReader strips the Project Gutenberg licence header and footer from a text, leaving only the body
+type gutenbergReader struct {
+	reader    *bufio.Reader
+	state     int
+	header    bytes.Buffer
+	pending   []byte // what's left of buffer to be read
+	buffer    []byte
+	lineStart bool
+}
+
+// StripGutenberg returns a reader which yields only the body of a Project Gutenberg text; that is, everything between
+// the "*** START OF ..." and "*** END OF ..." markers (or their common variants), excluding the marker lines
+// themselves and any "Produced by ..." credits paragraph immediately following the start marker. Text without a start
+// marker is passed through, although anything from an end marker onwards is still dropped.
+func StripGutenberg(r io.Reader) io.Reader {
+	return &gutenbergReader{reader: bufio.NewReader(r), lineStart: true}
+}
+
+func (g *gutenbergReader) Read(p []byte) (int, error) {
+	for len(g.pending) == 0 {
+		if g.state == gutenbergDone {
+			return 0, io.EOF
+		}
+
+		if err := g.fill(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, g.pending)
+	g.pending = g.pending[n:]
+
+	return n, nil
+}
+
+// fill reads the next line, or part of a line, and decides whether it should be passed on. Lines are read in fragments
+// no longer than the reader's buffer, so that a text without line breaks is never held in memory all at once.
+func (g *gutenbergReader) fill() error {
+	if g.state == gutenbergCredits {
+		return g.skipCredits()
+	}
+
+	fragment, atLineStart, err := g.next()
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	if g.state == gutenbergSearching {
+		if atLineStart && isGutenbergStart(string(fragment)) {
+			// everything up to and including the start marker is licence header
+			g.header.Reset()
+			g.state = gutenbergCredits
+			return nil
+		}
+
+		g.header.Write(fragment)
+
+		if err == io.EOF || g.header.Len() > GutenbergHeaderLimit {
+			// not a Gutenberg text, or at least not one we recognise; hand back what we've held on to and carry on
+			// looking for an end marker only
+			g.pending = append([]byte{}, g.header.Bytes()...)
+			g.header.Reset()
+			g.state = gutenbergBody
+
+			if err == io.EOF {
+				g.state = gutenbergDone
+			}
+		}
+
+		return nil
+	}
+
+	if atLineStart && isGutenbergEnd(string(fragment)) {
+		g.state = gutenbergDone
+		return nil
+	}
+
+	g.buffer = append(g.buffer[:0], fragment...)
+	g.pending = g.buffer
+
+	if err == io.EOF {
+		g.state = gutenbergDone
+	}
+
+	return nil
+}
+
+// next reads the next line, or as much of it as fits in the reader's buffer, along with whether it starts a line. The
+// fragment is only valid until the next read.
+func (g *gutenbergReader) next() ([]byte, bool, error) {
+	fragment, err := g.reader.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		err = nil
+	}
+
+	atLineStart := g.lineStart
+	g.lineStart = bytes.HasSuffix(fragment, []byte("\n"))
+
+	return fragment, atLineStart, err
+}
+
+// skipCredits drops a "Produced by ..." paragraph if it is the first thing after the start marker. Blank lines before
+// the paragraph are skipped too, since they carry nothing to learn, as is the rest of a start marker too long to have
+// been read in one go.
+func (g *gutenbergReader) skipCredits() error {
+	fragment, atLineStart, err := g.next()
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	if err == io.EOF {
+		g.state = gutenbergDone
+	}
+
+	if !atLineStart || len(bytes.TrimSpace(fragment)) == 0 {
+		return nil
+	}
+
+	if !strings.HasPrefix(normaliseMarker(string(fragment)), "PRODUCED BY") {
+		g.buffer = append(g.buffer[:0], fragment...)
+		g.pending = g.buffer
+
+		if err == nil {
+			g.state = gutenbergBody
+		}
+
+		return nil
+	}
+
+	for err == nil {
+		fragment, atLineStart, err = g.next()
+
+		if atLineStart && len(bytes.TrimSpace(fragment)) == 0 {
+			break
+		}
+	}
+
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	g.state = gutenbergBody
+
+	if err == io.EOF {
+		g.state = gutenbergDone
+	}
+
+	return nil
+}
+
+func normaliseMarker(line string) string {
+	return strings.ToUpper(strings.TrimSpace(strings.TrimPrefix(line, "\ufeff")))
+}
+
+// isGutenbergStart recognises "*** START OF THE PROJECT GUTENBERG EBOOK ... ***", "***START OF THIS PROJECT GUTENBERG
+// EBOOK ...", and the end of the "small print" header used by older texts
+func isGutenbergStart(line string) bool {
+	marker := normaliseMarker(line)
+
+	if strings.HasPrefix(marker, "*END*THE SMALL PRINT") {
+		return true
+	}
+
+	return strings.HasPrefix(marker, "***") && strings.Contains(marker, "START OF") && strings.Contains(marker, "PROJECT GUTENBERG")
+}
+
+// isGutenbergEnd recognises "*** END OF THE PROJECT GUTENBERG EBOOK ... ***" and its variants, along with the "End of
+// the Project Gutenberg EBook of ..." line which often precedes it
+func isGutenbergEnd(line string) bool {
+	marker := normaliseMarker(line)
+
+	if strings.HasPrefix(marker, "END OF THE PROJECT GUTENBERG") || strings.HasPrefix(marker, "END OF PROJECT GUTENBERG") {
+		return true
+	}
+
+	return strings.HasPrefix(marker, "***") && strings.Contains(marker, "END OF") && strings.Contains(marker, "PROJECT GUTENBERG")
+}
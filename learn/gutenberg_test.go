@@ -0,0 +1,159 @@
+package learn
+
+import (
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestStripGutenberg(t *testing.T) {
+	tt := []struct {
+		Text     string
+		Expected string
+	}{
+		{
+			Text: `The Project Gutenberg EBook of Something
+Licence text
+
+*** START OF THIS PROJECT GUTENBERG EBOOK SOMETHING ***
+
+Produced by Someone
+and Someone Else
+
+It was a dark
+and stormy night.
+*** END OF THIS PROJECT GUTENBERG EBOOK SOMETHING ***
+More licence text
+`,
+			Expected: "It was a dark\nand stormy night.\n",
+		},
+		{
+			Text: `Header
+***START OF THE PROJECT GUTENBERG EBOOK SOMETHING***
+Body text
+End of the Project Gutenberg EBook of Something
+*** END OF THE PROJECT GUTENBERG EBOOK SOMETHING ***`,
+			Expected: "Body text\n",
+		},
+		{
+			Text: `Old style header
+*END*THE SMALL PRINT! FOR PUBLIC DOMAIN ETEXTS*Ver.04.29.93*END*
+Body text
+End of Project Gutenberg's Something
+`,
+			Expected: "Body text\n",
+		},
+		{
+			// no markers at all, so nothing is stripped
+			Text:     "Just some text\nwith no markers",
+			Expected: "Just some text\nwith no markers",
+		},
+		{
+			// an end marker only ends the text at the start of a line
+			Text:     "Body mentioning *** END OF THE PROJECT GUTENBERG EBOOK\nmore body\n",
+			Expected: "Body mentioning *** END OF THE PROJECT GUTENBERG EBOOK\nmore body\n",
+		},
+	}
+
+	for _, test := range tt {
+		for _, reader := range []io.Reader{strings.NewReader(test.Text), iotest.OneByteReader(strings.NewReader(test.Text))} {
+			result, err := io.ReadAll(StripGutenberg(reader))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(result) != test.Expected {
+				t.Errorf("Expected >%s<, got >%s<", test.Expected, string(result))
+			}
+		}
+	}
+}
+
+func TestStripGutenberg_HeaderLimit(t *testing.T) {
+	text := strings.Repeat("a line of text without any markers\n", GutenbergHeaderLimit/10)
+
+	result, err := io.ReadAll(StripGutenberg(strings.NewReader(text)))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(result) != text {
+		t.Error("Expected text without a start marker to be passed through")
+	}
+}
+
+// endless is an endless run of a single byte
+type endless byte
+
+func (e endless) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(e)
+	}
+
+	return len(p), nil
+}
+
+// allocated returns the number of bytes allocated while fn runs
+func allocated(fn func()) uint64 {
+	var before, after runtime.MemStats
+
+	runtime.ReadMemStats(&before)
+	fn()
+	runtime.ReadMemStats(&after)
+
+	return after.TotalAlloc - before.TotalAlloc
+}
+
+func TestStripGutenberg_SingleLine(t *testing.T) {
+	const size = 64 * 1024 * 1024
+
+	var n int64
+	var err error
+
+	// a text without a single line break is passed through a fragment at a time, rather than read in whole before the
+	// header limit is checked
+	bytes := allocated(func() {
+		n, err = io.Copy(io.Discard, StripGutenberg(io.LimitReader(endless('a'), size)))
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != size {
+		t.Errorf("Expected %d bytes to be passed through, got %d", size, n)
+	}
+
+	if bytes > size/16 {
+		t.Errorf("Expected a text without line breaks to be read in bounded fragments, but %d bytes were allocated", bytes)
+	}
+}
+
+func TestStripGutenberg_PridePrejudice(t *testing.T) {
+	file, err := os.Open("../pride-prejudice.txt")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	defer file.Close()
+
+	result, err := io.ReadAll(StripGutenberg(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := strings.TrimSpace(string(result))
+
+	if strings.Contains(strings.ToLower(text), "gutenberg") {
+		t.Error("Expected all mentions of Project Gutenberg to be stripped")
+	}
+
+	if !strings.HasPrefix(text, "PRIDE AND PREJUDICE") {
+		t.Errorf("Expected text to start with the title, got >%.40s<", text)
+	}
+}
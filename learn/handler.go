@@ -2,23 +2,185 @@ package learn
 
 import (
 	"github.com/fergloragain/trigrams/gram"
+	"github.com/fergloragain/trigrams/pool"
 	"github.com/julienschmidt/httprouter"
+	"github.com/pkg/errors"
+	"io"
+	"log"
 	"net/http"
+	"os"
+	"strconv"
 )
 
-func Handler(gram *gram.GramCollection, learnQueue chan Task) func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+func Handler(gramCollection *gram.GramCollection, dispatcher *LearnDispatcher, jobs *Jobs) func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
 
 	return func(writer http.ResponseWriter, request *http.Request, p httprouter.Params) {
+
 		job := Task{
-			Body: request.Body,
-			Gram: gram,
-			Done: make(chan int),
+			Body:            request.Body,
+			ContentType:     request.Header.Get("Content-Type"),
+			ContentEncoding: request.Header.Get("Content-Encoding"),
+			Gram:            gramCollection,
+			Context:         request.Context(),
+			Document:        newID(),
+		}
+
+		preprocessors, err := ParsePreprocessors(request.URL.Query().Get("preprocess"))
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		job.Preprocessors = preprocessors
+
+		job.Format = request.URL.Query().Get("format")
+
+		if _, ok := Formats[job.Format]; job.Format != "" && !ok {
+			http.Error(writer, "Unknown format "+job.Format, http.StatusBadRequest)
+			return
+		}
+
+		job.Boundary.Paragraphs = request.URL.Query().Get("paragraphs") == "true"
+		job.Boundary.Delimiter = request.URL.Query().Get("delimiter")
+
+		job.Selector.Field = request.URL.Query().Get("field")
+
+		if column := request.URL.Query().Get("column"); column != "" {
+			job.Selector.Column, err = strconv.Atoi(column)
+
+			if err != nil || job.Selector.Column < 1 {
+				http.Error(writer, "Column must be a number from 1", http.StatusBadRequest)
+				return
+			}
+		}
+
+		if request.URL.Query().Get("async") == "true" {
+			learnAsync(writer, job, dispatcher, jobs)
+			return
+		}
+
+		if err := dispatcher.Learn(job); err != nil {
+			if err == ErrNoSelector || errors.As(err, &BodyError{}) {
+				http.Error(writer, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			log.Printf("Error processing job: %s", err.Error())
+			writer.WriteHeader(http.StatusInternalServerError)
+			return
 		}
 
-		learnQueue <- job
+		gram.WriteJSON(writer, http.StatusOK, map[string]string{"document": job.Document})
+	}
 
-		<-job.Done
+}
 
-		writer.WriteHeader(http.StatusOK)
+// learnAsync copies the request body to a temporary file, so that the connection can be released as soon as the upload
+// has been received, and then queues the body to be learned in the background. The response is 202 Accepted with the
+// status of the new job, which can then be polled via /jobs/{id}.
+func learnAsync(writer http.ResponseWriter, task Task, dispatcher *LearnDispatcher, jobs *Jobs) {
+	body, err := spool(task.Body)
+	if err != nil {
+		log.Printf("Error receiving upload: %s", err.Error())
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
 	}
+
+	job := jobs.New()
+	job.Document = task.Document
+
+	task.Body = body
+	task.Context = job.Context()
+	task.Progress = &job.Progress
+
+	err = dispatcher.LearnAsync(task, func(err error) {
+		if err != nil && err != job.Context().Err() {
+			log.Printf("Error processing job %s: %s", job.ID, err.Error())
+		}
+
+		job.Finish(err)
+	})
+
+	if err != nil {
+		body.Close()
+		jobs.remove(job.ID)
+
+		if err == pool.ErrQueueFull {
+			writer.WriteHeader(http.StatusServiceUnavailable)
+		} else {
+			writer.WriteHeader(http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	writer.Header().Set("Location", "/jobs/"+job.ID)
+	gram.WriteJSON(writer, http.StatusAccepted, job.Status())
+}
+
+// JobHandler reports the status of a background learn job
+func JobHandler(jobs *Jobs) func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+
+	return func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+		job, ok := jobs.Get(params.ByName("id"))
+		if !ok {
+			writer.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		gram.WriteJSON(writer, http.StatusOK, job.Status())
+	}
+
+}
+
+// CancelJobHandler cancels a background learn job. Grams learned before the cancellation takes effect are kept.
+func CancelJobHandler(jobs *Jobs) func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+
+	return func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+		job, ok := jobs.Get(params.ByName("id"))
+		if !ok {
+			writer.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		job.Cancel()
+
+		gram.WriteJSON(writer, http.StatusAccepted, job.Status())
+	}
+
+}
+
+// spooledFile is a temporary copy of an upload which is deleted once it has been closed
+type spooledFile struct {
+	*os.File
+}
+
+func (file spooledFile) Close() error {
+	err := file.File.Close()
+	os.Remove(file.Name())
+	return err
+}
+
+// spool copies body to a temporary file without holding it in memory, returning the file positioned at the start
+func spool(body io.ReadCloser) (spooledFile, error) {
+	defer body.Close()
+
+	file, err := os.CreateTemp("", "trigrams-learn-")
+	if err != nil {
+		return spooledFile{}, err
+	}
+
+	spooled := spooledFile{file}
+
+	if _, err := io.Copy(file, body); err != nil {
+		spooled.Close()
+		return spooledFile{}, err
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		spooled.Close()
+		return spooledFile{}, err
+	}
+
+	return spooled, nil
 }
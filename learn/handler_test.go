@@ -2,104 +2,277 @@ package learn
 
 import (
 	"bytes"
+	"encoding/json"
 	"github.com/fergloragain/trigrams/gram"
+	"github.com/julienschmidt/httprouter"
 	"github.com/pkg/errors"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
-type TestWriter struct {
-	ResultCode int
-	Blocker    chan int
-}
+func TestHandler(t *testing.T) {
+	gramCollection := gram.NewCollection()
 
-func (t *TestWriter) Header() http.Header {
-	return nil
-}
+	dispatcher := NewDispatcher(1, 1)
+	dispatcher.Run(1, false)
+
+	handler := Handler(gramCollection, dispatcher, NewJobs())
+
+	recorder := httptest.NewRecorder()
 
-func (t *TestWriter) Write(b []byte) (int, error) {
-	return 0, nil
+	handler(recorder, httptest.NewRequest("POST", "/learn", strings.NewReader("Hello")), nil)
+
+	if len(gramCollection.Grams()) != 1 || gramCollection.Grams()[0][0] != "Hello" {
+		t.Fail()
+	}
+
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected %d, got %d", http.StatusOK, recorder.Code)
+	}
 }
 
-func (t *TestWriter) WriteHeader(statusCode int) {
-	t.ResultCode = statusCode
-	t.Blocker <- 0
+func TestHandler_BrokenBody(t *testing.T) {
+	dispatcher := NewDispatcher(1, 1)
+	dispatcher.Run(1, false)
+
+	handler := Handler(gram.NewCollection(), dispatcher, NewJobs())
 
-	return
+	recorder := httptest.NewRecorder()
+
+	handler(recorder, httptest.NewRequest("POST", "/learn", &BrokenBuffer{bytes.NewBufferString("Hello")}), nil)
+
+	if recorder.Code != http.StatusInternalServerError {
+		t.Errorf("Expected %d, got %d", http.StatusInternalServerError, recorder.Code)
+	}
 }
 
-type ClosingBuffer struct {
+type BrokenBuffer struct {
 	*bytes.Buffer
 }
 
-func (cb *ClosingBuffer) Close() error {
-	return nil
+func (cb *BrokenBuffer) Close() error {
+	return errors.New("Error reading data")
 }
 
-func TestHandler(t *testing.T) {
+func (cb *BrokenBuffer) Read(p []byte) (n int, err error) {
+	return 0, errors.New("Error reading data")
+}
+
+func TestHandler_Async(t *testing.T) {
 	gramCollection := gram.NewCollection()
-	learnQueue := make(chan Task)
 
-	handler := Handler(gramCollection, learnQueue)
+	dispatcher := NewDispatcher(1, 1)
+	dispatcher.Run(1, false)
 
-	testWriter := &TestWriter{}
-	testWriter.Blocker = make(chan int)
+	jobs := NewJobs()
 
-	cb := &ClosingBuffer{bytes.NewBufferString("Hello")}
+	handler := Handler(gramCollection, dispatcher, jobs)
 
-	testRequest := &http.Request{
-		Body: cb,
+	recorder := httptest.NewRecorder()
+
+	handler(recorder, httptest.NewRequest("POST", "/learn?async=true", strings.NewReader("Hello there")), nil)
+
+	if recorder.Code != http.StatusAccepted {
+		t.Fatalf("Expected %d, got %d", http.StatusAccepted, recorder.Code)
 	}
 
-	go handler(testWriter, testRequest, nil)
+	var status JobStatus
 
-	r := <-learnQueue
+	if err := json.NewDecoder(recorder.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
 
-	r.Done <- 1
+	if recorder.Header().Get("Location") != "/jobs/"+status.ID {
+		t.Fail()
+	}
 
-	<-testWriter.Blocker
+	params := httprouter.Params{{Key: "id", Value: status.ID}}
 
-	buf := make([]byte, 6)
+	for status.State != JobCompleted {
+		recorder = httptest.NewRecorder()
 
-	n, _ := r.Body.Read(buf)
+		JobHandler(jobs)(recorder, httptest.NewRequest("GET", "/jobs/"+status.ID, nil), params)
 
-	if string(buf[:n]) != "Hello" {
-		t.Fail()
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("Expected %d, got %d", http.StatusOK, recorder.Code)
+		}
+
+		status = JobStatus{}
+
+		if err := json.NewDecoder(recorder.Body).Decode(&status); err != nil {
+			t.Fatal(err)
+		}
+
+		if status.State == JobFailed || status.State == JobCancelled {
+			t.Fatalf("Unexpected state %s", status.State)
+		}
+	}
+
+	if status.BytesProcessed != 11 || status.GramsAdded != 2 {
+		t.Errorf("Unexpected progress %+v", status)
 	}
 
-	if testWriter.ResultCode != http.StatusOK {
+	if len(gramCollection.Grams()) != 2 {
 		t.Fail()
 	}
-}
 
-type BrokenBuffer struct {
-	*bytes.Buffer
+	if err := gramCollection.Unlearn(status.Document); err != nil || gramCollection.Len() != 0 {
+		t.Errorf("Expected document %q to be unlearned, got %v", status.Document, err)
+	}
 }
 
-func (cb *BrokenBuffer) Close() error {
-	return errors.New("Error reading data")
-}
+func TestHandler_Document(t *testing.T) {
+	gramCollection := gram.NewCollection()
 
-func (cb *BrokenBuffer) Read(p []byte) (n int, err error) {
-	return 0, errors.New("Error reading data")
-}
+	dispatcher := NewDispatcher(1, 1)
+	dispatcher.Run(3, false)
 
-type TestWriterError struct {
-	Result  string
-	Blocker chan int
+	handler := Handler(gramCollection, dispatcher, NewJobs())
+
+	learn := func(body string) string {
+		recorder := httptest.NewRecorder()
+
+		handler(recorder, httptest.NewRequest("POST", "/learn", strings.NewReader(body)), nil)
+
+		var response struct{ Document string }
+
+		if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil || recorder.Code != http.StatusOK {
+			t.Fatalf("Unexpected response %d %v", recorder.Code, err)
+		}
+
+		return response.Document
+	}
+
+	public := learn("the cat sat on the mat")
+	secret := learn("the secret plan is on the mat")
+
+	if public == secret {
+		t.Fatalf("Expected each learn request to get its own document ID, got %s twice", public)
+	}
+
+	if err := gramCollection.Unlearn(secret); err != nil {
+		t.Fatal(err)
+	}
+
+	if gramCollection.Len() != 4 || gramCollection.TotalFrequencies != 4 || gramCollection.Frequency([]string{"secret", "plan", "is"}) != 0 {
+		t.Errorf("Expected only the 4 grams of the first document to be left, got %v", gramCollection.Grams())
+	}
 }
 
-func (t *TestWriterError) Header() http.Header {
-	return nil
+func TestHandler_BadBody(t *testing.T) {
+	dispatcher := NewDispatcher(1, 1)
+	dispatcher.Run(3, false)
+
+	handler := Handler(gram.NewCollection(), dispatcher, NewJobs())
+
+	truncated := gzipped(strings.Repeat("the cat sat on the mat ", 100))
+	truncated = truncated[:len(truncated)/2]
+
+	tt := []struct {
+		Name            string
+		Target          string
+		Body            []byte
+		ContentType     string
+		ContentEncoding string
+	}{
+		{Name: "bad gzip header", Target: "/learn", Body: []byte("not gzip"), ContentEncoding: "gzip"},
+		{Name: "truncated gzip", Target: "/learn", Body: truncated, ContentEncoding: "gzip"},
+		{Name: "bad zlib header", Target: "/learn", Body: []byte("not zlib"), ContentEncoding: "deflate"},
+		{Name: "unsupported encoding", Target: "/learn", Body: []byte("text"), ContentEncoding: "br"},
+		{Name: "bad zip", Target: "/learn", Body: []byte("not a zip"), ContentType: "application/zip"},
+		{Name: "bad multipart", Target: "/learn", Body: []byte("--x\r\nbroken"), ContentType: "multipart/form-data; boundary=x"},
+		{Name: "bad JSON Lines", Target: "/learn?field=text", Body: []byte(`{"text": "fine"}` + "\n{broken\n"), ContentType: "application/x-ndjson"},
+		{Name: "unknown CSV column", Target: "/learn?field=text", Body: []byte("title,body\na,b\n"), ContentType: "text/csv"},
+		{Name: "bad CSV", Target: "/learn?column=1", Body: []byte("\"unclosed\nquote"), ContentType: "text/csv"},
+	}
+
+	for _, test := range tt {
+		request := httptest.NewRequest("POST", test.Target, bytes.NewReader(test.Body))
+		request.Header.Set("Content-Type", test.ContentType)
+		request.Header.Set("Content-Encoding", test.ContentEncoding)
+
+		recorder := httptest.NewRecorder()
+
+		handler(recorder, request, nil)
+
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("Expected a %s to be refused with %d, got %d", test.Name, http.StatusBadRequest, recorder.Code)
+		}
+	}
 }
 
-func (t *TestWriterError) Write(b []byte) (int, error) {
-	t.Result = string(b)
-	t.Blocker <- 0
+func TestCancelJobHandler(t *testing.T) {
+	jobs := NewJobs()
+	job := jobs.New()
 
-	return 0, nil
+	recorder := httptest.NewRecorder()
+
+	CancelJobHandler(jobs)(recorder, httptest.NewRequest("DELETE", "/jobs/"+job.ID, nil), httprouter.Params{{Key: "id", Value: job.ID}})
+
+	if recorder.Code != http.StatusAccepted {
+		t.Errorf("Expected %d, got %d", http.StatusAccepted, recorder.Code)
+	}
+
+	if job.Context().Err() == nil {
+		t.Error("Expected job to be cancelled")
+	}
+
+	recorder = httptest.NewRecorder()
+
+	CancelJobHandler(jobs)(recorder, httptest.NewRequest("DELETE", "/jobs/missing", nil), httprouter.Params{{Key: "id", Value: "missing"}})
+
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected %d, got %d", http.StatusNotFound, recorder.Code)
+	}
 }
 
-func (t *TestWriterError) WriteHeader(statusCode int) {
-	return
+func TestHandler_Preprocess(t *testing.T) {
+	dispatcher := NewDispatcher(1, 1)
+	dispatcher.Run(2, false)
+
+	// without the preprocessor, the licence header and footer are learned too
+	tt := []struct {
+		URL     string
+		Code    int
+		Body    bool
+		Licence bool
+	}{
+		{URL: "/learn?preprocess=gutenberg", Code: http.StatusOK, Body: true, Licence: false},
+		{URL: "/learn", Code: http.StatusOK, Body: true, Licence: true},
+		{URL: "/learn?preprocess=unknown", Code: http.StatusBadRequest, Body: false, Licence: false},
+	}
+
+	for _, test := range tt {
+		gramCollection := gram.NewCollection()
+
+		handler := Handler(gramCollection, dispatcher, NewJobs())
+
+		body := "Header\n*** START OF THE PROJECT GUTENBERG EBOOK X ***\nBody text\n*** END OF THE PROJECT GUTENBERG EBOOK X ***\n"
+
+		recorder := httptest.NewRecorder()
+
+		handler(recorder, httptest.NewRequest("POST", test.URL, strings.NewReader(body)), nil)
+
+		if recorder.Code != test.Code {
+			t.Errorf("Expected %d for %s, got %d", test.Code, test.URL, recorder.Code)
+		}
+
+		learnedBody, licence := false, false
+
+		for _, g := range gramCollection.Grams() {
+			if g[0] == "Body" && g[1] == "text" {
+				learnedBody = true
+			}
+
+			if g[0] == "Header" {
+				licence = true
+			}
+		}
+
+		if learnedBody != test.Body || licence != test.Licence {
+			t.Errorf("Unexpected grams for %s: %v", test.URL, gramCollection.Grams())
+		}
+	}
 }
@@ -0,0 +1,246 @@
+package learn
+
+import (
+	"bufio"
+	"bytes"
+	"html"
+	"io"
+	"strings"
+)
+
+// MaxEntityLength is the longest character reference, e.g. &CounterClockwiseContourIntegral;, that will be decoded.
+// Anything longer is assumed to be a stray ampersand and passed through as is.
+const MaxEntityLength = 34
+
+// MaxTagLength is the most bytes, attributes included, that a tag may run to. A tag which runs on any further is assumed
+// never to close, from a stray "<" or an unclosed quote, and is given up on, so that it can't swallow the rest of the
+// document. Only the start of a tag, enough to get its name, is ever held in memory.
+const MaxTagLength = 64 * 1024
+
+const (
+	htmlText = iota
+	htmlTag
+	htmlComment
+	htmlRawText
+)
+
+// inlineElements don't break up the words either side of them, so "<b>bo</b>ld" reads as "bold"
+var inlineElements = map[string]bool{
+	"a": true, "abbr": true, "b": true, "bdi": true, "bdo": true, "cite": true, "code": true, "data": true, "dfn": true,
+	"em": true, "i": true, "kbd": true, "mark": true, "q": true, "s": true, "samp": true, "small": true, "span": true,
+	"strong": true, "sub": true, "sup": true, "time": true, "u": true, "var": true, "wbr": true,
+}
+
+// paragraphElements end a paragraph, so they're replaced by a blank line
+var paragraphElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "dd": true, "div": true, "dl": true,
+	"dt": true, "figcaption": true, "footer": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true,
+	"h6": true, "header": true, "hr": true, "li": true, "main": true, "nav": true, "ol": true, "p": true, "pre": true,
+	"section": true, "table": true, "td": true, "th": true, "tr": true, "ul": true,
+}
+
+// rawTextElements hold content which is never displayed as prose
+var rawTextElements = map[string]bool{
+	"script": true, "style": true, "template": true, "noscript": true,
+}
+
+// htmlReader extracts the visible text from an HTML document
+type htmlReader struct {
+	reader  *bufio.Reader
+	state   int
+	tag     bytes.Buffer
+	length  int // the length of the tag being read
+	quote   byte
+	rawEnd  string
+	pending []byte
+	eof     bool
+}
+
+// ExtractHTML returns a reader which yields only the visible text of an HTML document. Tags and comments are removed,
+// the contents of script and style elements are dropped, and character references are decoded. Block level elements
+// are replaced by blank lines, so that paragraphs remain separate.
+func ExtractHTML(r io.Reader) io.Reader {
+	return &htmlReader{reader: bufio.NewReader(r)}
+}
+
+func (h *htmlReader) Read(p []byte) (int, error) {
+	for len(h.pending) == 0 {
+		if h.eof {
+			return 0, io.EOF
+		}
+
+		if err := h.fill(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, h.pending)
+	h.pending = h.pending[n:]
+
+	return n, nil
+}
+
+// fill consumes input until there is some text to hand back, or the input runs out
+func (h *htmlReader) fill() error {
+	h.pending = h.pending[:0]
+
+	for len(h.pending) == 0 {
+		c, err := h.reader.ReadByte()
+		if err == io.EOF {
+			h.eof = true
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		switch h.state {
+		case htmlText:
+			switch c {
+			case '<':
+				h.state = htmlTag
+				h.tag.Reset()
+				h.length = 0
+			case '&':
+				if err := h.entity(); err != nil {
+					return err
+				}
+			default:
+				h.pending = append(h.pending, c)
+			}
+		case htmlTag:
+			if h.tag.Len() == 0 && h.quote == 0 && !isTagStart(c) {
+				// a bare "<", as in "a < b", rather than the start of a tag
+				h.state = htmlText
+				h.pending = append(h.pending, '<')
+				h.reader.UnreadByte()
+				continue
+			}
+
+			if h.length++; h.length > MaxTagLength {
+				h.state = htmlText
+				h.quote = 0
+				continue
+			}
+
+			h.tagByte(c)
+		case htmlComment:
+			// only the last three bytes are needed to spot the end of the comment
+			h.tag.WriteByte(c)
+
+			if h.tag.Len() > 3 {
+				h.tag.Next(h.tag.Len() - 3)
+			}
+
+			if bytes.Equal(h.tag.Bytes(), []byte("-->")) {
+				h.state = htmlText
+			}
+		case htmlRawText:
+			h.tag.WriteByte(c)
+
+			if h.tag.Len() > len(h.rawEnd) {
+				h.tag.Next(h.tag.Len() - len(h.rawEnd))
+			}
+
+			if strings.EqualFold(h.tag.String(), h.rawEnd) {
+				// the rest of the closing tag is skipped like any other tag
+				h.state = htmlTag
+				h.tag.Reset()
+				h.tag.WriteString(h.rawEnd[1:])
+				h.length = len(h.rawEnd)
+			}
+		}
+	}
+
+	return nil
+}
+
+// tagByte accumulates the contents of a tag, acting on the tag once it closes
+func (h *htmlReader) tagByte(c byte) {
+	if h.quote != 0 {
+		if c == h.quote {
+			h.quote = 0
+		}
+		return
+	}
+
+	if (c == '"' || c == '\'') && h.tag.Len() > 0 {
+		h.quote = c
+		return
+	}
+
+	if c != '>' {
+		// attribute values aren't needed, only enough of the tag to get its name
+		if h.tag.Len() < 64 {
+			h.tag.WriteByte(c)
+		}
+
+		if h.tag.String() == "!--" {
+			h.state = htmlComment
+			h.tag.Reset()
+		}
+
+		return
+	}
+
+	h.state = htmlText
+
+	tag := h.tag.String()
+	closing := strings.HasPrefix(tag, "/")
+	name := strings.ToLower(strings.TrimPrefix(tag, "/"))
+
+	if i := strings.IndexAny(name, " \t\r\n/"); i >= 0 {
+		name = name[:i]
+	}
+
+	switch {
+	case !closing && rawTextElements[name] && !strings.HasSuffix(tag, "/"):
+		h.state = htmlRawText
+		h.rawEnd = "</" + name
+		h.tag.Reset()
+	case paragraphElements[name]:
+		h.pending = append(h.pending, "\n\n"...)
+	case name == "br":
+		h.pending = append(h.pending, '\n')
+	case !inlineElements[name]:
+		h.pending = append(h.pending, ' ')
+	}
+}
+
+func isTagStart(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '/' || c == '!' || c == '?'
+}
+
+// entity decodes a character reference such as &amp; or &#8217;
+func (h *htmlReader) entity() error {
+	reference := []byte{'&'}
+
+	for len(reference) < MaxEntityLength {
+		next, err := h.reader.Peek(1)
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		c := next[0]
+
+		if !(c == '#' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == ';') {
+			break
+		}
+
+		h.reader.ReadByte()
+		reference = append(reference, c)
+
+		if c == ';' {
+			break
+		}
+	}
+
+	h.pending = append(h.pending, html.UnescapeString(string(reference))...)
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package learn
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestExtractHTML(t *testing.T) {
+	tt := []struct {
+		HTML     string
+		Expected string
+	}{
+		{
+			HTML:     "<p>Hello <b>bo</b>ld world</p>",
+			Expected: "\n\nHello bold world\n\n",
+		},
+		{
+			HTML:     `<html><head><title>Title</title><style>p { color: red; }</style><script type="text/javascript">if (a < b) { alert("</p>"); }</script></head><body>Text</body></html>`,
+			Expected: "   Title     Text  ",
+		},
+		{
+			HTML:     "Fish &amp; chips &lt;3 &#8217;&#x2019; &copy; &bogus; AT&T",
+			Expected: "Fish & chips <3 ’’ © &bogus; AT&T",
+		},
+		{
+			HTML:     `<a href="/x?a=1&b=2" title="a > b">link</a> text<br/>more<!-- a <p> comment -->text`,
+			Expected: "link text\nmoretext",
+		},
+		{
+			HTML:     "a < b and b > a",
+			Expected: "a < b and b > a",
+		},
+		{
+			HTML:     "<ul><li>one</li><li>two</li></ul>",
+			Expected: "\n\n\n\none\n\n\n\ntwo\n\n\n\n",
+		},
+	}
+
+	for _, test := range tt {
+		for _, reader := range []io.Reader{strings.NewReader(test.HTML), iotest.OneByteReader(strings.NewReader(test.HTML))} {
+			result, err := io.ReadAll(ExtractHTML(reader))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(result) != test.Expected {
+				t.Errorf("Expected >%q<, got >%q<", test.Expected, string(result))
+			}
+		}
+	}
+}
+
+func TestExtractHTML_Unterminated(t *testing.T) {
+	const size = 16 * 1024 * 1024
+
+	// an unterminated comment is skipped to the end without being held in memory
+	bytes := allocated(func() {
+		result, err := io.ReadAll(ExtractHTML(io.MultiReader(strings.NewReader("text <!-- "), io.LimitReader(endless('a'), size))))
+
+		if err != nil || string(result) != "text " {
+			t.Errorf("Expected only the text before the comment, got %d bytes, %v", len(result), err)
+		}
+	})
+
+	if bytes > size/16 {
+		t.Errorf("Expected an unterminated comment to be skipped in bounded memory, but %d bytes were allocated", bytes)
+	}
+
+	// a tag with an unclosed quote is given up on, rather than swallowing the rest of the document
+	html := `<p title="unclosed>` + strings.Repeat("a", MaxTagLength) + " the rest</p>"
+
+	result, err := io.ReadAll(ExtractHTML(strings.NewReader(html)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasSuffix(string(result), "a the rest\n\n") {
+		t.Errorf("Expected the text after an unterminated tag to be kept, got %d bytes ending %q", len(result), result[max(0, len(result)-20):])
+	}
+}
@@ -0,0 +1,179 @@
+package learn
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// JobRetention is how long a finished job remains available for status polling
+const JobRetention = time.Hour
+
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// Progress records how far through its body a learn task has got. The counters are updated by the worker processing the
+// task and may be read concurrently.
+type Progress struct {
+	started        atomic.Bool
+	bytesProcessed atomic.Int64
+	gramsAdded     atomic.Int64
+}
+
+// Job is a learn task running in the background
+type Job struct {
+	ID       string
+	Document string // the ID of the document being learned, which can be unlearned once the job has finished
+	Progress Progress
+	Created  time.Time
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	finished time.Time
+	err      error
+}
+
+// JobStatus is the externally visible state of a job
+type JobStatus struct {
+	ID             string     `json:"id"`
+	Document       string     `json:"document,omitempty"`
+	State          string     `json:"state"`
+	BytesProcessed int64      `json:"bytes_processed"`
+	GramsAdded     int64      `json:"grams_added"`
+	Error          string     `json:"error,omitempty"`
+	Created        time.Time  `json:"created"`
+	Finished       *time.Time `json:"finished,omitempty"`
+}
+
+// Jobs is the registry of background learn jobs
+type Jobs struct {
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+func NewJobs() *Jobs {
+	return &Jobs{jobs: map[string]*Job{}}
+}
+
+// New registers a new job, discarding any jobs which finished more than JobRetention ago
+func (jobs *Jobs) New() *Job {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	job := &Job{
+		ID:      newID(),
+		Created: time.Now(),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+
+	jobs.mu.Lock()
+	defer jobs.mu.Unlock()
+
+	for id, old := range jobs.jobs {
+		if old.expired() {
+			delete(jobs.jobs, id)
+		}
+	}
+
+	jobs.jobs[job.ID] = job
+
+	return job
+}
+
+// newID returns a random ID for a job or a learned document
+func newID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
+
+// Get looks up a job by ID
+func (jobs *Jobs) Get(id string) (*Job, bool) {
+	jobs.mu.Lock()
+	defer jobs.mu.Unlock()
+
+	job, ok := jobs.jobs[id]
+
+	return job, ok
+}
+
+func (jobs *Jobs) remove(id string) {
+	jobs.mu.Lock()
+	defer jobs.mu.Unlock()
+
+	delete(jobs.jobs, id)
+}
+
+// Context is cancelled when the job is cancelled
+func (job *Job) Context() context.Context {
+	return job.ctx
+}
+
+// Cancel asks the job to stop. Grams learned before the job notices the cancellation remain in the collection.
+func (job *Job) Cancel() {
+	job.cancel()
+}
+
+// Finish records the outcome of the job
+func (job *Job) Finish(err error) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	job.finished = time.Now()
+	job.err = err
+	job.cancel()
+}
+
+func (job *Job) expired() bool {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	return !job.finished.IsZero() && time.Since(job.finished) > JobRetention
+}
+
+// Status reports the current state and progress of the job
+func (job *Job) Status() JobStatus {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	status := JobStatus{
+		ID:             job.ID,
+		Document:       job.Document,
+		State:          JobQueued,
+		BytesProcessed: job.Progress.bytesProcessed.Load(),
+		GramsAdded:     job.Progress.gramsAdded.Load(),
+		Created:        job.Created,
+	}
+
+	if job.Progress.started.Load() {
+		status.State = JobRunning
+	}
+
+	if !job.finished.IsZero() {
+		finished := job.finished
+		status.Finished = &finished
+
+		switch {
+		case job.err == context.Canceled:
+			status.State = JobCancelled
+		case job.err != nil:
+			status.State = JobFailed
+			status.Error = job.err.Error()
+		default:
+			status.State = JobCompleted
+		}
+	}
+
+	return status
+}
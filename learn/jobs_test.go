@@ -0,0 +1,81 @@
+package learn
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"testing"
+	"time"
+)
+
+func TestJobStatus(t *testing.T) {
+	tt := []struct {
+		Started bool
+		Finish  bool
+		Error   error
+		State   string
+	}{
+		{State: JobQueued},
+		{Started: true, State: JobRunning},
+		{Started: true, Finish: true, State: JobCompleted},
+		{Started: true, Finish: true, Error: errors.New("Error reading data"), State: JobFailed},
+		{Finish: true, Error: context.Canceled, State: JobCancelled},
+	}
+
+	for _, test := range tt {
+		job := NewJobs().New()
+
+		job.Progress.started.Store(test.Started)
+
+		if test.Finish {
+			job.Finish(test.Error)
+		}
+
+		status := job.Status()
+
+		if status.State != test.State {
+			t.Errorf("Expected state %s, got %s", test.State, status.State)
+		}
+
+		if test.State == JobFailed && status.Error != test.Error.Error() {
+			t.Errorf("Expected error %s, got %s", test.Error, status.Error)
+		}
+
+		if test.Finish != (status.Finished != nil) {
+			t.Fail()
+		}
+	}
+}
+
+func TestJobCancel(t *testing.T) {
+	job := NewJobs().New()
+
+	job.Cancel()
+
+	if job.Context().Err() != context.Canceled {
+		t.Fail()
+	}
+}
+
+func TestJobsExpiry(t *testing.T) {
+	jobs := NewJobs()
+
+	old := jobs.New()
+	old.Finish(nil)
+
+	old.mu.Lock()
+	old.finished = time.Now().Add(-2 * JobRetention)
+	old.mu.Unlock()
+
+	running := jobs.New()
+
+	// creating a job discards jobs that finished long ago, but never unfinished ones
+	jobs.New()
+
+	if _, ok := jobs.Get(old.ID); ok {
+		t.Error("Expected expired job to be discarded")
+	}
+
+	if _, ok := jobs.Get(running.ID); !ok {
+		t.Error("Expected running job to be kept")
+	}
+}
@@ -1,36 +1,30 @@
 package learn
 
 import (
-	"fmt"
+	"bufio"
+	"context"
 	"github.com/fergloragain/trigrams/gram"
 	"io"
-	"log"
-	"regexp"
-	"strings"
 )
 
-const ReadSize = 64
-
 var regexReplacements []RegexReplacements
 
 type Task struct {
-	Body io.ReadCloser
-	Gram *gram.GramCollection
-	Done chan int
-}
-
-type LearnWorker struct {
-	LearnWorkerPool chan chan Task
-	JobChannel      chan Task
-	quit            chan bool
-}
-
-func NewWorker(workerPool chan chan Task) LearnWorker {
-	return LearnWorker{
-		LearnWorkerPool: workerPool,
-		JobChannel:      make(chan Task),
-		quit:            make(chan bool),
-	}
+	Body            io.ReadCloser
+	ContentType     string         // optional; selects how the body is split into documents, see documents
+	ContentEncoding string         // optional; gzip or deflate if the body is compressed
+	Format          string         // optional; one of Formats, detected for each document if not given
+	Selector        Selector       // optional; selects the prose from JSON Lines and CSV records
+	Boundary        Boundary       // optional; splits each document into separately learned segments
+	Preprocessors   []Preprocessor // optional; applied to each document before it is tokenised
+	Gram            *gram.GramCollection
+	Context         context.Context // optional; processing stops with the context's error once it is done
+	Progress        *Progress       // optional; updated as the body is processed
+	Shards          int             // optional; the number of shards of a document learned in parallel, 1 if not given
+	Document        string          // optional; the ID everything learned is recorded against, so that it can be unlearned
+
+	shardSize int // the size of each shard, ShardSize if not given
+	flushSize int // the number of grams buffered before they are added to the collection, FlushSize if not given
 }
 
 type RegexReplacements struct {
@@ -52,144 +46,203 @@ func init() {
 	})
 }
 
-// start the learn worker, specifying the maximum number of words to be generated, and whether or not we want to strip
-// punctuation
-func (worker LearnWorker) Start(gramSize int, stripPunctuation bool) {
-	go func() {
-		for {
-			// the worker registers itself into the pool of workers
-			worker.LearnWorkerPool <- worker.JobChannel
-
-			select {
-			// the worker listens for a learnTask request
-			case learnTask := <-worker.JobChannel:
-
-				// process the learnTask request
-				if err := learnTask.Process(gramSize, stripPunctuation, regexReplacements); err != nil {
-					log.Printf("Error processing job: %s", err.Error())
-				}
-
-			case <-worker.quit:
-				// we have received a signal to stop
-				return
-			}
-		}
-	}()
-}
-
-// Stop signals the worker to stop listening for work requests.
-func (worker LearnWorker) Stop() {
-	go func() {
-		worker.quit <- true
-	}()
+// batch buffers the grams counted from a task's documents until they're added to the collection. It's shared by every
+// document of the task, so that a body of many small documents, such as the records of a JSON Lines upload, is added a
+// batch at a time rather than a document at a time.
+type batch struct {
+	counts    map[string]int
+	added     int // the number of grams counted since the last flush
+	documents int // the number of documents finished since the last flush
 }
 
-// Process will strip punctuation from the source text if configured to do so, then split the text into an array of
-// strings, and then process the array of strings into ngrams of a specific size, by default 3
+// Process splits the body into one or more documents, and then learns each document in turn. Grams never span two
+// documents, nor a boundary within a document. The last batch of grams is only added to the collection once the whole
+// body has been learned. If processing fails part way, the batches already added are unlearned again, so that nothing
+// is left behind from a body that was refused; if the task is cancelled, they're kept.
 func (job *Task) Process(gramSize int, strip bool, regexArray []RegexReplacements) error {
 
 	defer job.Body.Close()
 
-	streamBuffer := make([]byte, ReadSize)
+	replacements, err := compileReplacements(regexArray)
+	if err != nil {
+		return err
+	}
 
-	var remainingString string
-	gramTokens := []string{}
+	if job.Progress != nil {
+		job.Progress.started.Store(true)
+	}
 
-	for {
+	pending := &batch{counts: map[string]int{}}
 
-		numberOfBytesRead, err := job.Body.Read(streamBuffer)
+	learnDocument := func(document Document) error {
+		text, err := extract(document, job.Format)
+		if err != nil {
+			return err
+		}
 
-		if numberOfBytesRead > 0 {
+		err = segments(preprocess(text, job.Preprocessors), job.Boundary, func(segment io.Reader) error {
+			return job.processDocument(segment, gramSize, replacements, pending)
+		})
 
-			byteString := string(streamBuffer[:numberOfBytesRead])
+		if err == nil {
+			pending.documents++
+		}
 
-			var plainText string
+		return err
+	}
 
-			plainText, err = stripPunctuation(byteString, regexArray)
+	err = documents(job.Body, job.ContentType, job.ContentEncoding, func(document Document) error {
+		// each record of a JSON Lines or CSV document is a document in its own right
+		if kind := recordKind(document); kind != "" {
+			return records(document, kind, job.Selector, learnDocument)
+		}
 
-			if err != nil {
-				return err
-			}
+		return learnDocument(document)
+	})
 
-			if len(plainText) > 0 {
+	if err != nil {
+		if job.cancelled() == nil && job.Document != "" {
+			// there's nothing to unlearn if no batch was added before the fault
+			job.Gram.Unlearn(job.Document)
+		}
 
-				plainText = fmt.Sprintf("%s%s", remainingString, plainText)
+		return err
+	}
 
-				gramTokens, remainingString = processToTokens(plainText, gramSize)
+	return job.flush(pending)
+}
 
-				for len(gramTokens) == gramSize {
+// processDocument splits the source text into shards, each of which is read a token at a time, stripping punctuation
+// from each token if configured to do so, and counted into grams of a specific size, by default 3. Up to job.Shards
+// shards are counted in parallel, and the grams spanning each pair of neighbouring shards are stitched together from the
+// tokens at either end of them. Learned grams are buffered in pending and added to the collection in batches, whenever
+// at least job.flushSize grams are buffered and once the whole task has been processed successfully, so that the
+// collection's write lock is taken once per batch rather than once per gram, or once per document.
+func (job *Task) processDocument(body io.Reader, gramSize int, replacements []compiledReplacement, pending *batch) error {
 
-					newGram := []string{}
+	reader := bufio.NewReader(&progressReader{job: job, reader: body})
 
-					newGram = append(newGram, gramTokens[:gramSize]...)
+	shardSize := job.shardSize
+	if shardSize < 1 {
+		shardSize = ShardSize
+	}
 
-					job.Gram.AddGram(newGram)
+	parallel := job.Shards
+	if parallel < 1 {
+		parallel = 1
+	}
 
-					gramTokens, remainingString = processToTokens(remainingString, gramSize)
+	flushSize := job.flushSize
+	if flushSize < 1 {
+		flushSize = FlushSize
+	}
 
-				}
+	boundaries := newStitcher(gramSize)
+
+	for eof := false; !eof; {
+		shards := [][]byte{}
+
+		for len(shards) < parallel {
+			shard, err := readShard(reader, shardSize)
+			if err == io.EOF {
+				eof = true
+				break
+			}
+
+			if err != nil {
+				return err
 			}
-		} else {
-			break
+
+			shards = append(shards, shard)
 		}
-	}
 
-	if len(remainingString) > 0 {
-		lastGram := strings.Fields(remainingString)
+		for _, result := range countShards(shards, gramSize, replacements) {
+			if result.err != nil {
+				return result.err
+			}
 
-		if len(lastGram) == gramSize {
-			job.Gram.AddGram(lastGram)
+			pending.added += boundaries.stitch(result, pending.counts)
+
+			for key, count := range result.counts {
+				pending.counts[key] += count
+			}
+
+			pending.added += result.grams
+
+			if pending.added >= flushSize {
+				if err := job.flush(pending); err != nil {
+					return err
+				}
+			}
 		}
 	}
 
-	job.Done <- 1
-
 	return nil
 }
 
-// processToTokens accepts a string and a gram size, and attempts to parse the string into a gram of the corresponding
-// size. If there isn't enough words in the string to create a gram of the correct size, an empty gram is returned
-// along with the input string, which will be processed with more data later on
-func processToTokens(fullString string, gramSize int) ([]string, string) {
+// progressReader records the bytes read from a document in the task's progress, and stops reading once the task is
+// cancelled
+type progressReader struct {
+	job    *Task
+	reader io.Reader
+}
 
-	tokens := strings.Fields(fullString)
+func (r *progressReader) Read(p []byte) (int, error) {
+	if err := r.job.cancelled(); err != nil {
+		return 0, err
+	}
 
-	if len(tokens) > gramSize {
+	n, err := r.reader.Read(p)
 
-		gramTokens := tokens[:gramSize]
+	if r.job.Progress != nil {
+		r.job.Progress.bytesProcessed.Add(int64(n))
+	}
 
-		trailingSize := gramSize - 1
+	return n, err
+}
 
-		remaining := []string{}
+// cancelled returns the task context's error once the context is done, or nil if the task has no context
+func (job *Task) cancelled() error {
+	if job.Context == nil {
+		return nil
+	}
 
-		remaining = append(remaining, gramTokens[len(gramTokens)-trailingSize:]...)
+	return job.Context.Err()
+}
 
-		remaining = append(remaining, tokens[gramSize:]...)
+// flush adds a batch of counted grams, and the documents they finished, to the collection under a single write lock,
+// recording how many grams were added in the task's progress. Nothing is added once the task has been cancelled.
+func (job *Task) flush(pending *batch) error {
+	if err := job.cancelled(); err != nil {
+		return err
+	}
 
-		remainingString := strings.Join(remaining, " ")
+	if len(pending.counts) == 0 && pending.documents == 0 {
+		return nil
+	}
 
-		if strings.HasSuffix(fullString, " ") {
-			remainingString = fmt.Sprintf("%s ", remainingString)
-		}
+	job.Gram.AddDocuments(job.Document, pending.counts, pending.documents)
 
-		return gramTokens, remainingString
+	if job.Progress != nil {
+		job.Progress.gramsAdded.Add(int64(pending.added))
 	}
 
-	return []string{}, fullString
+	*pending = batch{counts: map[string]int{}}
+
+	return nil
 }
 
 // stripPunctuation accepts a string and an array of regex patterns and replacement strings, and modifies the input
 // string by replacing each regex pattern with the corresponding pattern
 func stripPunctuation(text string, regexReplacements []RegexReplacements) (string, error) {
 
-	for _, regexReplacement := range regexReplacements {
-		regex, err := regexp.Compile(regexReplacement.Regex)
-
-		if err != nil {
-			return "", err
-		}
+	replacements, err := compileReplacements(regexReplacements)
+	if err != nil {
+		return "", err
+	}
 
-		text = regex.ReplaceAllString(text, regexReplacement.Replacement)
+	for _, replacement := range replacements {
+		text = replacement.regex.ReplaceAllString(text, replacement.replacement)
 	}
 
 	return text, nil
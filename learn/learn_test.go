@@ -1,6 +1,7 @@
 package learn
 
 import (
+	"context"
 	"fmt"
 	"github.com/fergloragain/trigrams/gram"
 	"io/ioutil"
@@ -8,36 +9,6 @@ import (
 	"testing"
 )
 
-func TestNewWorker(t *testing.T) {
-	workerPool := make(chan chan Task)
-	worker := NewWorker(workerPool)
-
-	if worker.LearnWorkerPool != workerPool {
-		t.Fail()
-	}
-
-	if worker.JobChannel == nil {
-		t.Fail()
-	}
-
-	if worker.quit == nil {
-		t.Fail()
-	}
-}
-
-func TestStop(t *testing.T) {
-	workerPool := make(chan chan Task)
-	worker := NewWorker(workerPool)
-
-	jobChannel := make(chan Task)
-
-	worker.JobChannel = jobChannel
-
-	worker.Stop()
-
-	<-worker.quit
-}
-
 func TestProcess(t *testing.T) {
 
 	tt := []struct {
@@ -118,16 +89,9 @@ func TestProcess(t *testing.T) {
 		task := &Task{
 			Body: r,
 			Gram: test.Gram,
-			Done: make(chan int),
 		}
 
-		var res error
-
-		go func() {
-			res = task.Process(test.GramSize, test.Strip, test.Regex)
-		}()
-
-		<-task.Done
+		res := task.Process(test.GramSize, test.Strip, test.Regex)
 
 		if res != nil {
 			if res.Error() != test.Error {
@@ -135,11 +99,20 @@ func TestProcess(t *testing.T) {
 			}
 		}
 
-		for i, g := range test.Gram.Grams {
-			for x := range g {
-				if test.ExpectedGrams[i][x] != g[x] {
-					t.Fail()
-				}
+		// grams are learned in a batch, so their order in the collection isn't the order they appear in the text
+		expected := map[string]bool{}
+
+		for _, g := range test.ExpectedGrams {
+			expected[strings.Join(g, " ")] = true
+		}
+
+		if len(test.Gram.Grams()) != len(test.ExpectedGrams) {
+			t.Errorf("Expected %v, got %v", test.ExpectedGrams, test.Gram.Grams())
+		}
+
+		for _, g := range test.Gram.Grams() {
+			if !expected[strings.Join(g, " ")] {
+				t.Errorf("Unexpected gram %v", g)
 			}
 		}
 
@@ -284,84 +257,24 @@ call
 
 }
 
-func TestProcessToTokens(t *testing.T) {
-
-	tt := []struct {
-		Text      string
-		GramSize  int
-		Result    []string
-		Remaining string
-		Error     error
-	}{
-		{
-			Text:      "A B",
-			GramSize:  1,
-			Result:    []string{"A"},
-			Remaining: "B",
-		},
-		{
-			Text:      "A B C",
-			GramSize:  2,
-			Result:    []string{"A", "B"},
-			Remaining: "B C",
-		},
-		{
-			Text:      "A B C ",
-			GramSize:  2,
-			Result:    []string{"A", "B"},
-			Remaining: "B C ",
-		},
-		{
-			Text:      "A B C D",
-			GramSize:  3,
-			Result:    []string{"A", "B", "C"},
-			Remaining: "B C D",
-		},
-		{
-			Text:      "A B C D E ",
-			GramSize:  4,
-			Result:    []string{"A", "B", "C", "D"},
-			Remaining: "B C D E ",
-		},
-		{
-			Text:      "something more than individual letters ",
-			GramSize:  4,
-			Result:    []string{"something", "more", "than", "individual"},
-			Remaining: "more than individual letters ",
-		},
-		{
-			Text: `
-a 
-little
-more
-complex piece of text
-with line
+func TestProcess_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
 
+	progress := &Progress{}
 
-breaks`,
-			GramSize:  4,
-			Result:    []string{"a", "little", "more", "complex"},
-			Remaining: "little more complex piece of text with line breaks",
-		},
+	task := &Task{
+		Body:     ioutil.NopCloser(strings.NewReader("A test input string")),
+		Gram:     gram.NewCollection(),
+		Context:  ctx,
+		Progress: progress,
 	}
 
-	for _, test := range tt {
-		res, remaining := processToTokens(test.Text, test.GramSize)
-
-		if len(res) != len(test.Result) {
-			fmt.Println(res)
-			fmt.Println(test.Result)
-		}
-		for x, v := range test.Result {
-			if v != res[x] {
-				t.Fail()
-			}
-		}
-
-		if remaining != test.Remaining {
-			t.Errorf(fmt.Sprintf("Expected >%s< to be >%s<", remaining, test.Remaining))
-		}
-
+	if err := task.Process(3, false, regexReplacements); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
 	}
 
+	if len(task.Gram.Grams()) != 0 || progress.bytesProcessed.Load() != 0 {
+		t.Error("Expected a cancelled task to learn nothing")
+	}
 }
@@ -0,0 +1,173 @@
+package learn
+
+import (
+	"bufio"
+	"bytes"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// MaxMarkdownLine is the most of a line read in one go. Longer lines are read and converted a fragment at a time, so
+// that a document without line breaks is never held in memory all at once, although Markdown syntax straddling two
+// fragments may be left in.
+const MaxMarkdownLine = 64 * 1024
+
+var (
+	markdownFence          = regexp.MustCompile("^ {0,3}(```|~~~)")
+	markdownRule           = regexp.MustCompile(`^ {0,3}([-*_=]\s*){3,}$`)
+	markdownReference      = regexp.MustCompile(`^ {0,3}\[[^\]]+\]:\s`)
+	markdownTableDivider   = regexp.MustCompile(`^\s*\|?(\s*:?-+:?\s*\|)+\s*:?-*:?\s*$`)
+	markdownBlockPrefix    = regexp.MustCompile(`^ {0,3}((>\s?)+|#{1,6}\s+|[-*+]\s+|\d+[.)]\s+)`)
+	markdownClosingHashes  = regexp.MustCompile(`\s+#+\s*$`)
+	markdownImage          = regexp.MustCompile(`!\[[^\]]*\](\([^)]*\)|\[[^\]]*\])`)
+	markdownLink           = regexp.MustCompile(`\[([^\]]*)\](\([^)]*\)|\[[^\]]*\])`)
+	markdownAutolink       = regexp.MustCompile(`<(https?|ftp|mailto):[^>]*>`)
+	markdownInlineCode     = regexp.MustCompile("`+[^`]*`+")
+	markdownHTMLTag        = regexp.MustCompile(`</?[a-zA-Z][^>]*>`)
+	markdownStrong         = regexp.MustCompile(`(\*\*|__|~~)`)
+	markdownEmphasisStart  = regexp.MustCompile(`(^|[\s(])[*_]+(\S)`)
+	markdownEmphasisEnd    = regexp.MustCompile(`(\S)[*_]+([\s).,;:!?]|$)`)
+	markdownTableSeparator = regexp.MustCompile(`\s*\|\s*`)
+)
+
+// markdownReader extracts the prose from a Markdown document
+type markdownReader struct {
+	reader    *bufio.Reader
+	fence     string
+	lastBlank bool
+	inCode    bool
+	prose     bool // whether the line being read is prose, rather than code or other syntax
+	lineStart bool
+	pending   []byte
+	eof       bool
+}
+
+// ExtractMarkdown returns a reader which yields only the prose of a Markdown document. Fenced and indented code blocks,
+// inline code, images and link definitions are dropped; link, emphasis, heading, list, quote and table syntax is
+// removed, leaving the text it decorates; and character references are decoded.
+func ExtractMarkdown(r io.Reader) io.Reader {
+	return &markdownReader{reader: bufio.NewReaderSize(r, MaxMarkdownLine), lastBlank: true, lineStart: true}
+}
+
+func (m *markdownReader) Read(p []byte) (int, error) {
+	for len(m.pending) == 0 {
+		if m.eof {
+			return 0, io.EOF
+		}
+
+		if err := m.fill(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, m.pending)
+	m.pending = m.pending[n:]
+
+	return n, nil
+}
+
+// fill reads the next line, or as much of it as MaxMarkdownLine allows, and converts it to plain text
+func (m *markdownReader) fill() error {
+	fragment, err := m.reader.ReadSlice('\n')
+	if err == io.EOF {
+		m.eof = true
+	} else if err != nil && err != bufio.ErrBufferFull {
+		return err
+	}
+
+	if len(fragment) == 0 {
+		return nil
+	}
+
+	atLineStart := m.lineStart
+	m.lineStart = bytes.HasSuffix(fragment, []byte("\n"))
+
+	line := strings.TrimRight(string(fragment), "\r\n")
+	text := ""
+
+	switch {
+	case atLineStart:
+		text = m.line(line)
+	case m.prose:
+		// the rest of a line too long to have been read in one go
+		text = m.inline(line)
+	}
+
+	if m.lineStart || m.eof {
+		text = strings.TrimRightFunc(text, unicode.IsSpace)
+	}
+
+	if text != "" || m.lineStart {
+		m.pending = append(m.pending[:0], text...)
+
+		if m.lineStart {
+			m.pending = append(m.pending, '\n')
+		}
+	}
+
+	return nil
+}
+
+// line converts a single line of Markdown to plain text, returning an empty string for lines with no prose
+func (m *markdownReader) line(line string) string {
+	blank := strings.TrimSpace(line) == ""
+	m.prose = false
+
+	defer func() {
+		m.lastBlank = blank
+	}()
+
+	// fenced code blocks run until a matching fence
+	if m.fence != "" {
+		if strings.HasPrefix(strings.TrimSpace(line), m.fence) {
+			m.fence = ""
+		}
+
+		return ""
+	}
+
+	if fence := markdownFence.FindStringSubmatch(line); fence != nil {
+		m.fence = fence[1]
+		return ""
+	}
+
+	// indented code blocks must follow a blank line, otherwise the indent is a continuation of the paragraph
+	if strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t") {
+		if m.lastBlank || m.inCode {
+			m.inCode = true
+			return ""
+		}
+	} else if !blank {
+		m.inCode = false
+	}
+
+	if blank || markdownRule.MatchString(line) || markdownReference.MatchString(line) || markdownTableDivider.MatchString(line) {
+		return ""
+	}
+
+	m.prose = true
+
+	return strings.TrimLeftFunc(m.inline(markdownBlockPrefix.ReplaceAllString(line, "")), unicode.IsSpace)
+}
+
+// inline removes the inline syntax from a line of prose, or part of one, and decodes its character references
+func (m *markdownReader) inline(line string) string {
+	line = markdownClosingHashes.ReplaceAllString(line, "")
+	line = markdownImage.ReplaceAllString(line, "")
+	line = markdownLink.ReplaceAllString(line, "$1")
+	line = markdownAutolink.ReplaceAllString(line, "")
+	line = markdownInlineCode.ReplaceAllString(line, "")
+	line = markdownHTMLTag.ReplaceAllString(line, "")
+	line = markdownStrong.ReplaceAllString(line, "")
+	line = markdownEmphasisStart.ReplaceAllString(line, "$1$2")
+	line = markdownEmphasisEnd.ReplaceAllString(line, "$1$2")
+
+	if strings.Contains(line, "|") {
+		line = strings.Trim(markdownTableSeparator.ReplaceAllString(line, " "), " ")
+	}
+
+	return html.UnescapeString(line)
+}
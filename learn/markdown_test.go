@@ -0,0 +1,92 @@
+package learn
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestExtractMarkdown(t *testing.T) {
+	tt := []struct {
+		Markdown string
+		Expected string
+	}{
+		{
+			Markdown: "# Heading #\n\nSome *emphasised* and **strong** and _under_ text with snake_case_words.\n",
+			Expected: "Heading\n\nSome emphasised and strong and under text with snake_case_words.\n",
+		},
+		{
+			Markdown: "See [the docs](http://example.com) or [the wiki][wiki], ![an image](img.png) <http://example.com>\n\n[wiki]: http://example.com/wiki\n",
+			Expected: "See the docs or the wiki,\n\n\n",
+		},
+		{
+			Markdown: "Before\n\n```go\nfunc main() {}\n```\n\nRun `go build` first.\n\n    indented code\n\nAfter",
+			Expected: "Before\n\n\n\n\n\nRun  first.\n\n\n\nAfter",
+		},
+		{
+			Markdown: "> quoted\n> > nested\n\n- one\n* two\n1. three\n\n---\n",
+			Expected: "quoted\nnested\n\none\ntwo\nthree\n\n\n",
+		},
+		{
+			Markdown: "| a | b |\n|---|:-:|\n| c | d |\n",
+			Expected: "a b\n\nc d\n",
+		},
+		{
+			Markdown: "Title\n=====\n\nFish &amp; chips<br>",
+			Expected: "Title\n\n\nFish & chips",
+		},
+	}
+
+	for _, test := range tt {
+		for _, reader := range []io.Reader{strings.NewReader(test.Markdown), iotest.OneByteReader(strings.NewReader(test.Markdown))} {
+			result, err := io.ReadAll(ExtractMarkdown(reader))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(result) != test.Expected {
+				t.Errorf("Expected %q, got %q", test.Expected, string(result))
+			}
+		}
+	}
+}
+
+// counting counts the bytes read through it
+type counting struct {
+	reader io.Reader
+	n      int
+}
+
+func (c *counting) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.n += n
+
+	return n, err
+}
+
+func TestExtractMarkdown_LongLine(t *testing.T) {
+	words := strings.Repeat("word ", MaxMarkdownLine/2)
+
+	result, err := io.ReadAll(ExtractMarkdown(strings.NewReader("# **Bold** " + words + "*end*\nnext\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the line is converted a fragment at a time, without breaking the word it was split in
+	if expected := "Bold " + words + "end\nnext\n"; string(result) != expected {
+		t.Errorf("Expected the long line to be converted in fragments, got %d bytes rather than %d", len(result), len(expected))
+	}
+
+	// a document without line breaks is handed back long before it has all been read
+	input := &counting{reader: io.LimitReader(endless('a'), 16*1024*1024)}
+
+	if _, err := ExtractMarkdown(input).Read(make([]byte, 1024)); err != nil {
+		t.Fatal(err)
+	}
+
+	if input.n > MaxMarkdownLine {
+		t.Errorf("Expected at most %d bytes to be read before the first text was handed back, got %d", MaxMarkdownLine, input.n)
+	}
+}
@@ -0,0 +1,106 @@
+package learn
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// Preprocessor wraps a document's body, transforming the text before it is tokenised
+type Preprocessor func(io.Reader) io.Reader
+
+// Preprocessors are the preprocessors which can be selected by name, e.g. with /learn?preprocess=gutenberg
+var Preprocessors = map[string]Preprocessor{
+	"gutenberg": StripGutenberg,
+}
+
+// Formats are the document formats which can be learned, e.g. with /learn?format=html. Each format's extractor turns a
+// document into the plain text it contains.
+var Formats = map[string]Preprocessor{
+	"text":     nil,
+	"html":     ExtractHTML,
+	"markdown": ExtractMarkdown,
+}
+
+// formatMediaTypes and formatExtensions are used to detect the format of a document when none is given
+var (
+	formatMediaTypes = map[string]string{
+		"text/html":             "html",
+		"application/xhtml+xml": "html",
+		"text/markdown":         "markdown",
+		"text/x-markdown":       "markdown",
+	}
+
+	formatExtensions = map[string]string{
+		".html":     "html",
+		".htm":      "html",
+		".xhtml":    "html",
+		".md":       "markdown",
+		".markdown": "markdown",
+	}
+)
+
+// detectFormat works out the format of a document from its media type or, failing that, its file name. Documents which
+// aren't recognised are treated as plain text.
+func detectFormat(document Document) string {
+	if format, ok := formatMediaTypes[document.MediaType]; ok {
+		return format
+	}
+
+	if format, ok := formatExtensions[strings.ToLower(path.Ext(document.Name))]; ok {
+		return format
+	}
+
+	return "text"
+}
+
+// extract converts a document to plain text using the given format, or the detected format if none is given
+func extract(document Document, format string) (io.Reader, error) {
+	if format == "" {
+		format = detectFormat(document)
+	}
+
+	extractor, ok := Formats[format]
+	if !ok {
+		return nil, fmt.Errorf("Unknown format %s", format)
+	}
+
+	if extractor == nil {
+		return document.Body, nil
+	}
+
+	return extractor(document.Body), nil
+}
+
+// ParsePreprocessors looks up a comma separated list of preprocessor names, returning the preprocessors in the order
+// given
+func ParsePreprocessors(names string) ([]Preprocessor, error) {
+	preprocessors := []Preprocessor{}
+
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+
+		if name == "" {
+			continue
+		}
+
+		preprocessor, ok := Preprocessors[name]
+		if !ok {
+			return nil, fmt.Errorf("Unknown preprocessor %s", name)
+		}
+
+		preprocessors = append(preprocessors, preprocessor)
+	}
+
+	return preprocessors, nil
+}
+
+// preprocess applies each preprocessor to body in turn
+func preprocess(body io.Reader, preprocessors []Preprocessor) io.Reader {
+	for _, preprocessor := range preprocessors {
+		body = preprocessor(body)
+	}
+
+	return body
+}
@@ -0,0 +1,105 @@
+package learn
+
+import (
+	"github.com/fergloragain/trigrams/gram"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestParsePreprocessors(t *testing.T) {
+	tt := []struct {
+		Names string
+		Count int
+		Error bool
+	}{
+		{Names: "", Count: 0},
+		{Names: "gutenberg", Count: 1},
+		{Names: "gutenberg, gutenberg", Count: 2},
+		{Names: "gutenberg,unknown", Error: true},
+	}
+
+	for _, test := range tt {
+		preprocessors, err := ParsePreprocessors(test.Names)
+
+		if test.Error != (err != nil) {
+			t.Errorf("Unexpected error for %s: %v", test.Names, err)
+		}
+
+		if len(preprocessors) != test.Count {
+			t.Errorf("Expected %d preprocessors for %s, got %d", test.Count, test.Names, len(preprocessors))
+		}
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tt := []struct {
+		Document Document
+		Format   string
+	}{
+		{Document: Document{}, Format: "text"},
+		{Document: Document{MediaType: "text/plain"}, Format: "text"},
+		{Document: Document{MediaType: "text/html"}, Format: "html"},
+		{Document: Document{MediaType: "text/markdown"}, Format: "markdown"},
+		{Document: Document{Name: "index.HTM"}, Format: "html"},
+		{Document: Document{Name: "README.md"}, Format: "markdown"},
+		{Document: Document{Name: "notes.txt", MediaType: "text/html"}, Format: "html"},
+	}
+
+	for _, test := range tt {
+		if format := detectFormat(test.Document); format != test.Format {
+			t.Errorf("Expected %s for %+v, got %s", test.Format, test.Document, format)
+		}
+	}
+}
+
+func TestProcess_Format(t *testing.T) {
+	tt := []struct {
+		Format      string
+		ContentType string
+		Text        string
+		Expected    [][]string
+	}{
+		{
+			ContentType: "text/html; charset=utf-8",
+			Text:        "<p>Fish &#97;nd chips</p>",
+			Expected:    [][]string{{"Fish", "and"}, {"and", "chips"}},
+		},
+		{
+			Format:   "markdown",
+			Text:     "# Fish *and* chips",
+			Expected: [][]string{{"Fish", "and"}, {"and", "chips"}},
+		},
+		{
+			Format:      "text",
+			ContentType: "text/html",
+			Text:        "<p>Fish</p>",
+			Expected:    [][]string{{"pFishp"}},
+		},
+	}
+
+	for _, test := range tt {
+		task := &Task{
+			Body:        ioutil.NopCloser(strings.NewReader(test.Text)),
+			ContentType: test.ContentType,
+			Format:      test.Format,
+			Gram:        gram.NewCollection(),
+		}
+
+		gramSize := len(test.Expected[0])
+
+		if err := task.Process(gramSize, false, regexReplacements); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(task.Gram.Grams()) != len(test.Expected) {
+			t.Fatalf("Expected %v, got %v", test.Expected, task.Gram.Grams())
+		}
+
+		for i, g := range task.Gram.Grams() {
+			if strings.Join(g, " ") != strings.Join(test.Expected[i], " ") {
+				t.Errorf("Expected %v, got %v", test.Expected, task.Gram.Grams())
+			}
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package learn
+
+import (
+	"github.com/fergloragain/trigrams/gram"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"testing/quick"
+)
+
+// chunkReader hands back at most size bytes per Read, to simulate a body arriving in arbitrary pieces
+type chunkReader struct {
+	reader io.Reader
+	size   int
+}
+
+func (c chunkReader) Read(p []byte) (int, error) {
+	if len(p) > c.size {
+		p = p[:c.size]
+	}
+
+	return c.reader.Read(p)
+}
+
+// corpus is a randomly generated text, built from a small vocabulary so that grams repeat, separated by a mix of
+// whitespace and punctuation
+type corpus string
+
+func (corpus) Generate(r *rand.Rand, size int) reflect.Value {
+	words := []string{"the", "cat", "sat", "on", "mat", "a", "dog's", "bone!", "café", "x"}
+	separators := []string{" ", "  ", "\n", "\r\n", "\t", " \n\n ", "@", ", "}
+
+	var text strings.Builder
+
+	for i := r.Intn(size * 4); i > 0; i-- {
+		text.WriteString(words[r.Intn(len(words))])
+		text.WriteString(separators[r.Intn(len(separators))])
+	}
+
+	if r.Intn(2) == 0 {
+		text.WriteString(words[r.Intn(len(words))])
+	}
+
+	return reflect.ValueOf(corpus(text.String()))
+}
+
+// referenceCounts splits the whole text into tokens at once, strips each token, and then slides a window over them
+func referenceCounts(text string, gramSize int, regexArray []RegexReplacements) map[string]int {
+	tokens := []string{}
+
+	for _, token := range strings.Fields(text) {
+		plainText, _ := stripPunctuation(token, regexArray)
+		tokens = append(tokens, strings.Fields(plainText)...)
+	}
+
+	counts := map[string]int{}
+
+	for i := 0; i+gramSize <= len(tokens); i++ {
+		counts[strings.Join(tokens[i:i+gramSize], " ")]++
+	}
+
+	return counts
+}
+
+func learnedCounts(reader io.Reader, gramSize int, regexArray []RegexReplacements, shardSize int) (map[string]int, error) {
+	task := &Task{
+		Body:      ioutil.NopCloser(reader),
+		Gram:      gram.NewCollection(),
+		Shards:    3,
+		shardSize: shardSize,
+	}
+
+	if err := task.Process(gramSize, false, regexArray); err != nil {
+		return nil, err
+	}
+
+	counts := map[string]int{}
+
+	task.Gram.Each(func(g []string, frequency int) {
+		counts[strings.Join(g, " ")] += frequency
+	})
+
+	return counts, nil
+}
+
+func TestProcess_Chunking(t *testing.T) {
+	property := func(text corpus, gramSize uint8, chunkSize uint8, shardSize uint8, strip bool) bool {
+		size := int(gramSize%4) + 1
+
+		// without the replacements, every kind of whitespace reaches the tokenizer
+		var regexArray []RegexReplacements
+
+		if strip {
+			regexArray = regexReplacements
+		}
+
+		expected := referenceCounts(string(text), size, regexArray)
+
+		readers := map[string]func() io.Reader{
+			"one byte": func() io.Reader { return iotest.OneByteReader(strings.NewReader(string(text))) },
+			"64 byte":  func() io.Reader { return chunkReader{strings.NewReader(string(text)), 64} },
+			"random":   func() io.Reader { return chunkReader{strings.NewReader(string(text)), int(chunkSize) + 1} },
+			"whole":    func() io.Reader { return strings.NewReader(string(text)) },
+		}
+
+		for name, reader := range readers {
+			counts, err := learnedCounts(reader(), size, regexArray, ShardSize)
+
+			if err != nil {
+				t.Log(err)
+				return false
+			}
+
+			if !reflect.DeepEqual(counts, expected) {
+				t.Logf("%s chunking of %q into %d-grams: expected %v, got %v", name, string(text), size, expected, counts)
+				return false
+			}
+		}
+
+		// tiny shards put shard boundaries everywhere, including between shards holding fewer than gramSize-1 tokens
+		for _, shardSize := range []int{1, int(shardSize) + 1} {
+			counts, err := learnedCounts(readers["whole"](), size, regexArray, shardSize)
+
+			if err != nil {
+				t.Log(err)
+				return false
+			}
+
+			if !reflect.DeepEqual(counts, expected) {
+				t.Logf("%d byte shards of %q into %d-grams: expected %v, got %v", shardSize, string(text), size, expected, counts)
+				return false
+			}
+		}
+
+		return true
+	}
+
+	if err := quick.Check(property, &quick.Config{MaxCount: 500}); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,166 @@
+package learn
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"path"
+	"strings"
+)
+
+// ErrNoSelector is returned when JSON Lines or CSV is learned without saying which field holds the prose
+var ErrNoSelector = errors.New("A field or column must be selected to learn JSON Lines or CSV")
+
+// Selector picks out the prose from each record of a JSON Lines or CSV document
+type Selector struct {
+	Field  string // the JSON field, dotted for nested objects, or the CSV column header
+	Column int    // the 1-based CSV column, used when Field is empty; the first row is then data rather than a header
+}
+
+const (
+	recordsJSONLines = "jsonl"
+	recordsCSV       = "csv"
+)
+
+var (
+	recordMediaTypes = map[string]string{
+		"application/x-ndjson":        recordsJSONLines,
+		"application/jsonl":           recordsJSONLines,
+		"application/x-jsonlines":     recordsJSONLines,
+		"text/csv":                    recordsCSV,
+		"application/csv":             recordsCSV,
+		"text/comma-separated-values": recordsCSV,
+	}
+
+	recordExtensions = map[string]string{
+		".jsonl":  recordsJSONLines,
+		".ndjson": recordsJSONLines,
+		".csv":    recordsCSV,
+	}
+)
+
+// recordKind reports whether a document holds one record per line, and if so, which kind
+func recordKind(document Document) string {
+	if kind, ok := recordMediaTypes[document.MediaType]; ok {
+		return kind
+	}
+
+	return recordExtensions[strings.ToLower(path.Ext(document.Name))]
+}
+
+// records reads a JSON Lines or CSV document one record at a time, calling learn with the selected field of each
+// record as a separate document. Records without the field, or where the field isn't a string, are skipped.
+func records(document Document, kind string, selector Selector, learn func(Document) error) error {
+	switch kind {
+	case recordsJSONLines:
+		return jsonRecords(document, selector, learn)
+	case recordsCSV:
+		return csvRecords(document, selector, learn)
+	default:
+		return fmt.Errorf("Unknown record format %s", kind)
+	}
+}
+
+func jsonRecords(document Document, selector Selector, learn func(Document) error) error {
+	if selector.Field == "" {
+		return ErrNoSelector
+	}
+
+	decoder := json.NewDecoder(document.Body)
+
+	for number := 1; ; number++ {
+		var record interface{}
+
+		if err := decoder.Decode(&record); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return malformed(fmt.Errorf("Record %d: %s", number, err.Error()))
+		}
+
+		text, ok := jsonField(record, selector.Field)
+		if !ok {
+			continue
+		}
+
+		if err := learn(Document{Name: fmt.Sprintf("%s#%d", document.Name, number), Body: strings.NewReader(text)}); err != nil {
+			return err
+		}
+	}
+}
+
+// jsonField follows a dotted path through nested objects, returning the string at the end of it
+func jsonField(record interface{}, field string) (string, bool) {
+	for _, key := range strings.Split(field, ".") {
+		object, ok := record.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+
+		if record, ok = object[key]; !ok {
+			return "", false
+		}
+	}
+
+	text, ok := record.(string)
+
+	return text, ok
+}
+
+func csvRecords(document Document, selector Selector, learn func(Document) error) error {
+	reader := csv.NewReader(document.Body)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	column := selector.Column - 1
+
+	if selector.Field != "" {
+		header, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return malformed(err)
+		}
+
+		column = -1
+
+		for i, name := range header {
+			if strings.TrimSpace(name) == selector.Field {
+				column = i
+				break
+			}
+		}
+
+		if column < 0 {
+			return malformed(fmt.Errorf("No column named %s", selector.Field))
+		}
+	}
+
+	if column < 0 {
+		return ErrNoSelector
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return malformed(err)
+		}
+
+		if column >= len(record) {
+			continue
+		}
+
+		line, _ := reader.FieldPos(column)
+
+		if err := learn(Document{Name: fmt.Sprintf("%s#%d", document.Name, line), Body: strings.NewReader(record[column])}); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package learn
+
+import (
+	"github.com/fergloragain/trigrams/gram"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestRecords(t *testing.T) {
+	tt := []struct {
+		Kind     string
+		Selector Selector
+		Text     string
+		Expected []string
+		Error    bool
+	}{
+		{
+			Kind:     recordsJSONLines,
+			Selector: Selector{Field: "body"},
+			Text:     "{\"body\": \"first ticket\"}\n{\"body\": 42}\n{\"other\": \"x\"}\n{\"body\": \"second ticket\"}\n",
+			Expected: []string{"first ticket", "second ticket"},
+		},
+		{
+			Kind:     recordsJSONLines,
+			Selector: Selector{Field: "ticket.description"},
+			Text:     `{"ticket": {"description": "nested text"}}` + "\n" + `{"ticket": "flat"}`,
+			Expected: []string{"nested text"},
+		},
+		{
+			Kind:     recordsJSONLines,
+			Selector: Selector{Field: "body"},
+			Text:     "{\"body\": \"ok\"}\nnot json\n",
+			Expected: []string{"ok"},
+			Error:    true,
+		},
+		{
+			Kind:  recordsJSONLines,
+			Text:  `{"body": "no field selected"}`,
+			Error: true,
+		},
+		{
+			Kind:     recordsCSV,
+			Selector: Selector{Field: "description"},
+			Text:     "id,description\n1,\"first, with a comma\"\n2\n3,\"second\nover two lines\"\n",
+			Expected: []string{"first, with a comma", "second\nover two lines"},
+		},
+		{
+			Kind:     recordsCSV,
+			Selector: Selector{Column: 2},
+			Text:     "1,first\n2,second\n",
+			Expected: []string{"first", "second"},
+		},
+		{
+			Kind:     recordsCSV,
+			Selector: Selector{Field: "missing"},
+			Text:     "id,description\n1,first\n",
+			Error:    true,
+		},
+		{
+			Kind:  recordsCSV,
+			Text:  "1,first\n",
+			Error: true,
+		},
+	}
+
+	for _, test := range tt {
+		found := []string{}
+
+		err := records(Document{Body: strings.NewReader(test.Text)}, test.Kind, test.Selector, func(document Document) error {
+			text, err := io.ReadAll(document.Body)
+			found = append(found, string(text))
+			return err
+		})
+
+		if test.Error != (err != nil) {
+			t.Errorf("Unexpected error for %q: %v", test.Text, err)
+		}
+
+		if len(found) != len(test.Expected) {
+			t.Errorf("Expected %q, got %q", test.Expected, found)
+			continue
+		}
+
+		for i := range found {
+			if found[i] != test.Expected[i] {
+				t.Errorf("Expected %q, got %q", test.Expected, found)
+			}
+		}
+	}
+}
+
+func TestProcess_Records(t *testing.T) {
+	task := &Task{
+		Body:        ioutil.NopCloser(strings.NewReader("{\"text\": \"A B\"}\n{\"text\": \"C D\"}\n")),
+		ContentType: "application/x-ndjson",
+		Selector:    Selector{Field: "text"},
+		Gram:        gram.NewCollection(),
+	}
+
+	if err := task.Process(2, false, regexReplacements); err != nil {
+		t.Fatal(err)
+	}
+
+	// each record is learned separately, so there is no [B C] gram spanning the two records
+	if len(task.Gram.Grams()) != 2 {
+		t.Fatalf("Expected 2 grams, got %v", task.Gram.Grams())
+	}
+
+	for _, g := range task.Gram.Grams() {
+		if g[0] == "B" && g[1] == "C" {
+			t.Error("Expected no gram to span two records")
+		}
+	}
+}
+
+func TestProcess_RecordsBatched(t *testing.T) {
+	var body strings.Builder
+
+	for i := 0; i < 1000; i++ {
+		body.WriteString("{\"text\": \"the cat sat\"}\n")
+	}
+
+	task := &Task{
+		ContentType: "application/x-ndjson",
+		Selector:    Selector{Field: "text"},
+		Gram:        gram.NewCollection(),
+		Document:    "records",
+		flushSize:   600,
+	}
+
+	// the collection is checked before every read of the body, which is read a byte at a time
+	totals := map[int]bool{}
+
+	task.Body = ioutil.NopCloser(flushReader{
+		reader: iotest.OneByteReader(strings.NewReader(body.String())),
+		read: func() {
+			task.Gram.RW.RLock()
+			totals[task.Gram.TotalFrequencies] = true
+			task.Gram.RW.RUnlock()
+		},
+	})
+
+	if err := task.Process(3, false, regexReplacements); err != nil {
+		t.Fatal(err)
+	}
+
+	// the records are added a batch of 600 grams at a time, rather than a record at a time
+	if len(totals) != 2 || !totals[0] || !totals[600] {
+		t.Errorf("Expected the records to be added in batches of 600 grams, got totals %v", totals)
+	}
+
+	if task.Gram.TotalFrequencies != 1000 || task.Gram.Stats().Documents != 1000 {
+		t.Errorf("Expected 1000 records to be learned, got a total frequency of %d from %d documents", task.Gram.TotalFrequencies, task.Gram.Stats().Documents)
+	}
+
+	if err := task.Gram.Unlearn("records"); err != nil || task.Gram.Len() != 0 || task.Gram.Stats().Documents != 0 {
+		t.Errorf("Expected every record to be unlearned, got %d grams from %d documents, %v", task.Gram.Len(), task.Gram.Stats().Documents, err)
+	}
+}
+
+func TestProcess_BadRecordNotFlushed(t *testing.T) {
+	task := &Task{
+		Body:        ioutil.NopCloser(strings.NewReader("{\"text\": \"the cat sat\"}\n{\"text\": \"the dog sat\"}\n{\"text\": \n")),
+		ContentType: "application/x-ndjson",
+		Selector:    Selector{Field: "text"},
+		Gram:        gram.NewCollection(),
+	}
+
+	if err := task.Process(3, false, regexReplacements); err == nil {
+		t.Fatal("Expected the bad record to fail the task")
+	}
+
+	// the records before the bad one were still waiting to be flushed, so nothing is added
+	if task.Gram.Len() != 0 || task.Gram.Stats().Documents != 0 {
+		t.Errorf("Expected nothing to be learned, got %v from %d documents", task.Gram.Grams(), task.Gram.Stats().Documents)
+	}
+}
+
+func TestProcess_BadRecordUnlearned(t *testing.T) {
+	var body strings.Builder
+
+	for i := 0; i < 10; i++ {
+		body.WriteString("{\"text\": \"the cat sat\"}\n")
+	}
+
+	body.WriteString("{\"text\": \n")
+
+	task := &Task{
+		Body:        ioutil.NopCloser(strings.NewReader(body.String())),
+		ContentType: "application/x-ndjson",
+		Selector:    Selector{Field: "text"},
+		Gram:        gram.NewCollection(),
+		Document:    "bad",
+		flushSize:   4,
+	}
+
+	if err := task.Process(3, false, regexReplacements); err == nil {
+		t.Fatal("Expected the bad record to fail the task")
+	}
+
+	// the batches flushed before the bad record are taken back out again
+	if task.Gram.Len() != 0 || task.Gram.Stats().Documents != 0 || len(task.Gram.Documents()) != 0 {
+		t.Errorf("Expected nothing to be kept, got %v from %d documents", task.Gram.Grams(), task.Gram.Stats().Documents)
+	}
+}
@@ -0,0 +1,174 @@
+package learn
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+)
+
+// ShardSize is the number of bytes of a document learned by each shard. A shard is extended past ShardSize to the next
+// whitespace, so that no token is ever split between two shards.
+const ShardSize = 1024 * 1024
+
+// FlushSize is the number of grams a learner buffers before adding them to the collection in a single batch
+const FlushSize = 10000
+
+// shardCounts is the outcome of learning a single shard: the grams which lie wholly within it, along with the tokens at
+// either end of it, which are needed to find the grams spanning it and its neighbours
+type shardCounts struct {
+	counts map[string]int
+	grams  int
+	tokens int
+	head   []string // the first gramSize-1 tokens of the shard, or all of them if there are fewer
+	tail   []string // the last gramSize-1 tokens of the shard, or all of them if there are fewer
+	err    error
+}
+
+// readShard reads the next shard from reader, returning io.EOF once there is nothing left to read
+func readShard(reader *bufio.Reader, shardSize int) ([]byte, error) {
+	shard := make([]byte, shardSize)
+
+	n, err := io.ReadFull(reader, shard)
+	shard = shard[:n]
+
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		if n == 0 {
+			return nil, io.EOF
+		}
+
+		return shard, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// carry on to the end of the current token. Only ASCII whitespace is looked for, since those bytes can never be part
+	// of a multi-byte character.
+	for extended := 0; !isASCIISpace(shard[len(shard)-1]); extended++ {
+		if extended > MaxTokenSize {
+			return nil, bufio.ErrTooLong
+		}
+
+		b, err := reader.ReadByte()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		shard = append(shard, b)
+	}
+
+	return shard, nil
+}
+
+func isASCIISpace(b byte) bool {
+	switch b {
+	case ' ', '\t', '\n', '\v', '\f', '\r':
+		return true
+	}
+
+	return false
+}
+
+// countShard tokenizes a shard, counting each gram which lies wholly within it
+func countShard(shard []byte, gramSize int, replacements []compiledReplacement) shardCounts {
+	result := shardCounts{counts: map[string]int{}}
+
+	tokens := newTokenizer(bytes.NewReader(shard), replacements)
+	window := newGramWindow(gramSize)
+
+	for {
+		token, err := tokens.next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			result.err = err
+			return result
+		}
+
+		if len(result.head) < gramSize-1 {
+			result.head = append(result.head, token)
+		}
+
+		if newGram := window.add(token); newGram != nil {
+			result.counts[strings.Join(newGram, " ")]++
+			result.grams++
+		}
+
+		result.tokens++
+	}
+
+	result.tail = window.tokens()
+
+	return result
+}
+
+// countShards learns each shard in parallel, returning the results in the same order as the shards
+func countShards(shards [][]byte, gramSize int, replacements []compiledReplacement) []shardCounts {
+	results := make([]shardCounts, len(shards))
+
+	// a document which fits in a single shard is learned without starting any goroutines
+	if len(shards) == 1 {
+		results[0] = countShard(shards[0], gramSize, replacements)
+		return results
+	}
+
+	var wg sync.WaitGroup
+
+	for i := range shards {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+			results[i] = countShard(shards[i], gramSize, replacements)
+		}(i)
+	}
+
+	wg.Wait()
+
+	return results
+}
+
+// stitcher finds the grams spanning the boundaries between consecutive shards. It keeps the last gramSize-1 tokens seen
+// so far; feeding it the head of the next shard completes exactly the grams which start before that shard and end in
+// it.
+type stitcher struct {
+	gramSize int
+	window   *gramWindow
+}
+
+func newStitcher(gramSize int) *stitcher {
+	return &stitcher{gramSize: gramSize, window: newGramWindow(gramSize)}
+}
+
+// stitch adds the grams spanning the boundary before shard to counts, returning how many there were
+func (s *stitcher) stitch(shard shardCounts, counts map[string]int) int {
+	stitched := 0
+
+	for _, token := range shard.head {
+		if newGram := s.window.add(token); newGram != nil {
+			counts[strings.Join(newGram, " ")]++
+			stitched++
+		}
+	}
+
+	// a shard with at least gramSize-1 tokens replaces everything before it; a shorter one has already been added
+	// whole, as its head
+	if shard.tokens >= s.gramSize-1 {
+		s.window = newGramWindow(s.gramSize)
+
+		for _, token := range shard.tail {
+			s.window.add(token)
+		}
+	}
+
+	return stitched
+}
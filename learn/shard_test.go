@@ -0,0 +1,137 @@
+package learn
+
+import (
+	"bufio"
+	"github.com/fergloragain/trigrams/gram"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestReadShard(t *testing.T) {
+	tt := []struct {
+		Text      string
+		ShardSize int
+		Expected  []string
+	}{
+		{
+			Text:      "one two three",
+			ShardSize: 5,
+			Expected:  []string{"one two ", "three"},
+		},
+		{
+			Text:      "one two three",
+			ShardSize: 4,
+			Expected:  []string{"one ", "two ", "three"},
+		},
+		{
+			Text:      "café\tau lait",
+			ShardSize: 4,
+			Expected:  []string{"café\t", "au lait"},
+		},
+		{
+			Text:      "",
+			ShardSize: 4,
+			Expected:  []string{},
+		},
+	}
+
+	for _, test := range tt {
+		reader := bufio.NewReader(strings.NewReader(test.Text))
+		found := []string{}
+
+		for {
+			shard, err := readShard(reader, test.ShardSize)
+			if err == io.EOF {
+				break
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			found = append(found, string(shard))
+		}
+
+		if !reflect.DeepEqual(found, test.Expected) {
+			t.Errorf("Expected %q in %d byte shards to give %q, got %q", test.Text, test.ShardSize, test.Expected, found)
+		}
+	}
+}
+
+func TestReadShard_TooLong(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader(strings.Repeat("x", MaxTokenSize+10)))
+
+	if _, err := readShard(reader, 4); err != bufio.ErrTooLong {
+		t.Errorf("Expected %v, got %v", bufio.ErrTooLong, err)
+	}
+}
+
+func TestProcess_Shards(t *testing.T) {
+	task := &Task{
+		Body:      ioutil.NopCloser(strings.NewReader("A B C D E F A B C")),
+		Gram:      gram.NewCollection(),
+		Progress:  &Progress{},
+		Shards:    4,
+		shardSize: 2,
+	}
+
+	if err := task.Process(3, false, regexReplacements); err != nil {
+		t.Fatal(err)
+	}
+
+	if task.Progress.gramsAdded.Load() != 7 {
+		t.Errorf("Expected 7 grams to be added, got %d", task.Progress.gramsAdded.Load())
+	}
+
+	if task.Gram.TotalFrequencies != 7 || len(task.Gram.Grams()) != 6 {
+		t.Errorf("Expected 6 distinct grams with a total frequency of 7, got %v", task.Gram.Grams())
+	}
+}
+
+// flushReader calls read before each read of the underlying reader
+type flushReader struct {
+	reader io.Reader
+	read   func()
+}
+
+func (f flushReader) Read(p []byte) (int, error) {
+	f.read()
+	return f.reader.Read(p)
+}
+
+func TestProcess_Flush(t *testing.T) {
+	task := &Task{
+		Gram:      gram.NewCollection(),
+		Shards:    1,
+		shardSize: 2,
+		flushSize: 2,
+	}
+
+	// the body is read a byte at a time, so the collection is checked between every shard
+	totals := []int{}
+
+	task.Body = ioutil.NopCloser(flushReader{
+		reader: iotest.OneByteReader(strings.NewReader("A B C D E F G H")),
+		read: func() {
+			task.Gram.RW.RLock()
+			totals = append(totals, task.Gram.TotalFrequencies)
+			task.Gram.RW.RUnlock()
+		},
+	})
+
+	if err := task.Process(2, false, regexReplacements); err != nil {
+		t.Fatal(err)
+	}
+
+	if totals[len(totals)-1] == 0 {
+		t.Errorf("Expected grams to be added before the end of the body, got totals %v", totals)
+	}
+
+	if task.Gram.TotalFrequencies != 7 {
+		t.Errorf("Expected a total frequency of 7, got %d", task.Gram.TotalFrequencies)
+	}
+}
@@ -0,0 +1,126 @@
+package learn
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// MaxTokenSize is the longest run of non-whitespace that will be read as a single token. Anything longer is almost
+// certainly not prose, and is reported as an error rather than buffered indefinitely.
+const MaxTokenSize = 1024 * 1024
+
+type compiledReplacement struct {
+	regex       *regexp.Regexp
+	replacement string
+}
+
+// compileReplacements compiles each regex once, up front, rather than once per use
+func compileReplacements(regexReplacements []RegexReplacements) ([]compiledReplacement, error) {
+	compiled := []compiledReplacement{}
+
+	for _, regexReplacement := range regexReplacements {
+		regex, err := regexp.Compile(regexReplacement.Regex)
+		if err != nil {
+			return nil, err
+		}
+
+		compiled = append(compiled, compiledReplacement{regex: regex, replacement: regexReplacement.Replacement})
+	}
+
+	return compiled, nil
+}
+
+// tokenizer reads whitespace separated tokens from a stream one at a time, applying the regex replacements to each
+// token as it is read. Only the current token is ever held in memory, so the cost of tokenizing is linear in the
+// length of the text, however it is chunked.
+type tokenizer struct {
+	scanner      *bufio.Scanner
+	replacements []compiledReplacement
+	queue        []string
+}
+
+func newTokenizer(r io.Reader, replacements []compiledReplacement) *tokenizer {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 4096), MaxTokenSize)
+	scanner.Split(bufio.ScanWords)
+
+	return &tokenizer{scanner: scanner, replacements: replacements}
+}
+
+// next returns the next token, or io.EOF once the stream is exhausted. Tokens which the replacements reduce to nothing
+// are skipped, and a token which the replacements split with whitespace is returned as several tokens.
+func (t *tokenizer) next() (string, error) {
+	for len(t.queue) == 0 {
+		if !t.scanner.Scan() {
+			if err := t.scanner.Err(); err != nil {
+				return "", err
+			}
+
+			return "", io.EOF
+		}
+
+		token := t.scanner.Text()
+
+		if len(t.replacements) == 0 {
+			return token, nil
+		}
+
+		for _, replacement := range t.replacements {
+			token = replacement.regex.ReplaceAllString(token, replacement.replacement)
+		}
+
+		t.queue = strings.Fields(token)
+	}
+
+	token := t.queue[0]
+	t.queue = t.queue[1:]
+
+	return token, nil
+}
+
+// gramWindow is a ring buffer of the last gramSize-1 tokens, which together with each new token form the next gram
+type gramWindow struct {
+	previous []string
+	next     int
+	filled   int
+}
+
+func newGramWindow(gramSize int) *gramWindow {
+	return &gramWindow{previous: make([]string, gramSize-1)}
+}
+
+// add pushes a token into the window, returning the gram it completes, or nil if there aren't yet enough tokens
+func (w *gramWindow) add(token string) []string {
+	var gram []string
+
+	if w.filled == len(w.previous) {
+		gram = make([]string, 0, len(w.previous)+1)
+		gram = append(gram, w.previous[w.next:]...)
+		gram = append(gram, w.previous[:w.next]...)
+		gram = append(gram, token)
+	} else {
+		w.filled++
+	}
+
+	if len(w.previous) > 0 {
+		w.previous[w.next] = token
+		w.next = (w.next + 1) % len(w.previous)
+	}
+
+	return gram
+}
+
+// tokens returns the tokens currently held in the window, oldest first
+func (w *gramWindow) tokens() []string {
+	tokens := make([]string, 0, w.filled)
+
+	if w.filled < len(w.previous) {
+		return append(tokens, w.previous[:w.filled]...)
+	}
+
+	tokens = append(tokens, w.previous[w.next:]...)
+
+	return append(tokens, w.previous[:w.next]...)
+}
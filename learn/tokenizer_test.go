@@ -0,0 +1,107 @@
+package learn
+
+import (
+	"bufio"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTokenizer(t *testing.T) {
+	tt := []struct {
+		Text         string
+		Replacements []RegexReplacements
+		Expected     []string
+	}{
+		{
+			Text:     "A  B\tC\r\nD\n\n",
+			Expected: []string{"A", "B", "C", "D"},
+		},
+		{
+			Text:         "Hello, @world! £5",
+			Replacements: regexReplacements,
+			Expected:     []string{"Hello,", "world!", "5"},
+		},
+		{
+			Text:         "split_here",
+			Replacements: []RegexReplacements{{Regex: "_", Replacement: " "}},
+			Expected:     []string{"split", "here"},
+		},
+		{
+			Text:     "",
+			Expected: []string{},
+		},
+	}
+
+	for _, test := range tt {
+		replacements, err := compileReplacements(test.Replacements)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tokens := newTokenizer(strings.NewReader(test.Text), replacements)
+
+		found := []string{}
+
+		for {
+			token, err := tokens.next()
+			if err == io.EOF {
+				break
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			found = append(found, token)
+		}
+
+		if !reflect.DeepEqual(found, test.Expected) {
+			t.Errorf("Expected %q to give %q, got %q", test.Text, test.Expected, found)
+		}
+	}
+}
+
+func TestTokenizer_TooLong(t *testing.T) {
+	tokens := newTokenizer(strings.NewReader(strings.Repeat("x", MaxTokenSize+1)), nil)
+
+	if _, err := tokens.next(); err != bufio.ErrTooLong {
+		t.Errorf("Expected %v, got %v", bufio.ErrTooLong, err)
+	}
+}
+
+func TestGramWindow(t *testing.T) {
+	tt := []struct {
+		GramSize int
+		Expected [][]string
+	}{
+		{
+			GramSize: 1,
+			Expected: [][]string{{"A"}, {"B"}, {"C"}, {"D"}},
+		},
+		{
+			GramSize: 3,
+			Expected: [][]string{{"A", "B", "C"}, {"B", "C", "D"}},
+		},
+		{
+			GramSize: 5,
+			Expected: [][]string{},
+		},
+	}
+
+	for _, test := range tt {
+		window := newGramWindow(test.GramSize)
+		found := [][]string{}
+
+		for _, token := range []string{"A", "B", "C", "D"} {
+			if gram := window.add(token); gram != nil {
+				found = append(found, gram)
+			}
+		}
+
+		if !reflect.DeepEqual(found, test.Expected) {
+			t.Errorf("Expected %d-grams %q, got %q", test.GramSize, test.Expected, found)
+		}
+	}
+}
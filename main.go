@@ -1,13 +1,19 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"github.com/fergloragain/trigrams/arpa"
 	"github.com/fergloragain/trigrams/generate"
 	"github.com/fergloragain/trigrams/gram"
 	"github.com/fergloragain/trigrams/learn"
 	"github.com/julienschmidt/httprouter"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 // Define consts for now, these should be command line flags
@@ -17,10 +23,27 @@ const (
 	MaxWords         = 100
 	GramSize         = 3
 	StripPunctuation = false
+	ShutdownTimeout  = 30 * time.Second
+	SnapshotFile     = ""            // when set, the model is restored from and saved to this file
+	PublishInterval  = time.Second   // the least time between learned grams being published for generation
+	CompiledModel    = ""            // when set, generation reads from this memory mapped model, with learned grams layered on top
+	ProvenanceLimit  = 5             // the most documents recorded against each gram, for /generate?provenance=true; 0 records none
+	HalfLife         = 0 * time.Hour // when set, the weight of each gram for generation decays, halving every HalfLife
+	PruneBelow       = 0.01          // grams whose decayed weight falls below this are pruned
+	DecayInterval    = time.Minute   // how often decayed weights are brought up to date and faded grams pruned
 )
 
 func main() {
 
+	// anything after the program name is one of the command line tools, rather than running the server
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
+
 	// If MaxWords is defined, check that it is a reasonable size, i.e. greater than the gram size
 	if MaxWords > 0 && MaxWords < GramSize {
 		log.Fatal(fmt.Sprintf("Maximum number of words (%d) cannot be less than gram size (%d)", MaxWords, GramSize))
@@ -29,30 +52,153 @@ func main() {
 	router := httprouter.New()
 
 	// create the learner queue and workers for handling /learn requests
-	learnQueue := make(chan learn.Task, MaxQueue)
-	learnDispatcher := learn.NewDispatcher(MaxWorker)
-	learnDispatcher.Run(learnQueue, GramSize, StripPunctuation)
+	learnDispatcher := learn.NewDispatcher(MaxWorker, MaxQueue)
+	learnDispatcher.Run(GramSize, StripPunctuation)
 
 	// create the generate queue and workers for handling /generate requests
-	generationQueue := make(chan generate.Task, MaxQueue)
-	generationDispatcher := generate.NewDispatcher(MaxWorker)
-	generationDispatcher.Run(generationQueue, MaxWords, GramSize)
+	generationDispatcher := generate.NewDispatcher(MaxWorker, MaxQueue)
+	generationDispatcher.Run(MaxWords, GramSize)
+
+	// background learn jobs started with /learn?async=true
+	learnJobs := learn.NewJobs()
 
 	// the gramCollection is our in-memory data store
 	gramCollection := gram.NewCollection()
 
+	if CompiledModel != "" {
+		base, err := gram.OpenCompiled(CompiledModel)
+		if err != nil {
+			log.Fatal(fmt.Sprintf("Unable to open compiled model %s: %s", CompiledModel, err.Error()))
+		}
+
+		defer base.Close()
+
+		if base.GramSize() != GramSize {
+			log.Fatal(fmt.Sprintf("Compiled model %s holds grams of %d words, not %d", CompiledModel, base.GramSize(), GramSize))
+		}
+
+		gramCollection = gram.NewLayeredCollection(base)
+		log.Printf("Mapped %d grams from %s", base.Len(), CompiledModel)
+	}
+
+	gramCollection.PublishInterval = PublishInterval
+	gramCollection.ProvenanceLimit = ProvenanceLimit
+	gramCollection.HalfLife = HalfLife
+	gramCollection.PruneBelow = PruneBelow
+
+	if SnapshotFile != "" {
+		if err := gramCollection.LoadFile(SnapshotFile); err != nil {
+			log.Fatal(fmt.Sprintf("Unable to load snapshot %s: %s", SnapshotFile, err.Error()))
+		}
+
+		usage := gramCollection.Memory()
+		log.Printf("Loaded %d grams over %d words from %s, using about %d bytes", usage.Grams, usage.Words, SnapshotFile, usage.TotalBytes)
+	}
+
+	if HalfLife > 0 {
+		go decay(gramCollection)
+	}
+
 	// add handlers to the webserver
-	handleLearn(router, gramCollection, learnQueue)
-	handleGenerate(router, gramCollection, generationQueue)
+	handleLearn(router, gramCollection, learnDispatcher, learnJobs)
+	handleGenerate(router, gramCollection, generationDispatcher)
+	handleStats(router, gramCollection)
+	handleGrams(router, gramCollection)
+	handleARPA(router, gramCollection)
+	handleExport(router, gramCollection)
+
+	server := &http.Server{
+		Addr:    ":8080",
+		Handler: router,
+	}
+
+	// run the server until it is shut down
+	serverErrors := make(chan error, 1)
+
+	go func() {
+		serverErrors <- server.ListenAndServe()
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	select {
+	case err := <-serverErrors:
+		log.Fatal(err)
+	case sig := <-signals:
+		log.Printf("Received %s, shutting down", sig)
+	}
 
-	// run the server
-	log.Fatal(http.ListenAndServe(":8080", router))
+	shutdown(server, learnDispatcher, generationDispatcher, gramCollection)
 }
 
-func handleLearn(router *httprouter.Router, gramCollection *gram.GramCollection, learnQueue chan learn.Task) {
-	router.Handle("POST", "/learn", learn.Handler(gramCollection, learnQueue))
+// shutdown stops accepting new requests, waits for in-flight requests to finish, drains and stops the dispatchers,
+// and finally writes a snapshot of the model if persistence is configured. Everything must complete within
+// ShutdownTimeout; anything still running after that is abandoned.
+func shutdown(server *http.Server, learnDispatcher *learn.LearnDispatcher, generationDispatcher *generate.GenerationDispatcher, gramCollection *gram.GramCollection) {
+	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Error shutting down server: %s", err.Error())
+	}
+
+	if err := learnDispatcher.Stop(ctx); err != nil {
+		log.Printf("Error draining learn queue: %s", err.Error())
+	}
+
+	if err := generationDispatcher.Stop(ctx); err != nil {
+		log.Printf("Error draining generation queue: %s", err.Error())
+	}
+
+	if SnapshotFile != "" {
+		if err := gramCollection.SaveFile(SnapshotFile); err != nil {
+			log.Printf("Error writing snapshot %s: %s", SnapshotFile, err.Error())
+		} else {
+			log.Printf("Wrote snapshot to %s", SnapshotFile)
+		}
+	}
 }
 
-func handleGenerate(router *httprouter.Router, gramCollection *gram.GramCollection, generationQueue chan generate.Task) {
-	router.Handle("GET", "/generate", generate.Handler(gramCollection, generationQueue))
+func handleLearn(router *httprouter.Router, gramCollection *gram.GramCollection, learnDispatcher *learn.LearnDispatcher, learnJobs *learn.Jobs) {
+	router.Handle("POST", "/learn", learn.Handler(gramCollection, learnDispatcher, learnJobs))
+	router.Handle("GET", "/jobs/:id", learn.JobHandler(learnJobs))
+	router.Handle("DELETE", "/jobs/:id", learn.CancelJobHandler(learnJobs))
+	router.Handle("GET", "/documents", gram.DocumentsHandler(gramCollection))
+	router.Handle("DELETE", "/documents/:id", gram.UnlearnHandler(gramCollection))
+}
+
+func handleGenerate(router *httprouter.Router, gramCollection *gram.GramCollection, generationDispatcher *generate.GenerationDispatcher) {
+	router.Handle("GET", "/generate", generate.Handler(gramCollection, generationDispatcher))
+}
+
+func handleStats(router *httprouter.Router, gramCollection *gram.GramCollection) {
+	router.Handle("GET", "/stats", gram.StatsHandler(gramCollection))
+}
+
+func handleGrams(router *httprouter.Router, gramCollection *gram.GramCollection) {
+	router.Handle("GET", "/grams", gram.GramsHandler(gramCollection))
+	router.Handle("GET", "/grams/top", gram.TopGramsHandler(gramCollection))
+	router.Handle("GET", "/words/:word/successors", gram.SuccessorsHandler(gramCollection))
+	router.Handle("GET", "/words/:word/predecessors", gram.PredecessorsHandler(gramCollection))
+}
+
+func handleARPA(router *httprouter.Router, gramCollection *gram.GramCollection) {
+	router.Handle("GET", "/arpa", arpa.ExportHandler(gramCollection))
+	router.Handle("POST", "/arpa", arpa.ImportHandler(gramCollection, GramSize))
+}
+
+func handleExport(router *httprouter.Router, gramCollection *gram.GramCollection) {
+	router.Handle("GET", "/export", gram.ExportHandler(gramCollection))
+	router.Handle("POST", "/import", gram.ImportHandler(gramCollection, GramSize))
+	router.Handle("POST", "/merge", gram.MergeHandler(gramCollection, GramSize))
+	router.Handle("POST", "/subtract", gram.SubtractHandler(gramCollection, GramSize))
+	router.Handle("POST", "/diff", gram.DiffHandler(gramCollection, GramSize))
+}
+
+// decay periodically brings the decayed weights of the grams up to date, pruning those that have faded away
+func decay(gramCollection *gram.GramCollection) {
+	for range time.Tick(DecayInterval) {
+		gramCollection.Decay()
+	}
 }
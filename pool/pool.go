@@ -0,0 +1,284 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	ErrQueueFull = errors.New("Queue is full")
+	ErrStopped   = errors.New("Pool has been stopped")
+)
+
+// Result is the outcome of a single task; Err is set if the handler returned an error or panicked
+type Result[R any] struct {
+	Value R
+	Err   error
+}
+
+// Stats is a point-in-time view of the pool
+type Stats struct {
+	Workers   int
+	Busy      int
+	Queued    int
+	Submitted int64
+	Completed int64
+	Failed    int64
+	Panics    int64
+}
+
+type job[T, R any] struct {
+	task   T
+	result chan Result[R]
+}
+
+// Pool runs tasks of type T on a fixed (but resizable) number of workers, producing results of type R. Tasks wait in a
+// bounded queue until a worker is free to take them.
+type Pool[T, R any] struct {
+	handler func(T) (R, error)
+	queue   chan job[T, R]
+
+	mu       sync.RWMutex
+	workers  []chan bool
+	started  bool
+	stopped  bool
+	stopping chan bool // closed as soon as Stop is called, to release submitters blocked on a full queue
+	stopOnce sync.Once
+	sending  sync.WaitGroup // submitters which may still send to the queue, which can't be closed until they're done
+	running  sync.WaitGroup
+
+	busy      atomic.Int64
+	submitted atomic.Int64
+	completed atomic.Int64
+	failed    atomic.Int64
+	panics    atomic.Int64
+}
+
+// New creates a pool of workers, each of which calls handler for the tasks it takes from a queue of at most queueSize
+// tasks. The workers don't run until Start is called.
+func New[T, R any](workers, queueSize int, handler func(T) (R, error)) *Pool[T, R] {
+	return &Pool[T, R]{
+		handler:  handler,
+		queue:    make(chan job[T, R], queueSize),
+		workers:  make([]chan bool, workers),
+		stopping: make(chan bool),
+	}
+}
+
+// Start launches the workers
+func (p *Pool[T, R]) Start() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.started {
+		return
+	}
+
+	p.started = true
+
+	for i := range p.workers {
+		p.workers[i] = p.startWorker()
+	}
+}
+
+// startWorker launches a single worker and returns the channel used to tell it to quit. Must be called with mu held.
+func (p *Pool[T, R]) startWorker() chan bool {
+	quit := make(chan bool)
+
+	p.running.Add(1)
+
+	go func() {
+		defer p.running.Done()
+
+		for {
+			select {
+			case j, ok := <-p.queue:
+				if !ok {
+					// the queue has been closed and drained
+					return
+				}
+
+				j.result <- p.run(j.task)
+			case <-quit:
+				return
+			}
+		}
+	}()
+
+	return quit
+}
+
+// run calls the handler for a single task, converting a panic into an error so that one bad task can't take down the
+// worker
+func (p *Pool[T, R]) run(task T) (result Result[R]) {
+	p.busy.Add(1)
+
+	defer func() {
+		p.busy.Add(-1)
+
+		if r := recover(); r != nil {
+			p.panics.Add(1)
+			result.Err = fmt.Errorf("Task panicked: %v", r)
+		}
+
+		if result.Err != nil {
+			p.failed.Add(1)
+		}
+
+		p.completed.Add(1)
+	}()
+
+	result.Value, result.Err = p.handler(task)
+
+	return result
+}
+
+// Submit queues a task, blocking while the queue is full, and returns a channel which receives the task's result once
+// a worker has processed it. A submitter still blocked when Stop is called gets ErrStopped. The lock isn't held while
+// blocked, so that Stop is never kept waiting for room in the queue.
+func (p *Pool[T, R]) Submit(task T) (<-chan Result[R], error) {
+	p.mu.RLock()
+
+	if p.stopped {
+		p.mu.RUnlock()
+		return nil, ErrStopped
+	}
+
+	p.sending.Add(1)
+	p.mu.RUnlock()
+
+	defer p.sending.Done()
+
+	j := job[T, R]{task: task, result: make(chan Result[R], 1)}
+
+	select {
+	case p.queue <- j:
+		p.submitted.Add(1)
+		return j.result, nil
+	case <-p.stopping:
+		return nil, ErrStopped
+	}
+}
+
+// TrySubmit queues a task like Submit, but returns ErrQueueFull instead of blocking when the queue is full
+func (p *Pool[T, R]) TrySubmit(task T) (<-chan Result[R], error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.stopped {
+		return nil, ErrStopped
+	}
+
+	j := job[T, R]{task: task, result: make(chan Result[R], 1)}
+
+	select {
+	case p.queue <- j:
+		p.submitted.Add(1)
+		return j.result, nil
+	default:
+		return nil, ErrQueueFull
+	}
+}
+
+// Do submits a task and waits for its result
+func (p *Pool[T, R]) Do(task T) (R, error) {
+	result, err := p.Submit(task)
+	if err != nil {
+		var zero R
+		return zero, err
+	}
+
+	r := <-result
+
+	return r.Value, r.Err
+}
+
+// Resize grows or shrinks the number of workers. Workers removed by shrinking finish their current task before exiting.
+func (p *Pool[T, R]) Resize(workers int) {
+	if workers < 0 {
+		workers = 0
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.stopped {
+		return
+	}
+
+	for len(p.workers) > workers {
+		last := len(p.workers) - 1
+
+		if p.workers[last] != nil {
+			close(p.workers[last])
+		}
+
+		p.workers = p.workers[:last]
+	}
+
+	for len(p.workers) < workers {
+		var quit chan bool
+
+		if p.started {
+			quit = p.startWorker()
+		}
+
+		p.workers = append(p.workers, quit)
+	}
+}
+
+// Stop stops accepting new tasks and waits for the workers to finish everything already queued. If ctx expires first,
+// the context error is returned and the workers are left to finish in the background.
+func (p *Pool[T, R]) Stop(ctx context.Context) error {
+	p.stopOnce.Do(func() {
+		close(p.stopping)
+	})
+
+	p.mu.Lock()
+
+	if !p.stopped {
+		p.stopped = true
+
+		// the queue is closed once the last submitter has given up or got its task in, so that nothing sends to it after
+		go func() {
+			p.sending.Wait()
+			close(p.queue)
+		}()
+	}
+
+	p.mu.Unlock()
+
+	done := make(chan bool)
+
+	go func() {
+		p.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stats returns the current size and activity of the pool
+func (p *Pool[T, R]) Stats() Stats {
+	p.mu.RLock()
+	workers := len(p.workers)
+	p.mu.RUnlock()
+
+	return Stats{
+		Workers:   workers,
+		Busy:      int(p.busy.Load()),
+		Queued:    len(p.queue),
+		Submitted: p.submitted.Load(),
+		Completed: p.completed.Load(),
+		Failed:    p.failed.Load(),
+		Panics:    p.panics.Load(),
+	}
+}
@@ -0,0 +1,258 @@
+package pool
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDo(t *testing.T) {
+	p := New(2, 2, func(n int) (int, error) {
+		if n < 0 {
+			return 0, errors.New("negative")
+		}
+
+		return n * 2, nil
+	})
+
+	p.Start()
+
+	tt := []struct {
+		Task   int
+		Result int
+		Error  string
+	}{
+		{Task: 1, Result: 2},
+		{Task: 21, Result: 42},
+		{Task: -1, Error: "negative"},
+	}
+
+	for _, test := range tt {
+		res, err := p.Do(test.Task)
+
+		if test.Error != "" {
+			if err == nil || err.Error() != test.Error {
+				t.Errorf("Expected error %s, got %v", test.Error, err)
+			}
+			continue
+		}
+
+		if err != nil || res != test.Result {
+			t.Errorf("Expected %d, got %d (%v)", test.Result, res, err)
+		}
+	}
+
+	stats := p.Stats()
+
+	if stats.Submitted != 3 || stats.Completed != 3 || stats.Failed != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestPanicRecovery(t *testing.T) {
+	p := New(1, 1, func(n int) (int, error) {
+		if n == 0 {
+			panic("boom")
+		}
+
+		return n, nil
+	})
+
+	p.Start()
+
+	if _, err := p.Do(0); err == nil {
+		t.Error("Expected panic to be reported as an error")
+	}
+
+	// the single worker must have survived the panic
+	if res, err := p.Do(1); err != nil || res != 1 {
+		t.Errorf("Expected worker to recover, got %d (%v)", res, err)
+	}
+
+	if p.Stats().Panics != 1 {
+		t.Fail()
+	}
+}
+
+func TestTrySubmit(t *testing.T) {
+	block := make(chan bool)
+
+	p := New(1, 1, func(n int) (int, error) {
+		<-block
+		return n, nil
+	})
+
+	p.Start()
+
+	// the first task occupies the worker, the second sits in the queue, and the third doesn't fit
+	first, _ := p.Submit(1)
+
+	for p.Stats().Busy != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	second, err := p.TrySubmit(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.TrySubmit(3); err != ErrQueueFull {
+		t.Errorf("Expected ErrQueueFull, got %v", err)
+	}
+
+	close(block)
+
+	if r := <-first; r.Value != 1 {
+		t.Fail()
+	}
+
+	if r := <-second; r.Value != 2 {
+		t.Fail()
+	}
+}
+
+func TestStop(t *testing.T) {
+	var mu sync.Mutex
+	processed := 0
+
+	p := New(2, 10, func(n int) (int, error) {
+		time.Sleep(time.Millisecond)
+
+		mu.Lock()
+		processed++
+		mu.Unlock()
+
+		return n, nil
+	})
+
+	p.Start()
+
+	for i := 0; i < 10; i++ {
+		if _, err := p.Submit(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := p.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// everything queued before Stop must have been processed
+	if processed != 10 {
+		t.Errorf("Expected 10 tasks to be processed, got %d", processed)
+	}
+
+	if _, err := p.Submit(11); err != ErrStopped {
+		t.Errorf("Expected ErrStopped, got %v", err)
+	}
+}
+
+func TestStopTimeout(t *testing.T) {
+	block := make(chan bool)
+	defer close(block)
+
+	p := New(1, 1, func(n int) (int, error) {
+		<-block
+		return n, nil
+	})
+
+	p.Start()
+	p.Submit(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := p.Stop(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected deadline to be exceeded, got %v", err)
+	}
+}
+
+func TestStopBlockedSubmitter(t *testing.T) {
+	block := make(chan bool)
+	defer close(block)
+
+	p := New(1, 1, func(n int) (int, error) {
+		<-block
+		return n, nil
+	})
+
+	p.Start()
+	p.Submit(1)
+
+	// wait for the worker to take the first task, so the second fills the queue and the third blocks
+	for p.Stats().Busy == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	p.Submit(2)
+
+	submitted := make(chan error)
+
+	go func() {
+		_, err := p.Submit(3)
+		submitted <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	stopped := make(chan error)
+
+	go func() {
+		stopped <- p.Stop(ctx)
+	}()
+
+	select {
+	case err := <-stopped:
+		if err != context.DeadlineExceeded {
+			t.Errorf("Expected deadline to be exceeded, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected Stop to return once its context expired")
+	}
+
+	if err := <-submitted; err != ErrStopped {
+		t.Errorf("Expected the blocked submitter to get ErrStopped, got %v", err)
+	}
+}
+
+func TestResize(t *testing.T) {
+	p := New(1, 0, func(n int) (int, error) {
+		return n, nil
+	})
+
+	// resizing before Start only changes how many workers Start launches
+	p.Resize(3)
+	p.Start()
+
+	if p.Stats().Workers != 3 {
+		t.Fail()
+	}
+
+	p.Resize(1)
+
+	if p.Stats().Workers != 1 {
+		t.Fail()
+	}
+
+	if res, err := p.Do(5); err != nil || res != 5 {
+		t.Errorf("Expected pool to keep working after shrinking, got %d (%v)", res, err)
+	}
+
+	p.Resize(4)
+
+	if p.Stats().Workers != 4 {
+		t.Fail()
+	}
+
+	if res, err := p.Do(6); err != nil || res != 6 {
+		t.Errorf("Expected pool to keep working after growing, got %d (%v)", res, err)
+	}
+}